@@ -1,11 +1,15 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/gin-contrib/cors"
@@ -15,9 +19,17 @@ import (
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	"github.com/yukaty/go-trailhead/backend/internal/database"
 	"github.com/yukaty/go-trailhead/backend/internal/handler"
+	"github.com/yukaty/go-trailhead/backend/internal/jobs"
 	"github.com/yukaty/go-trailhead/backend/internal/middleware"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
 )
 
+// Number of goroutines running background jobs
+const jobWorkers = 2
+
+// Time given to in-flight requests and running jobs to finish on shutdown
+const shutdownTimeout = 30 * time.Second
+
 func main() {
 	// Read environment variables
 	if os.Getenv("JWT_SECRET") == "" {
@@ -30,6 +42,20 @@ func main() {
 	// Initialize database connection
 	database.InitDB()
 
+	// Use Stripe for checkout and refunds
+	handler.Payments = payment.NewStripe(os.Getenv("STRIPE_SECRET_KEY"), os.Getenv("STRIPE_WEBHOOK_SECRET"))
+
+	// Start background sweeper releasing stock held by abandoned checkouts
+	handler.StartStockHoldSweeper()
+
+	// Start background sweeper deleting expired idempotency keys
+	middleware.StartIdempotencyKeySweeper()
+
+	// Start background job workers (side effects such as file deletion, registered together with database changes)
+	jobRunner := jobs.NewRunner(database.GetDB(), jobWorkers)
+	handler.RegisterJobHandlers(jobRunner)
+	jobRunner.Start()
+
 	// Create Gin default router
 	router := gin.Default()
 
@@ -46,7 +72,10 @@ func main() {
 		AllowMethods: []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
 
 		// Allowed HTTP headers
-		AllowHeaders: []string{"Content-Type"},
+		AllowHeaders: []string{"Content-Type", middleware.IdempotencyKeyHeader},
+
+		// Response headers readable by frontend
+		ExposeHeaders: []string{middleware.IdempotentReplayedHeader},
 
 		// Allow cookie transmission (for authentication)
 		AllowCredentials: true,
@@ -72,10 +101,34 @@ func main() {
 		api.GET("/products/:id", handler.GetProductByIDHandler)
 		api.GET("/home", handler.GetHomePageProductsHandler)
 		api.GET("/products/:id/reviews", handler.GetReviewsHandler)
+		api.GET("/products/:id/variants", handler.GetProductVariantsHandler)
+		api.GET("/categories", handler.ListCategoriesHandler)
+		api.GET("/categories/:id", handler.GetCategoryHandler)
 		api.POST("/users", handler.RegisterUserHandler)
 		api.POST("/inquiries", handler.CreateInquiryHandler)
 		api.POST("/orders/webhook", handler.StripeWebhookHandler)
 
+		// Route group for both logged-in users and anonymous visitors
+		// These routes execute OptionalAuthMiddleware middleware function first
+		cart := api.Group("/cart")
+		cart.Use(middleware.OptionalAuthMiddleware())
+		{
+			cart.GET("", handler.GetCartHandler)
+			cart.PUT("", handler.UpdateCartHandler)
+			cart.DELETE("", handler.ClearCartHandler)
+		}
+
+		// Checkout is open to anonymous visitors as guest checkout (logged-in users check out with their account)
+		// Guests track orders with signed link returned at checkout (and add them to an account with the same link)
+		// Requests with Idempotency-Key header are processed once (retries get the first response; guests need cart token cookie)
+		checkout := api.Group("/orders")
+		checkout.Use(middleware.OptionalAuthMiddleware())
+		checkout.Use(middleware.IdempotencyMiddleware())
+		{
+			checkout.POST("/checkout", handler.CreateCheckoutSessionHandler)
+		}
+		api.GET("/orders/guest/:id", handler.GetGuestOrderHandler)
+
 		auth := api.Group("/auth")
 		{
 			auth.POST("/login", handler.LoginHandler)
@@ -90,13 +143,20 @@ func main() {
 			authorized.GET("/users/me", handler.GetUserMeHandler)
 			authorized.PUT("/users", handler.UpdateUserHandler)
 			authorized.PUT("/users/password", handler.UpdatePasswordHandler)
-			authorized.POST("/orders/checkout", handler.CreateCheckoutSessionHandler)
 			authorized.GET("/orders", handler.GetOrdersHandler)
-			authorized.POST("/products/:id/reviews", handler.CreateReviewHandler)
+			authorized.GET("/orders/:id", handler.GetOrderHandler)
+			authorized.POST("/orders/:id/cancel", handler.CancelOrderHandler)
+			authorized.POST("/orders/guest/:id/claim", handler.ClaimGuestOrderHandler)
+			authorized.POST("/products/:id/reviews", middleware.IdempotencyMiddleware(), handler.CreateReviewHandler)
 			authorized.GET("/favorites", handler.ListFavoritesHandler)
 			authorized.POST("/favorites", handler.AddFavoriteHandler)
 			authorized.GET("/favorites/:productId", handler.GetFavoriteStatusHandler)
 			authorized.DELETE("/favorites/:productId", handler.RemoveFavoriteHandler)
+			authorized.GET("/addresses", handler.ListAddressesHandler)
+			authorized.POST("/addresses", handler.CreateAddressHandler)
+			authorized.PUT("/addresses/:id", handler.UpdateAddressHandler)
+			authorized.PUT("/addresses/:id/default", handler.SetDefaultAddressHandler)
+			authorized.DELETE("/addresses/:id", handler.DeleteAddressHandler)
 		}
 
 		// Route group requiring admin privileges
@@ -104,12 +164,41 @@ func main() {
 		admin := api.Group("/")
 		admin.Use(middleware.AuthMiddleware())
 		admin.Use(middleware.AdminAuthMiddleware())
+		idempotent := middleware.IdempotencyMiddleware() // Product endpoints accept Idempotency-Key header
 		{
-			admin.POST("/products", handler.AdminCreateProductHandler)
-			admin.PUT("/products/:id", handler.AdminUpdateProductHandler)
-			admin.DELETE("/products/:id", handler.AdminDeleteProductHandler)
+			admin.POST("/products", idempotent, handler.AdminCreateProductHandler)
+			admin.PUT("/products/:id", idempotent, handler.AdminUpdateProductHandler)
+			admin.DELETE("/products/:id", idempotent, handler.AdminDeleteProductHandler)
+			admin.PUT("/products/:id/categories", idempotent, handler.AdminSetProductCategoriesHandler)
+			admin.POST("/products/:id/variants", idempotent, handler.AdminCreateVariantHandler)
+			admin.PUT("/products/:id/variants/:variantId", idempotent, handler.AdminUpdateVariantHandler)
+			admin.DELETE("/products/:id/variants/:variantId", idempotent, handler.AdminDeleteVariantHandler)
+			admin.POST("/categories", handler.AdminCreateCategoryHandler)
+			admin.PUT("/categories/:id", handler.AdminUpdateCategoryHandler)
+			admin.DELETE("/categories/:id", handler.AdminDeleteCategoryHandler)
 			admin.GET("/inquiries", handler.ListInquiriesHandler)
-
+			admin.GET("/admin/orders", handler.AdminListOrdersHandler)
+			admin.GET("/admin/orders/:id", handler.AdminGetOrderHandler)
+			admin.PUT("/admin/orders/:id/status", handler.AdminUpdateOrderStatusHandler)
+			admin.POST("/admin/orders/:id/refunds", handler.AdminCreateRefundHandler)
+			admin.GET("/admin/shipping-rates", handler.AdminListShippingRatesHandler)
+			admin.POST("/admin/shipping-rates", handler.AdminCreateShippingRateHandler)
+			admin.PUT("/admin/shipping-rates/:id", handler.AdminUpdateShippingRateHandler)
+			admin.DELETE("/admin/shipping-rates/:id", handler.AdminDeleteShippingRateHandler)
+			admin.GET("/admin/tax-rates", handler.AdminListTaxRatesHandler)
+			admin.POST("/admin/tax-rates", handler.AdminCreateTaxRateHandler)
+			admin.PUT("/admin/tax-rates/:id", handler.AdminUpdateTaxRateHandler)
+			admin.DELETE("/admin/tax-rates/:id", handler.AdminDeleteTaxRateHandler)
+			admin.GET("/admin/coupons", handler.AdminListCouponsHandler)
+			admin.GET("/admin/coupons/:id", handler.AdminGetCouponHandler)
+			admin.POST("/admin/coupons", handler.AdminCreateCouponHandler)
+			admin.PUT("/admin/coupons/:id", handler.AdminUpdateCouponHandler)
+			admin.DELETE("/admin/coupons/:id", handler.AdminDeleteCouponHandler)
+			admin.GET("/admin/webhook-events", handler.AdminListWebhookEventsHandler)
+			admin.GET("/admin/webhook-events/:id", handler.AdminGetWebhookEventHandler)
+			admin.POST("/admin/webhook-events/:id/replay", handler.AdminReplayWebhookEventHandler)
+			admin.GET("/admin/jobs", handler.AdminListJobsHandler)
+			admin.POST("/admin/jobs/:id/retry", handler.AdminRetryJobHandler)
 		}
 	}
 
@@ -118,8 +207,39 @@ func main() {
 	if port == "" {
 		port = "8080"
 	}
-	log.Println("Starting Gin server on port " + port)
-	router.Run(":" + port)
+	srv := &http.Server{
+		Addr:    ":" + port,
+		Handler: router,
+	}
+
+	// Stop on SIGINT (Ctrl+C) or SIGTERM (docker stop, Cloud Run)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		log.Println("Starting Gin server on port " + port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server error: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	stop() // Second signal kills process immediately
+	log.Println("Shutting down server...")
+
+	// Finish in-flight requests first (they may register jobs), then running jobs
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Server shutdown error: %v", err)
+	}
+	if err := jobRunner.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Job runner shutdown error: %v", err)
+	}
+	if err := database.GetDB().Close(); err != nil {
+		log.Printf("Database close error: %v", err)
+	}
+	log.Println("Server stopped")
 }
 
 // Function to run migrations
@@ -0,0 +1,16 @@
+INSERT INTO categories (id, parent_id, name, slug, sort_order) VALUES
+(1, NULL, 'Outdoor Gear', 'outdoor-gear', 1),
+(2, NULL, 'Apparel', 'apparel', 2),
+(3, 2, 'Men''s Apparel', 'mens-apparel', 1),
+(4, 2, 'Women''s Apparel', 'womens-apparel', 2),
+(5, 2, 'Kids'' Apparel', 'kids-apparel', 3);
+
+-- Map seed products to their leaf categories
+INSERT INTO product_categories (product_id, category_id)
+SELECT id, 1 FROM products WHERE id BETWEEN 1 AND 20;
+INSERT INTO product_categories (product_id, category_id)
+SELECT id, 3 FROM products WHERE id BETWEEN 21 AND 25;
+INSERT INTO product_categories (product_id, category_id)
+SELECT id, 4 FROM products WHERE id BETWEEN 26 AND 30;
+INSERT INTO product_categories (product_id, category_id)
+SELECT id, 5 FROM products WHERE id BETWEEN 31 AND 35;
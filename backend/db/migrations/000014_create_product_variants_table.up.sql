@@ -0,0 +1,22 @@
+CREATE TABLE product_variants (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  product_id INT NOT NULL,
+  sku VARCHAR(64) NOT NULL UNIQUE,
+  size VARCHAR(50) NULL,
+  color VARCHAR(50) NULL,
+  price INT NULL,
+  stock INT NOT NULL DEFAULT 0,
+  image_url VARCHAR(255),
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  -- NULL options are compared as empty strings (NULLs are distinct in a unique key)
+  size_key VARCHAR(50) AS (COALESCE(size, '')) VIRTUAL,
+  color_key VARCHAR(50) AS (COALESCE(color, '')) VIRTUAL,
+  UNIQUE KEY unique_product_options (product_id, size_key, color_key),
+  CONSTRAINT fk_product_variants_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+ALTER TABLE order_items
+  ADD COLUMN variant_id INT NULL AFTER product_id,
+  ADD COLUMN sku VARCHAR(64) NULL AFTER variant_id,
+  ADD CONSTRAINT fk_order_items_variant FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE RESTRICT;
@@ -0,0 +1,8 @@
+-- Split stock of seed apparel products (21-35) into S/M/L size variants
+-- The variant stocks add up to the existing products.stock value
+INSERT INTO product_variants (product_id, sku, size, stock)
+SELECT id, CONCAT('GT-', LPAD(id, 3, '0'), '-S'), 'S', FLOOR(stock / 3) FROM products WHERE id BETWEEN 21 AND 35;
+INSERT INTO product_variants (product_id, sku, size, stock)
+SELECT id, CONCAT('GT-', LPAD(id, 3, '0'), '-M'), 'M', FLOOR(stock / 3) FROM products WHERE id BETWEEN 21 AND 35;
+INSERT INTO product_variants (product_id, sku, size, stock)
+SELECT id, CONCAT('GT-', LPAD(id, 3, '0'), '-L'), 'L', stock - 2 * FLOOR(stock / 3) FROM products WHERE id BETWEEN 21 AND 35;
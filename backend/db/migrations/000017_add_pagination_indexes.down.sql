@@ -0,0 +1,9 @@
+ALTER TABLE orders DROP INDEX idx_orders_user_created_at;
+
+ALTER TABLE reviews DROP INDEX idx_reviews_product_created_at;
+
+ALTER TABLE products
+  DROP INDEX idx_products_name,
+  DROP INDEX idx_products_price,
+  DROP INDEX idx_products_sales_count,
+  DROP INDEX idx_products_created_at;
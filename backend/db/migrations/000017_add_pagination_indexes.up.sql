@@ -0,0 +1,10 @@
+-- Indexes supporting keyset (cursor) pagination
+ALTER TABLE products
+  ADD INDEX idx_products_created_at (created_at, id),
+  ADD INDEX idx_products_price (price, id),
+  ADD INDEX idx_products_sales_count (sales_count, id),
+  ADD INDEX idx_products_name (name, id);
+
+ALTER TABLE reviews ADD INDEX idx_reviews_product_created_at (product_id, created_at, id);
+
+ALTER TABLE orders ADD INDEX idx_orders_user_created_at (user_id, created_at, id);
@@ -0,0 +1,17 @@
+CREATE TABLE stock_reservations (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  order_id INT NOT NULL,
+  product_id INT NOT NULL,
+  variant_id INT NULL,
+  quantity INT NOT NULL,
+  status ENUM('active', 'converted', 'released') NOT NULL DEFAULT 'active',
+  expires_at DATETIME NOT NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_stock_reservations_product (product_id, status, expires_at),
+  INDEX idx_stock_reservations_variant (variant_id, status, expires_at),
+  INDEX idx_stock_reservations_expiry (status, expires_at),
+  CONSTRAINT fk_stock_reservations_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE,
+  CONSTRAINT fk_stock_reservations_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE,
+  CONSTRAINT fk_stock_reservations_variant FOREIGN KEY (variant_id) REFERENCES product_variants(id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS order_refund_items;
+DROP TABLE IF EXISTS order_refunds;
+
+ALTER TABLE orders
+  DROP INDEX idx_orders_stripe_payment_intent,
+  DROP INDEX unique_orders_stripe_session,
+  DROP COLUMN stripe_payment_intent_id,
+  DROP COLUMN stripe_session_id,
+  DROP COLUMN refunded_amount;
@@ -0,0 +1,27 @@
+ALTER TABLE orders
+  ADD COLUMN refunded_amount INT NOT NULL DEFAULT 0 AFTER total_price,
+  ADD COLUMN stripe_session_id VARCHAR(255) NULL AFTER shipping_address,
+  ADD COLUMN stripe_payment_intent_id VARCHAR(255) NULL AFTER stripe_session_id,
+  ADD UNIQUE KEY unique_orders_stripe_session (stripe_session_id),
+  ADD INDEX idx_orders_stripe_payment_intent (stripe_payment_intent_id);
+
+CREATE TABLE order_refunds (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  order_id INT NOT NULL,
+  stripe_refund_id VARCHAR(255) NULL UNIQUE,
+  amount INT NOT NULL,
+  status ENUM('pending', 'succeeded', 'failed', 'canceled') NOT NULL DEFAULT 'pending',
+  reason VARCHAR(50) NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  CONSTRAINT fk_order_refunds_order FOREIGN KEY (order_id) REFERENCES orders(id) ON DELETE CASCADE
+);
+
+CREATE TABLE order_refund_items (
+  refund_id INT NOT NULL,
+  order_item_id INT NOT NULL,
+  quantity INT NOT NULL,
+  PRIMARY KEY (refund_id, order_item_id),
+  CONSTRAINT fk_order_refund_items_refund FOREIGN KEY (refund_id) REFERENCES order_refunds(id) ON DELETE CASCADE,
+  CONSTRAINT fk_order_refund_items_item FOREIGN KEY (order_item_id) REFERENCES order_items(id) ON DELETE CASCADE
+);
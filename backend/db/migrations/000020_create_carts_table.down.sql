@@ -0,0 +1,6 @@
+ALTER TABLE orders
+  DROP FOREIGN KEY fk_orders_cart,
+  DROP COLUMN cart_id;
+
+DROP TABLE IF EXISTS cart_items;
+DROP TABLE IF EXISTS carts;
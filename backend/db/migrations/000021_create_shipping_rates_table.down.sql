@@ -0,0 +1,10 @@
+ALTER TABLE orders
+  DROP COLUMN shipping_cost;
+
+ALTER TABLE product_variants
+  DROP COLUMN weight_grams;
+
+ALTER TABLE products
+  DROP COLUMN weight_grams;
+
+DROP TABLE IF EXISTS shipping_rates;
@@ -0,0 +1,29 @@
+CREATE TABLE shipping_rates (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  country VARCHAR(2) NOT NULL DEFAULT '*',
+  region VARCHAR(100) NOT NULL DEFAULT '',
+  method ENUM('flat', 'weight', 'quantity') NOT NULL DEFAULT 'flat',
+  flat_fee INT NOT NULL DEFAULT 0,
+  brackets JSON NULL,
+  free_threshold INT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_shipping_rates_destination (country, region)
+);
+
+ALTER TABLE products
+  ADD COLUMN weight_grams INT NOT NULL DEFAULT 0 AFTER stock;
+
+ALTER TABLE product_variants
+  ADD COLUMN weight_grams INT NULL AFTER stock;
+
+ALTER TABLE orders
+  ADD COLUMN shipping_cost INT NOT NULL DEFAULT 0 AFTER total_price;
+
+-- Existing orders were charged the flat fee (total minus items)
+UPDATE orders AS o
+SET o.shipping_cost = o.total_price - COALESCE((
+  SELECT SUM(oi.unit_price * oi.quantity) FROM order_items AS oi WHERE oi.order_id = o.id
+), 0);
@@ -0,0 +1,3 @@
+-- Default rate keeps the previous flat fee for every destination
+INSERT INTO shipping_rates (id, name, country, region, method, flat_fee, brackets, free_threshold) VALUES
+(1, 'Standard Shipping', '*', '', 'flat', 500, NULL, NULL);
@@ -0,0 +1,11 @@
+ALTER TABLE orders
+  DROP COLUMN shipping_phone,
+  DROP COLUMN shipping_line2,
+  DROP COLUMN shipping_line1,
+  DROP COLUMN shipping_city,
+  DROP COLUMN shipping_region,
+  DROP COLUMN shipping_country,
+  DROP COLUMN shipping_postal_code,
+  DROP COLUMN shipping_recipient;
+
+DROP TABLE IF EXISTS addresses;
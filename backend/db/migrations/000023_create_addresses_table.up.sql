@@ -0,0 +1,29 @@
+CREATE TABLE addresses (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id INT NOT NULL,
+  recipient VARCHAR(100) NOT NULL,
+  postal_code VARCHAR(20) NOT NULL,
+  country CHAR(2) NOT NULL,
+  region VARCHAR(100) NOT NULL,
+  city VARCHAR(100) NOT NULL,
+  line1 VARCHAR(255) NOT NULL,
+  line2 VARCHAR(255) NULL,
+  phone VARCHAR(30) NOT NULL,
+  is_default BOOLEAN NOT NULL DEFAULT FALSE,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_addresses_user (user_id, is_default),
+  CONSTRAINT fk_addresses_user FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- Snapshot of address used for order (NULL for orders placed with free-form address)
+-- shipping_address keeps formatted text for display
+ALTER TABLE orders
+  ADD COLUMN shipping_recipient VARCHAR(100) NULL AFTER shipping_address,
+  ADD COLUMN shipping_postal_code VARCHAR(20) NULL AFTER shipping_recipient,
+  ADD COLUMN shipping_country CHAR(2) NULL AFTER shipping_postal_code,
+  ADD COLUMN shipping_region VARCHAR(100) NULL AFTER shipping_country,
+  ADD COLUMN shipping_city VARCHAR(100) NULL AFTER shipping_region,
+  ADD COLUMN shipping_line1 VARCHAR(255) NULL AFTER shipping_city,
+  ADD COLUMN shipping_line2 VARCHAR(255) NULL AFTER shipping_line1,
+  ADD COLUMN shipping_phone VARCHAR(30) NULL AFTER shipping_line2;
@@ -0,0 +1,9 @@
+ALTER TABLE orders
+  DROP FOREIGN KEY fk_orders_coupon,
+  DROP COLUMN coupon_code,
+  DROP COLUMN coupon_id,
+  DROP COLUMN discount_amount;
+
+DROP TABLE IF EXISTS coupon_categories;
+DROP TABLE IF EXISTS coupon_products;
+DROP TABLE IF EXISTS coupons;
@@ -0,0 +1,39 @@
+CREATE TABLE coupons (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  code VARCHAR(40) NOT NULL UNIQUE,
+  description VARCHAR(255) NOT NULL DEFAULT '',
+  discount_type ENUM('percentage', 'fixed') NOT NULL,
+  discount_value INT NOT NULL,
+  min_subtotal INT NOT NULL DEFAULT 0,
+  starts_at DATETIME NULL,
+  ends_at DATETIME NULL,
+  max_uses INT NULL,
+  max_uses_per_user INT NULL,
+  enabled BOOLEAN NOT NULL DEFAULT TRUE,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP
+);
+
+-- Products and categories a coupon is limited to (coupon applies to whole order if it has neither)
+CREATE TABLE coupon_products (
+  coupon_id INT NOT NULL,
+  product_id INT NOT NULL,
+  PRIMARY KEY (coupon_id, product_id),
+  CONSTRAINT fk_coupon_products_coupon FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE CASCADE,
+  CONSTRAINT fk_coupon_products_product FOREIGN KEY (product_id) REFERENCES products(id) ON DELETE CASCADE
+);
+
+CREATE TABLE coupon_categories (
+  coupon_id INT NOT NULL,
+  category_id INT NOT NULL,
+  PRIMARY KEY (coupon_id, category_id),
+  CONSTRAINT fk_coupon_categories_coupon FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE CASCADE,
+  CONSTRAINT fk_coupon_categories_category FOREIGN KEY (category_id) REFERENCES categories(id) ON DELETE CASCADE
+);
+
+-- Orders keep code and discount even if coupon is deleted later
+ALTER TABLE orders
+  ADD COLUMN discount_amount INT NOT NULL DEFAULT 0 AFTER shipping_cost,
+  ADD COLUMN coupon_id INT NULL AFTER discount_amount,
+  ADD COLUMN coupon_code VARCHAR(40) NULL AFTER coupon_id,
+  ADD CONSTRAINT fk_orders_coupon FOREIGN KEY (coupon_id) REFERENCES coupons(id) ON DELETE SET NULL;
@@ -0,0 +1,8 @@
+ALTER TABLE orders
+  DROP COLUMN tax_inclusive,
+  DROP COLUMN tax_amount;
+
+ALTER TABLE products
+  DROP COLUMN tax_class;
+
+DROP TABLE IF EXISTS tax_rates;
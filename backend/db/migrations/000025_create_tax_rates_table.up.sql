@@ -0,0 +1,19 @@
+CREATE TABLE tax_rates (
+  id INT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  name VARCHAR(100) NOT NULL,
+  country VARCHAR(2) NOT NULL DEFAULT '*',
+  region VARCHAR(100) NOT NULL DEFAULT '',
+  tax_class VARCHAR(50) NOT NULL DEFAULT 'standard',
+  basis_points INT NOT NULL, -- 1000 = 10%
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_tax_rates_destination (country, region, tax_class)
+);
+
+ALTER TABLE products
+  ADD COLUMN tax_class VARCHAR(50) NOT NULL DEFAULT 'standard' AFTER weight_grams;
+
+-- Orders record whether item prices included tax when they were placed
+ALTER TABLE orders
+  ADD COLUMN tax_amount INT NOT NULL DEFAULT 0 AFTER discount_amount,
+  ADD COLUMN tax_inclusive BOOLEAN NOT NULL DEFAULT TRUE AFTER tax_amount;
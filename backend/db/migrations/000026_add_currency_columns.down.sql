@@ -0,0 +1,5 @@
+ALTER TABLE orders
+  DROP COLUMN currency;
+
+ALTER TABLE products
+  DROP COLUMN currency;
@@ -0,0 +1,6 @@
+-- Amounts are in minor units of the currency (existing prices were charged in JPY, which has no minor unit)
+ALTER TABLE products
+  ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'JPY' AFTER price;
+
+ALTER TABLE orders
+  ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'JPY' AFTER total_price;
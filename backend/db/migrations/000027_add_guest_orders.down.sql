@@ -0,0 +1,7 @@
+-- Guest orders that were never claimed can't be kept without a user
+DELETE FROM orders WHERE user_id IS NULL;
+
+ALTER TABLE orders
+  DROP INDEX idx_orders_guest_email,
+  DROP COLUMN guest_email,
+  MODIFY COLUMN user_id INT NOT NULL;
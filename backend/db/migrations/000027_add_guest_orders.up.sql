@@ -0,0 +1,6 @@
+-- Guest orders have no user and are identified by email address instead
+-- (user_id is set when the guest registers with the same email address)
+ALTER TABLE orders
+  MODIFY COLUMN user_id INT NULL,
+  ADD COLUMN guest_email VARCHAR(255) NULL AFTER user_id,
+  ADD INDEX idx_orders_guest_email (guest_email);
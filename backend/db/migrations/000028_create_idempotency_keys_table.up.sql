@@ -0,0 +1,16 @@
+-- Responses of requests sent with Idempotency-Key header (replayed when client retries with the same key)
+-- Keys are scoped per user; user_id is 0 for anonymous visitors (guest checkout)
+CREATE TABLE idempotency_keys (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  user_id INT NOT NULL DEFAULT 0,
+  idempotency_key VARCHAR(255) NOT NULL,
+  request_hash CHAR(64) NOT NULL, -- SHA-256 of method, path and body of first request
+  status ENUM('processing', 'completed') NOT NULL DEFAULT 'processing',
+  response_status INT NULL,
+  response_content_type VARCHAR(255) NULL,
+  response_body MEDIUMBLOB NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  UNIQUE KEY unique_user_idempotency_key (user_id, idempotency_key),
+  INDEX idx_idempotency_keys_created (created_at)
+);
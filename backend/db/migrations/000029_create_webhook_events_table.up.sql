@@ -0,0 +1,14 @@
+-- Stripe webhook events as received (used to skip duplicate deliveries and to replay failed events)
+CREATE TABLE webhook_events (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  event_id VARCHAR(255) NOT NULL UNIQUE, -- Stripe event ID (evt_...)
+  event_type VARCHAR(100) NOT NULL,
+  payload JSON NOT NULL,
+  status ENUM('received', 'processing', 'processed', 'ignored', 'failed') NOT NULL DEFAULT 'received',
+  attempts INT NOT NULL DEFAULT 0,
+  last_error TEXT NULL,
+  processed_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_webhook_events_status (status, id)
+);
@@ -0,0 +1,17 @@
+-- Background jobs (side effects written in the same transaction as the change that needs them, run by workers with retry)
+CREATE TABLE jobs (
+  id BIGINT NOT NULL AUTO_INCREMENT PRIMARY KEY,
+  kind VARCHAR(100) NOT NULL, -- Name of registered job handler (e.g. delete_upload)
+  payload JSON NOT NULL,
+  status ENUM('pending', 'running', 'completed', 'dead') NOT NULL DEFAULT 'pending', -- dead: gave up after max_attempts
+  attempts INT NOT NULL DEFAULT 0,
+  max_attempts INT NOT NULL DEFAULT 8,
+  run_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, -- Not run before this time (pushed back on each retry)
+  locked_at DATETIME NULL, -- When worker claimed job (stale running jobs are claimed again)
+  last_error TEXT NULL,
+  completed_at DATETIME NULL,
+  created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP,
+  updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
+  INDEX idx_jobs_status_run_at (status, run_at),
+  INDEX idx_jobs_status_locked_at (status, locked_at)
+);
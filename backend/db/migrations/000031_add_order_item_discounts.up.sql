@@ -0,0 +1,3 @@
+-- Share of order's coupon discount allocated to each line (used for item refunds)
+ALTER TABLE order_items
+  ADD COLUMN discount_amount INT NOT NULL DEFAULT 0 AFTER unit_price;
@@ -0,0 +1,4 @@
+-- Share of order's tax allocated to each line (used for item refunds)
+-- Line amount paid is unit_price * quantity - discount_amount, plus tax_amount unless order tax is inclusive
+ALTER TABLE order_items
+  ADD COLUMN tax_amount INT NOT NULL DEFAULT 0 AFTER discount_amount;
@@ -9,11 +9,40 @@ SET FOREIGN_KEY_CHECKS=0;
 -- Order matters less with FOREIGN_KEY_CHECKS=0, but logical order is maintained
 
 -- Delete order-related data
+TRUNCATE TABLE order_refund_items;
+TRUNCATE TABLE order_refunds;
+TRUNCATE TABLE stock_reservations;
 TRUNCATE TABLE order_items;
 TRUNCATE TABLE orders;
 
+-- Delete coupon data
+TRUNCATE TABLE coupon_categories;
+TRUNCATE TABLE coupon_products;
+TRUNCATE TABLE coupons;
+
+-- Delete stored responses of idempotent requests
+TRUNCATE TABLE idempotency_keys;
+
+-- Delete webhook event log
+TRUNCATE TABLE webhook_events;
+
+-- Delete background jobs
+TRUNCATE TABLE jobs;
+
+-- Delete cart data
+TRUNCATE TABLE cart_items;
+TRUNCATE TABLE carts;
+
+-- Delete product variants
+TRUNCATE TABLE product_variants;
+
+-- Delete category-related data
+TRUNCATE TABLE product_categories;
+DELETE FROM categories;
+
 -- Delete user-related data
 TRUNCATE TABLE favorites;
+TRUNCATE TABLE addresses;
 TRUNCATE TABLE reviews;
 TRUNCATE TABLE inquiries;
 
@@ -35,3 +64,14 @@ SET FOREIGN_KEY_CHECKS=1;
 -- ALTER TABLE reviews AUTO_INCREMENT = 1;
 -- ALTER TABLE favorites AUTO_INCREMENT = 1;
 -- ALTER TABLE inquiries AUTO_INCREMENT = 1;
+-- ALTER TABLE categories AUTO_INCREMENT = 1;
+-- ALTER TABLE product_variants AUTO_INCREMENT = 1;
+-- ALTER TABLE stock_reservations AUTO_INCREMENT = 1;
+-- ALTER TABLE order_refunds AUTO_INCREMENT = 1;
+-- ALTER TABLE carts AUTO_INCREMENT = 1;
+-- ALTER TABLE cart_items AUTO_INCREMENT = 1;
+-- ALTER TABLE addresses AUTO_INCREMENT = 1;
+-- ALTER TABLE coupons AUTO_INCREMENT = 1;
+-- ALTER TABLE idempotency_keys AUTO_INCREMENT = 1;
+-- ALTER TABLE webhook_events AUTO_INCREMENT = 1;
+-- ALTER TABLE jobs AUTO_INCREMENT = 1;
@@ -0,0 +1,572 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Shipping address struct (used for address book entries, checkout and order snapshots)
+type ShippingAddress struct {
+	Recipient  string  `json:"recipient"`
+	PostalCode string  `json:"postalCode"`
+	Country    string  `json:"country"` // 2-letter country code (defaults to SHIPPING_DEFAULT_COUNTRY)
+	Region     string  `json:"region"`  // State, province or prefecture
+	City       string  `json:"city"`
+	Line1      string  `json:"line1"`
+	Line2      *string `json:"line2"` // Apartment, suite, etc. (optional)
+	Phone      string  `json:"phone"`
+}
+
+// Address book entry response struct
+type SavedAddress struct {
+	ID int64 `json:"id"`
+	ShippingAddress
+	IsDefault bool      `json:"isDefault"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// Address book entry create/update request struct
+type AddressRequest struct {
+	ShippingAddress
+	IsDefault bool `json:"isDefault"` // Make this the default address (first address always becomes default)
+}
+
+// Postal code formats of countries with well-known formats (other countries only get a loose check)
+var postalCodePatterns = map[string]*regexp.Regexp{
+	"US": regexp.MustCompile(`^\d{5}(-\d{4})?$`),
+	"CA": regexp.MustCompile(`^[A-Z]\d[A-Z] ?\d[A-Z]\d$`),
+	"JP": regexp.MustCompile(`^\d{3}-?\d{4}$`),
+	"GB": regexp.MustCompile(`^[A-Z]{1,2}\d[A-Z\d]? ?\d[A-Z]{2}$`),
+	"AU": regexp.MustCompile(`^\d{4}$`),
+	"DE": regexp.MustCompile(`^\d{5}$`),
+	"FR": regexp.MustCompile(`^\d{5}$`),
+}
+var genericPostalCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9 -]{1,9}$`)
+
+// Phone number pattern (digits with optional leading + and common separators)
+var phonePattern = regexp.MustCompile(`^\+?[0-9][0-9 ()-]{6,19}$`)
+
+// Columns of order address snapshot (same order as addressSnapshot.scanTargets())
+const addressSnapshotColumns = `shipping_recipient, shipping_postal_code, shipping_country, shipping_region,
+	shipping_city, shipping_line1, shipping_line2, shipping_phone`
+
+// Order address snapshot record struct (columns are NULL for orders placed with free-form address)
+type addressSnapshot struct {
+	Recipient, PostalCode, Country, Region, City, Line1, Line2, Phone sql.NullString
+}
+
+// Function to get scan destinations in addressSnapshotColumns order
+func (s *addressSnapshot) scanTargets() []interface{} {
+	return []interface{}{&s.Recipient, &s.PostalCode, &s.Country, &s.Region, &s.City, &s.Line1, &s.Line2, &s.Phone}
+}
+
+// Function to convert snapshot to address (nil for orders without snapshot)
+func (s *addressSnapshot) toAddress() *ShippingAddress {
+	if !s.Recipient.Valid {
+		return nil
+	}
+	a := &ShippingAddress{
+		Recipient:  s.Recipient.String,
+		PostalCode: s.PostalCode.String,
+		Country:    s.Country.String,
+		Region:     s.Region.String,
+		City:       s.City.String,
+		Line1:      s.Line1.String,
+		Phone:      s.Phone.String,
+	}
+	if s.Line2.Valid {
+		a.Line2 = &s.Line2.String
+	}
+	return a
+}
+
+// Function to normalize address fields and validate them
+// Returns error message for client if validation fails
+func (a *ShippingAddress) normalize() string {
+	a.Recipient = strings.TrimSpace(a.Recipient)
+	a.Country = strings.ToUpper(strings.TrimSpace(a.Country))
+	if a.Country == "" {
+		a.Country = DefaultShippingCountry // Defined in shipping.go file
+	}
+	a.PostalCode = strings.ToUpper(strings.TrimSpace(a.PostalCode))
+	a.Region = strings.TrimSpace(a.Region)
+	if a.Country == "US" || a.Country == "CA" {
+		a.Region = strings.ToUpper(a.Region) // State and province codes
+	}
+	a.City = strings.TrimSpace(a.City)
+	a.Line1 = strings.TrimSpace(a.Line1)
+	if a.Line2 != nil {
+		line2 := strings.TrimSpace(*a.Line2)
+		a.Line2 = &line2
+		if line2 == "" {
+			a.Line2 = nil
+		}
+	}
+	a.Phone = strings.TrimSpace(a.Phone)
+
+	// Required fields and maximum lengths (same as addresses table columns)
+	fields := []struct {
+		label string
+		value string
+		max   int
+	}{
+		{"Recipient", a.Recipient, 100},
+		{"Postal code", a.PostalCode, 20},
+		{"Region", a.Region, 100},
+		{"City", a.City, 100},
+		{"Address line 1", a.Line1, 255},
+		{"Phone number", a.Phone, 30},
+	}
+	for _, f := range fields {
+		if f.value == "" {
+			return fmt.Sprintf("%s is required", f.label)
+		}
+		if len([]rune(f.value)) > f.max {
+			return fmt.Sprintf("%s must be %d characters or less", f.label, f.max)
+		}
+	}
+	if a.Line2 != nil && len([]rune(*a.Line2)) > 255 {
+		return "Address line 2 must be 255 characters or less"
+	}
+
+	if !shipping.ValidCountry(a.Country) {
+		return "Country must be a 2-letter country code"
+	}
+	pattern, ok := postalCodePatterns[a.Country]
+	if !ok {
+		pattern = genericPostalCodePattern
+	}
+	if !pattern.MatchString(a.PostalCode) {
+		return "Please enter a valid postal code"
+	}
+	if !phonePattern.MatchString(a.Phone) {
+		return "Please enter a valid phone number"
+	}
+	return ""
+}
+
+// Function to get shipping destination of address (used to select shipping rate)
+func (a ShippingAddress) destination() shipping.Destination {
+	return shipping.NewDestination(a.Country, a.Region)
+}
+
+// Function to format address as text (stored in orders.shipping_address for display)
+func (a ShippingAddress) format() string {
+	lines := []string{a.Recipient, a.Line1}
+	if a.Line2 != nil {
+		lines = append(lines, *a.Line2)
+	}
+	lines = append(lines,
+		fmt.Sprintf("%s, %s %s", a.City, a.Region, a.PostalCode),
+		a.Country,
+		"Phone: "+a.Phone,
+	)
+	return strings.Join(lines, "\n")
+}
+
+// Function to lock user row while address book is changed
+// (Keeps exactly one default address when requests of same user run concurrently)
+func lockAddressBook(tx *sql.Tx, userID int) error {
+	var id int
+	return tx.QueryRow("SELECT id FROM users WHERE id = ? FOR UPDATE", userID).Scan(&id)
+}
+
+// Function to get address book entry of user
+// Returns sql.ErrNoRows if address doesn't exist or belongs to another user
+func getSavedAddress(q sqlQueryer, userID int, addressID int64) (SavedAddress, error) {
+	var a SavedAddress
+	var line2 sql.NullString
+	err := q.QueryRow(`
+		SELECT id, recipient, postal_code, country, region, city, line1, line2, phone, is_default, created_at, updated_at
+		FROM addresses
+		WHERE id = ? AND user_id = ?
+	`, addressID, userID).Scan(
+		&a.ID, &a.Recipient, &a.PostalCode, &a.Country, &a.Region, &a.City, &a.Line1, &line2, &a.Phone,
+		&a.IsDefault, &a.CreatedAt, &a.UpdatedAt,
+	)
+	if line2.Valid {
+		a.Line2 = &line2.String
+	}
+	return a, err
+}
+
+// Function to add address to user's address book
+// Must be called after lockAddressBook(); first address of user always becomes default
+func insertSavedAddress(tx *sql.Tx, userID int, a ShippingAddress, isDefault bool) (int64, error) {
+	var count int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM addresses WHERE user_id = ?", userID).Scan(&count); err != nil {
+		return 0, err
+	}
+	isDefault = isDefault || count == 0
+
+	result, err := tx.Exec(`
+		INSERT INTO addresses (user_id, recipient, postal_code, country, region, city, line1, line2, phone)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
+	`, userID, a.Recipient, a.PostalCode, a.Country, a.Region, a.City, a.Line1, a.Line2, a.Phone)
+	if err != nil {
+		return 0, err
+	}
+	addressID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if isDefault {
+		if err := setDefaultAddress(tx, userID, addressID); err != nil {
+			return 0, err
+		}
+	}
+	return addressID, nil
+}
+
+// Function to make address the only default address of user
+func setDefaultAddress(tx *sql.Tx, userID int, addressID int64) error {
+	_, err := tx.Exec("UPDATE addresses SET is_default = (id = ?) WHERE user_id = ?", addressID, userID)
+	return err
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to list address book of logged-in user (GET /api/addresses)
+// Default address comes first
+func ListAddressesHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("ListAddressesHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	userID := claims.UserID
+
+	db := database.GetDB()
+	rows, err := db.Query(`
+		SELECT id, recipient, postal_code, country, region, city, line1, line2, phone, is_default, created_at, updated_at
+		FROM addresses
+		WHERE user_id = ?
+		ORDER BY is_default DESC, updated_at DESC, id DESC
+	`, userID)
+	if err != nil {
+		log.Printf("Address book retrieval error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer rows.Close()
+
+	addresses := []SavedAddress{}
+	for rows.Next() {
+		var a SavedAddress
+		var line2 sql.NullString
+		if err := rows.Scan(&a.ID, &a.Recipient, &a.PostalCode, &a.Country, &a.Region, &a.City, &a.Line1, &line2,
+			&a.Phone, &a.IsDefault, &a.CreatedAt, &a.UpdatedAt); err != nil {
+			log.Printf("Address book scan error (UserID=%d): %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if line2.Valid {
+			a.Line2 = &line2.String
+		}
+		addresses = append(addresses, a)
+	}
+	if err = rows.Err(); err != nil {
+		log.Printf("Row error during address book retrieval (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, addresses)
+}
+
+// Function to add address to address book (POST /api/addresses)
+func CreateAddressHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("CreateAddressHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	userID := claims.UserID
+
+	// Bind HTTP request body to AddressRequest struct and validate address
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Address request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+	if msg := req.normalize(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if err := lockAddressBook(tx, userID); err != nil {
+		log.Printf("Address book lock error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	addressID, err := insertSavedAddress(tx, userID, req.ShippingAddress, req.IsDefault)
+	if err != nil {
+		log.Printf("Address registration error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	address, err := getSavedAddress(db, userID, addressID)
+	if err != nil {
+		log.Printf("Address retrieval error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusCreated, address)
+}
+
+// Function to edit address book entry (PUT /api/addresses/:id)
+// Orders already placed keep their own snapshot of the address
+func UpdateAddressHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("UpdateAddressHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	userID := claims.UserID
+
+	addressID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	// Bind HTTP request body to AddressRequest struct and validate address
+	var req AddressRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Address request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+	if msg := req.normalize(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if err := lockAddressBook(tx, userID); err != nil {
+		log.Printf("Address book lock error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if _, err := getSavedAddress(tx, userID, addressID); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	} else if err != nil {
+		log.Printf("Address retrieval error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	a := req.ShippingAddress
+	_, err = tx.Exec(`
+		UPDATE addresses SET
+			recipient = ?, postal_code = ?, country = ?, region = ?, city = ?, line1 = ?, line2 = ?, phone = ?
+		WHERE id = ? AND user_id = ?
+	`, a.Recipient, a.PostalCode, a.Country, a.Region, a.City, a.Line1, a.Line2, a.Phone, addressID, userID)
+	if err != nil {
+		log.Printf("Address update error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+		return
+	}
+	// Default can be moved to this address, but not removed (another address must be made default instead)
+	if req.IsDefault {
+		if err := setDefaultAddress(tx, userID, addressID); err != nil {
+			log.Printf("Default address update error (ID=%d): %v", addressID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	address, err := getSavedAddress(db, userID, addressID)
+	if err != nil {
+		log.Printf("Address retrieval error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, address)
+}
+
+// Function to make address the default address (PUT /api/addresses/:id/default)
+func SetDefaultAddressHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("SetDefaultAddressHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	userID := claims.UserID
+
+	addressID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if err := lockAddressBook(tx, userID); err != nil {
+		log.Printf("Address book lock error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if _, err := getSavedAddress(tx, userID, addressID); errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	} else if err != nil {
+		log.Printf("Address retrieval error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if err := setDefaultAddress(tx, userID, addressID); err != nil {
+		log.Printf("Default address update error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Default address updated"})
+}
+
+// Function to delete address book entry (DELETE /api/addresses/:id)
+// If default address is deleted, most recently updated remaining address becomes default
+func DeleteAddressHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("DeleteAddressHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+	userID := claims.UserID
+
+	addressID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid address ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if err := lockAddressBook(tx, userID); err != nil {
+		log.Printf("Address book lock error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	address, err := getSavedAddress(tx, userID, addressID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Address retrieval error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM addresses WHERE id = ? AND user_id = ?", addressID, userID); err != nil {
+		log.Printf("Address deletion error (ID=%d): %v", addressID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+		return
+	}
+	if address.IsDefault {
+		_, err := tx.Exec(`
+			UPDATE addresses SET is_default = TRUE
+			WHERE user_id = ?
+			ORDER BY updated_at DESC, id DESC
+			LIMIT 1
+		`, userID)
+		if err != nil {
+			log.Printf("Default address promotion error (UserID=%d): %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete address"})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Address deleted"})
+}
@@ -0,0 +1,293 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Category create/update request struct
+type CategoryRequest struct {
+	Name      string `json:"name" binding:"required"`
+	Slug      string `json:"slug"`     // Generated from name if empty
+	ParentID  *int   `json:"parentId"` // null for top-level category
+	SortOrder int    `json:"sortOrder"`
+}
+
+// Product category assignment request struct
+type ProductCategoriesRequest struct {
+	CategoryIDs []int `json:"categoryIds"`
+}
+
+// Function to validate category request and normalize its slug
+// Returns error message for client if validation fails
+func validateCategoryRequest(db *sql.DB, req *CategoryRequest, categoryID int) (string, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		return "Category name is required", nil
+	}
+	if req.Slug == "" {
+		req.Slug = slugify(req.Name)
+	}
+	if !slugPattern.MatchString(req.Slug) {
+		return "Slug may only contain lowercase letters, digits and hyphens", nil
+	}
+
+	// Check for duplicate slug (excluding own category)
+	var count int
+	err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE slug = ? AND id != ?", req.Slug, categoryID).Scan(&count)
+	if err != nil {
+		return "", err
+	}
+	if count > 0 {
+		return "This slug is already in use", nil
+	}
+
+	if req.ParentID == nil {
+		return "", nil
+	}
+
+	// Check parent category exists and would not create a cycle
+	categories, err := loadCategories(db)
+	if err != nil {
+		return "", err
+	}
+	if findCategory(categories, strconv.Itoa(*req.ParentID)) == nil {
+		return "Parent category not found", nil
+	}
+	if categoryID != 0 {
+		for _, id := range descendantCategoryIDs(categories, categoryID) {
+			if id == *req.ParentID {
+				return "Category cannot be moved under itself or its descendants", nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to create new category (POST /api/categories)
+func AdminCreateCategoryHandler(c *gin.Context) {
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Category creation request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Validate input data
+	msg, err := validateCategoryRequest(db, &req, 0)
+	if err != nil {
+		log.Printf("Category validation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Register category in database
+	query := "INSERT INTO categories (parent_id, name, slug, sort_order) VALUES (?, ?, ?, ?)"
+	result, err := db.Exec(query, req.ParentID, req.Name, req.Slug, req.SortOrder)
+	if err != nil {
+		log.Printf("Category registration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	id, _ := result.LastInsertId()
+
+	// Return successful registration response
+	c.JSON(http.StatusCreated, gin.H{"message": "Category registered successfully", "id": id})
+}
+
+// Function to edit category (PUT /api/categories/:id)
+func AdminUpdateCategoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	var req CategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Category update request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Validate input data
+	msg, err := validateCategoryRequest(db, &req, id)
+	if err != nil {
+		log.Printf("Category validation error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Update database
+	query := "UPDATE categories SET parent_id = ?, name = ?, slug = ?, sort_order = ? WHERE id = ?"
+	result, err := db.Exec(query, req.ParentID, req.Name, req.Slug, req.SortOrder, id)
+	if err != nil {
+		log.Printf("Category update error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Check category existed (MySQL reports 0 affected rows for unchanged values, so confirm with SELECT)
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		var exists int
+		if err := db.QueryRow("SELECT COUNT(*) FROM categories WHERE id = ?", id).Scan(&exists); err != nil || exists == 0 {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Category updated successfully"})
+}
+
+// Function to delete category (DELETE /api/categories/:id)
+func AdminDeleteCategoryHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Categories with child categories cannot be deleted (child categories must be moved or deleted first)
+	var childCount int
+	err = db.QueryRow("SELECT COUNT(*) FROM categories WHERE parent_id = ?", id).Scan(&childCount)
+	if err != nil {
+		log.Printf("Child category check error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if childCount > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Category has child categories"})
+		return
+	}
+
+	// Delete from database (product assignments are removed by ON DELETE CASCADE)
+	result, err := db.Exec("DELETE FROM categories WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Category deletion error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	// Return successful deletion response
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// Function to replace categories assigned to product (PUT /api/products/:id/categories)
+func AdminSetProductCategoriesHandler(c *gin.Context) {
+	productID, err := GetProductIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidProductID})
+		return
+	}
+
+	var req ProductCategoriesRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Product categories request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check product exists
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM products WHERE id = ?", productID).Scan(&exists); err != nil {
+		log.Printf("Product check error (ID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+
+	// Remove duplicate IDs and check all categories exist
+	uniqueIDs := []interface{}{}
+	seen := map[int]bool{}
+	for _, id := range req.CategoryIDs {
+		if !seen[id] {
+			seen[id] = true
+			uniqueIDs = append(uniqueIDs, id)
+		}
+	}
+	if len(uniqueIDs) > 0 {
+		placeholders := strings.Repeat("?,", len(uniqueIDs)-1) + "?"
+		var found int
+		query := fmt.Sprintf("SELECT COUNT(*) FROM categories WHERE id IN (%s)", placeholders)
+		if err := db.QueryRow(query, uniqueIDs...).Scan(&found); err != nil {
+			log.Printf("Category check error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if found != len(uniqueIDs) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Some categories were not found"})
+			return
+		}
+	}
+
+	// Replace assignments in a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if _, err := tx.Exec("DELETE FROM product_categories WHERE product_id = ?", productID); err != nil {
+		log.Printf("Product categories deletion error (ID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	for _, categoryID := range uniqueIDs {
+		if _, err := tx.Exec("INSERT INTO product_categories (product_id, category_id) VALUES (?, ?)", productID, categoryID); err != nil {
+			log.Printf("Product categories registration error (ID=%d): %v", productID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Product categories updated successfully"})
+}
@@ -0,0 +1,433 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Order summary struct for admin order list
+type AdminOrderSummary struct {
+	ID            int           `json:"id"`
+	UserID        *int          `json:"userId"`       // Null for guest orders
+	CustomerName  string        `json:"customerName"` // "Guest" for guest orders
+	CustomerEmail string        `json:"customerEmail"`
+	TotalPrice    int           `json:"totalPrice"`
+	Currency      string        `json:"currency"`
+	Status        OrderStatus   `json:"status"`
+	PaymentStatus PaymentStatus `json:"paymentStatus"`
+	ItemCount     int           `json:"itemCount"` // Total quantity of all items
+	CreatedAt     time.Time     `json:"createdAt"`
+	UpdatedAt     time.Time     `json:"updatedAt"`
+}
+
+// Admin order list response struct
+type AdminOrdersPageData struct {
+	Orders     []AdminOrderSummary `json:"orders"`
+	Pagination *Pagination         `json:"pagination,omitempty"` // Page mode only (type defined in product.go file)
+	NextCursor *string             `json:"nextCursor,omitempty"` // Cursor mode only (omitted on last page)
+}
+
+// Customer information struct for admin order detail
+// (Guest orders have no ID, and email address given at checkout)
+type OrderCustomer struct {
+	ID    *int   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
+
+// Admin order detail response struct
+type AdminOrderDetail struct {
+	ID              int               `json:"id"`
+	Customer        OrderCustomer     `json:"customer"`
+	TotalPrice      int               `json:"totalPrice"`
+	Currency        string            `json:"currency"` // Amounts are in minor units of this currency
+	ShippingCost    int               `json:"shippingCost"`
+	Discount        int               `json:"discount"`   // Coupon discount on items
+	CouponCode      *string           `json:"couponCode"` // Null if no coupon was used
+	Tax             int               `json:"tax"`
+	TaxInclusive    bool              `json:"taxInclusive"` // Tax is part of item prices (otherwise added to total)
+	RefundedAmount  int               `json:"refundedAmount"`
+	Status          OrderStatus       `json:"status"`
+	PaymentStatus   PaymentStatus     `json:"paymentStatus"`
+	ShippingAddress string            `json:"shippingAddress"`
+	AddressDetail   *ShippingAddress  `json:"shippingAddressDetail"` // Null for orders placed with free-form address
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
+	Items           []OrderDetailItem `json:"items"`
+	Refunds         []OrderRefund     `json:"refunds"` // Type defined in refund.go file
+}
+
+// Order status change request struct
+type OrderStatusRequest struct {
+	Status OrderStatus `json:"status" binding:"required"`
+}
+
+// Order statuses admins can set directly (other statuses are set by payment and refund processing)
+var adminOrderStatusTargets = []OrderStatus{OrderStatusShipped, OrderStatusDelivered, OrderStatusCancelled}
+
+// Function to list statuses admin can move order to from current state
+func adminAllowedStatuses(state OrderState) []OrderStatus {
+	allowed := []OrderStatus{}
+	for _, target := range adminOrderStatusTargets {
+		if next, ok := adminNextState(state, target); ok && state.Transition(next) == nil {
+			allowed = append(allowed, next.Status)
+		}
+	}
+	return allowed
+}
+
+// Function to get next order state for status chosen by admin
+// Returns false if order can't be moved to target by status change alone
+// (paid orders are cancelled through refund, since payment has to be returned)
+func adminNextState(state OrderState, target OrderStatus) (OrderState, bool) {
+	next := OrderState{Status: target, PaymentStatus: state.PaymentStatus}
+	if target == OrderStatusCancelled && state.PaymentStatus != PaymentStatusUnpaid {
+		return next, false
+	}
+	return next, true
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to return list of all orders (GET /api/admin/orders)
+// Filters: ?status=X&paymentStatus=Y&from=YYYY-MM-DD&to=YYYY-MM-DD&customerId=N&customer=text
+func AdminListOrdersHandler(c *gin.Context) {
+	// Parse query parameters (invalid values are rejected with 400 naming the offending parameter)
+	params := newQueryParser(c)
+	list := params.listParams(20)
+	status, hasStatus := params.optionalEnum("status", orderStatusValues)
+	paymentStatus, hasPaymentStatus := params.optionalEnum("paymentStatus", paymentStatusValues)
+	from, hasFrom := params.optionalDate("from") // Orders placed on or after this date
+	to, hasTo := params.optionalDate("to")       // Orders placed on or before this date
+	customerID, hasCustomerID := params.optionalInt("customerId", 1, math.MaxInt32)
+	customer := c.Query("customer") // Partial match on customer name or email
+	if hasFrom && hasTo && to.Before(from) {
+		params.fail(&QueryParamError{Message: "to must not be earlier than from", Field: "to", Code: ParamCodeOutOfRange})
+	}
+
+	// Build search conditions (WHERE clause)
+	var conditions []sqlCondition
+	if hasStatus {
+		conditions = append(conditions, sqlCondition{Clause: "o.status = ?", Params: []interface{}{status}})
+	}
+	if hasPaymentStatus {
+		conditions = append(conditions, sqlCondition{Clause: "o.payment_status = ?", Params: []interface{}{paymentStatus}})
+	}
+	if hasFrom {
+		conditions = append(conditions, sqlCondition{Clause: "o.created_at >= ?", Params: []interface{}{from}})
+	}
+	if hasTo {
+		// Include whole day of "to" date
+		conditions = append(conditions, sqlCondition{Clause: "o.created_at < ?", Params: []interface{}{to.AddDate(0, 0, 1)}})
+	}
+	if hasCustomerID {
+		conditions = append(conditions, sqlCondition{Clause: "o.user_id = ?", Params: []interface{}{customerID}})
+	}
+	if customer != "" {
+		likeCustomer := "%" + customer + "%"
+		conditions = append(conditions, sqlCondition{Clause: "(u.name LIKE ? OR u.email LIKE ? OR o.guest_email LIKE ?)", Params: []interface{}{likeCustomer, likeCustomer, likeCustomer}})
+	}
+
+	// Build condition selecting rows after cursor position
+	listConditions := conditions
+	if list.Cursor != "" {
+		cursorCond, err := ordersOrder.after(list.Cursor) // Sort order defined in order.go file
+		if err != nil {
+			params.invalidCursor()
+		}
+		listConditions = append(append([]sqlCondition{}, conditions...), cursorCond)
+	}
+	if params.failed() {
+		return
+	}
+
+	whereClause, whereParams := buildWhereClause(conditions, "")
+	listWhereClause, listWhereParams := buildWhereClause(listConditions, "")
+	orderByClause, _ := ordersOrder.orderBy()
+	limitClause := "LIMIT ? OFFSET ?"
+	limitParams := []interface{}{list.PerPage, (list.Page - 1) * list.PerPage}
+	if list.CursorMode {
+		// Fetch one extra row to know whether a next page exists
+		limitClause = "LIMIT ?"
+		limitParams = []interface{}{list.Limit + 1}
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Get order list and total order count with concurrent processing
+	orders := []AdminOrderSummary{}
+	var lastKeys []interface{} // Sort key values of last order in response
+	rowCount := 0
+	var totalItems int
+	var ordersErr, countErr error
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+
+	// Goroutine 1: Get order list
+	go func() {
+		defer wg.Done()
+		query := fmt.Sprintf(`
+			SELECT
+				o.id, o.user_id, COALESCE(u.name, 'Guest'), COALESCE(u.email, o.guest_email), o.total_price, o.currency, o.status, o.payment_status,
+				(SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items AS oi WHERE oi.order_id = o.id) AS item_count,
+				o.created_at, o.updated_at
+			FROM orders AS o
+			LEFT JOIN users AS u ON o.user_id = u.id
+			%s
+			%s
+			%s
+		`, listWhereClause, orderByClause, limitClause)
+		rows, err := db.Query(query, append(listWhereParams, limitParams...)...)
+		if err != nil {
+			log.Printf("Admin order list retrieval error: %v", err)
+			ordersErr = err
+			return
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var o AdminOrderSummary
+			var userID sql.NullInt64
+			if err := rows.Scan(
+				&o.ID, &userID, &o.CustomerName, &o.CustomerEmail, &o.TotalPrice, &o.Currency, &o.Status, &o.PaymentStatus,
+				&o.ItemCount, &o.CreatedAt, &o.UpdatedAt,
+			); err != nil {
+				log.Printf("Admin order data scan error: %v", err)
+				ordersErr = err
+				return
+			}
+			if userID.Valid {
+				id := int(userID.Int64)
+				o.UserID = &id
+			}
+			rowCount++
+			// Extra row fetched in cursor mode only signals that a next page exists
+			if list.CursorMode && rowCount > list.Limit {
+				continue
+			}
+			orders = append(orders, o)
+			lastKeys = []interface{}{o.CreatedAt, int64(o.ID)}
+		}
+		ordersErr = rows.Err()
+	}()
+
+	if !list.CursorMode {
+		wg.Add(1)
+
+		// Goroutine 2: Get total order count (page mode only)
+		go func() {
+			defer wg.Done()
+			countQuery := fmt.Sprintf("SELECT COUNT(*) FROM orders AS o LEFT JOIN users AS u ON o.user_id = u.id %s", whereClause)
+			countErr = db.QueryRow(countQuery, whereParams...).Scan(&totalItems)
+			if countErr != nil {
+				log.Printf("Admin order count retrieval error: %v", countErr)
+			}
+		}()
+	}
+
+	// Wait for all goroutines to complete
+	wg.Wait()
+	if ordersErr != nil || countErr != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Assemble final response
+	response := AdminOrdersPageData{Orders: orders}
+	if list.CursorMode {
+		response.NextCursor = nextCursor(ordersOrder, rowCount, list.Limit, lastKeys)
+	} else {
+		response.Pagination = &Pagination{
+			CurrentPage: list.Page,
+			PerPage:     list.PerPage,
+			TotalItems:  totalItems,
+			TotalPages:  int(math.Ceil(float64(totalItems) / float64(list.PerPage))),
+		}
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, response)
+}
+
+// Function to return order detail with items and shipping address (GET /api/admin/orders/:id)
+func AdminGetOrderHandler(c *gin.Context) {
+	orderID, err := getOrderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	var order AdminOrderDetail
+	var customerID sql.NullInt64
+	var couponCode sql.NullString
+	var snapshot addressSnapshot // Type defined in address.go file
+	query := `
+		SELECT
+			o.id, u.id, COALESCE(u.name, 'Guest'), COALESCE(u.email, o.guest_email), o.total_price, o.currency, o.shipping_cost, o.discount_amount, o.coupon_code,
+			o.tax_amount, o.tax_inclusive, o.refunded_amount, o.status, o.payment_status,
+			o.shipping_address, o.created_at, o.updated_at, ` + addressSnapshotColumns + `
+		FROM orders AS o
+		LEFT JOIN users AS u ON o.user_id = u.id
+		WHERE o.id = ?
+	`
+	dest := []interface{}{
+		&order.ID, &customerID, &order.Customer.Name, &order.Customer.Email,
+		&order.TotalPrice, &order.Currency, &order.ShippingCost, &order.Discount, &couponCode, &order.Tax, &order.TaxInclusive, &order.RefundedAmount, &order.Status, &order.PaymentStatus,
+		&order.ShippingAddress, &order.CreatedAt, &order.UpdatedAt,
+	}
+	err = db.QueryRow(query, orderID).Scan(append(dest, snapshot.scanTargets()...)...)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Admin order retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if customerID.Valid {
+		id := int(customerID.Int64)
+		order.Customer.ID = &id
+	}
+	if couponCode.Valid {
+		order.CouponCode = &couponCode.String
+	}
+	order.AddressDetail = snapshot.toAddress()
+
+	order.Items, err = getOrderDetailItems(db, orderID)
+	if err != nil {
+		log.Printf("Admin order items retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	order.Refunds, err = getOrderRefunds(db, orderID) // Function defined in refund.go file
+	if err != nil {
+		log.Printf("Admin order refunds retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, order)
+}
+
+// Function to change order status (PUT /api/admin/orders/:id/status)
+// Admins can move orders to shipped, delivered or cancelled (unpaid orders only)
+func AdminUpdateOrderStatusHandler(c *gin.Context) {
+	orderID, err := getOrderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	var req OrderStatusRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+	validTarget := false
+	for _, target := range adminOrderStatusTargets {
+		if req.Status == target {
+			validTarget = true
+		}
+	}
+	if !validTarget {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":         fmt.Sprintf("Invalid status value: %s", req.Status),
+			"validStatuses": adminOrderStatusTargets,
+		})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Start transaction (order row is locked until status change is committed)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	_, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Order state retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Validate transition against order lifecycle
+	next, ok := adminNextState(state, req.Status)
+	if ok {
+		err = updateOrderState(tx, orderID, state, next)
+	}
+	var transitionErr *TransitionError
+	if !ok || errors.As(err, &transitionErr) {
+		c.JSON(http.StatusConflict, gin.H{
+			"error":           fmt.Sprintf("Cannot change order status from %s (payment %s) to %s", state.Status, state.PaymentStatus, req.Status),
+			"allowedStatuses": adminAllowedStatuses(state),
+		})
+		return
+	}
+	if err != nil {
+		log.Printf("Order status update error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if next.Status == OrderStatusCancelled {
+		// Expire Checkout session so customer can no longer pay for cancelled order
+		// (Session is expired by background job after commit; payment completed before that is refunded by webhook)
+		var sessionID sql.NullString
+		if err := tx.QueryRow("SELECT stripe_session_id FROM orders WHERE id = ?", orderID).Scan(&sessionID); err != nil {
+			log.Printf("Payment reference retrieval error (ID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if err := enqueueCheckoutCleanup(tx, orderID, sessionID.String, ""); err != nil { // Function defined in job.go file
+			log.Printf("Checkout session expiry job registration error (OrderID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+
+		// Release stock held for cancelled order
+		if _, err := releaseStockHolds(tx, orderID); err != nil { // Function defined in reservation.go file
+			log.Printf("Stock hold release error (OrderID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	log.Printf("Order status changed (ID=%d): %s → %s", orderID, state.Status, next.Status)
+	c.JSON(http.StatusOK, next)
+}
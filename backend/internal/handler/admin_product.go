@@ -15,6 +15,8 @@ import (
 	"github.com/gin-gonic/gin"
 
 	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/money"
+	"github.com/yukaty/go-trailhead/backend/internal/tax"
 )
 
 // --- Handler Definitions ---
@@ -24,8 +26,10 @@ func AdminCreateProductHandler(c *gin.Context) {
 	// Get form data
 	name := c.PostForm("name")
 	description := c.PostForm("description")
-	priceStr := c.PostForm("price")
+	priceStr := c.PostForm("price") // In major units of store currency (e.g. "12.50")
 	stockStr := c.PostForm("stock")
+	weightStr := strings.TrimSpace(c.PostForm("weight"))   // Shipping weight in grams (optional)
+	taxClass := tax.NormalizeClass(c.PostForm("taxClass")) // Defaults to standard class
 	isFeaturedStr := c.PostForm("isFeatured")
 
 	// Get image file
@@ -36,14 +40,17 @@ func AdminCreateProductHandler(c *gin.Context) {
 		return
 	}
 
+	// New products are priced in store currency
+	currency := StoreCurrency
+
 	// Validate input data
 	if name == "" {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Product name is required"})
 		return
 	}
-	price, err := strconv.Atoi(priceStr)
-	if err != nil || price < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be an integer of 0 or greater"})
+	price, err := currency.ParseAmount(priceStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be an amount of 0 or greater in %s", currency)})
 		return
 	}
 	stock, err := strconv.Atoi(stockStr)
@@ -51,6 +58,18 @@ func AdminCreateProductHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock must be an integer of 0 or greater"})
 		return
 	}
+	weight := 0
+	if weightStr != "" {
+		weight, err = strconv.Atoi(weightStr)
+		if err != nil || weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Weight must be an integer of 0 or greater"})
+			return
+		}
+	}
+	if !tax.ValidClass(taxClass) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class may only contain lowercase letters, digits, - and _"})
+		return
+	}
 
 	// Checkbox sends "on" when checked, empty string when unchecked
 	isFeatured := isFeaturedStr == "on"
@@ -87,10 +106,10 @@ func AdminCreateProductHandler(c *gin.Context) {
 	// Register product information in database
 	db := database.GetDB()
 	query := `
-		INSERT INTO products (name, description, price, stock, image_url, is_featured)
-		VALUES (?, ?, ?, ?, ?, ?)
+		INSERT INTO products (name, description, price, currency, stock, weight_grams, tax_class, image_url, is_featured)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	_, err = db.Exec(query, name, description, price, stock, fileName, isFeatured)
+	_, err = db.Exec(query, name, description, price, currency, stock, weight, taxClass, fileName, isFeatured)
 	if err != nil {
 		log.Printf("Product registration error: %v", err)
 		// Delete saved file
@@ -116,8 +135,11 @@ func AdminUpdateProductHandler(c *gin.Context) {
 
 	// Check if product exists and get existing image file name
 	var currentImageUrl sql.NullString
-	checkQuery := "SELECT image_url FROM products WHERE id = ?"
-	err = db.QueryRow(checkQuery, id).Scan(&currentImageUrl)
+	var weight int
+	var taxClass string
+	var currency money.Currency // Prices of existing products stay in their currency
+	checkQuery := "SELECT image_url, weight_grams, tax_class, currency FROM products WHERE id = ?"
+	err = db.QueryRow(checkQuery, id).Scan(&currentImageUrl, &weight, &taxClass, &currency)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			log.Printf("Product to update not found: ID=%d", id)
@@ -134,6 +156,10 @@ func AdminUpdateProductHandler(c *gin.Context) {
 	description := c.PostForm("description")
 	priceStr := c.PostForm("price")
 	stockStr := c.PostForm("stock")
+	weightStr := strings.TrimSpace(c.PostForm("weight")) // Empty keeps current weight
+	if taxClassStr := strings.TrimSpace(c.PostForm("taxClass")); taxClassStr != "" {
+		taxClass = tax.NormalizeClass(taxClassStr) // Empty keeps current tax class
+	}
 	isFeaturedStr := c.PostForm("isFeatured")
 
 	// Get image file
@@ -149,9 +175,9 @@ func AdminUpdateProductHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Product name is required"})
 		return
 	}
-	price, err := strconv.Atoi(priceStr)
-	if err != nil || price < 0 {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Price must be an integer of 0 or greater"})
+	price, err := currency.ParseAmount(priceStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Price must be an amount of 0 or greater in %s", currency)})
 		return
 	}
 	stock, err := strconv.Atoi(stockStr)
@@ -159,6 +185,17 @@ func AdminUpdateProductHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Stock must be an integer of 0 or greater"})
 		return
 	}
+	if weightStr != "" {
+		weight, err = strconv.Atoi(weightStr)
+		if err != nil || weight < 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Weight must be an integer of 0 or greater"})
+			return
+		}
+	}
+	if !tax.ValidClass(taxClass) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Tax class may only contain lowercase letters, digits, - and _"})
+		return
+	}
 
 	// Checkbox sends "on" when checked, empty string when unchecked
 	isFeatured := isFeaturedStr == "on"
@@ -203,41 +240,70 @@ func AdminUpdateProductHandler(c *gin.Context) {
 		imageUrlToSave = newFileName
 	}
 
+	removeNewFile := func() {
+		if newFileName != "" {
+			_ = os.Remove(filepath.Join("uploads", newFileName))
+		}
+	}
+
+	// Update product and register deletion of old image file in a transaction
+	// (old file is only deleted by background job if update is committed)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		removeNewFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
 	// Update database
 	updateQuery := `
 		UPDATE products SET
-			name = ?, description = ?, price = ?, stock = ?, image_url = ?, is_featured = ?
+			name = ?, description = ?, price = ?, stock = ?, weight_grams = ?, tax_class = ?, image_url = ?, is_featured = ?
 		WHERE id = ?
 	`
-	_, err = db.Exec(
+	_, err = tx.Exec(
 		updateQuery,
 		name,
 		description,
 		price,
 		stock,
+		weight,
+		taxClass,
 		sql.NullString{String: imageUrlToSave, Valid: imageUrlToSave != ""},
 		isFeatured,
 		id,
 	)
 	if err != nil {
 		log.Printf("Product update error (ID=%d): %v", id, err)
-		// Delete newly saved file
-		if newFileName != "" {
-			_ = os.Remove(filepath.Join("uploads", newFileName))
-		}
+		removeNewFile()
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 		return
 	}
 
-	// Delete old image file (if new file was saved and old file existed)
-	if newFileUploaded && oldFileName != "" && oldFileName != newFileName {
-		oldFilePath := filepath.Join("uploads", oldFileName)
-		log.Printf("Deleting old image file: %s", oldFilePath)
-		if err := os.Remove(oldFilePath); err != nil {
-			log.Printf("Old image file deletion error: %v", err)
+	// Delete old image file (if new file was saved and old file existed) (Function defined in job.go file)
+	if newFileUploaded && oldFileName != newFileName {
+		if err := enqueueDeleteUpload(tx, oldFileName); err != nil {
+			log.Printf("Old image deletion job registration error (ID=%d): %v", id, err)
+			removeNewFile()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		removeNewFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Stock of products with variants is managed per variant, so recalculate total from variants
+	if err := syncProductStockFromVariants(db, id); err != nil {
+		log.Printf("Product stock sync error (ID=%d): %v", id, err)
+	}
+
 	// Return successful update response
 	c.JSON(http.StatusOK, gin.H{"message": "Product updated successfully"})
 }
@@ -268,24 +334,71 @@ func AdminDeleteProductHandler(c *gin.Context) {
 		return
 	}
 
+	// Delete product and register deletion of image file in a transaction
+	// (file is only deleted by background job if product deletion is committed)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	// Get image file names of variants (variant rows are removed by ON DELETE CASCADE)
+	variantImages := []string{}
+	rows, err := tx.Query("SELECT image_url FROM product_variants WHERE product_id = ? AND image_url IS NOT NULL FOR UPDATE", id)
+	if err != nil {
+		log.Printf("Variant image retrieval error (ProductID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	for rows.Next() {
+		var imageURL string
+		if err := rows.Scan(&imageURL); err != nil {
+			rows.Close()
+			log.Printf("Variant image scan error (ProductID=%d): %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		variantImages = append(variantImages, imageURL)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		log.Printf("Variant image row error (ProductID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
 	// Delete from database
 	deleteQuery := "DELETE FROM products WHERE id = ?"
-	_, err = db.Exec(deleteQuery, id)
+	_, err = tx.Exec(deleteQuery, id)
 	if err != nil {
+		// Products and variants referenced by order items cannot be deleted (ON DELETE RESTRICT)
+		if isMySQLError(err, mysqlErrRowIsReferenced) { // Function defined in admin_variant.go file
+			c.JSON(http.StatusConflict, gin.H{"error": "Product cannot be deleted because it has been ordered"})
+			return
+		}
 		log.Printf("Product deletion error (ID=%d): %v", id, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 		return
 	}
 
-	// Delete image file (if it exists)
-	if imageUrlToDelete.Valid && imageUrlToDelete.String != "" {
-		filePath := filepath.Join("uploads", imageUrlToDelete.String)
-		log.Printf("Deleting associated image file: %s", filePath)
-		if err := os.Remove(filePath); err != nil {
-			log.Printf("Image file deletion error: %v", err)
+	// Delete image files of product and its variants (if they exist) (Function defined in job.go file)
+	// Jobs are registered in this transaction, so files are only deleted once product deletion is committed
+	for _, fileName := range append([]string{imageUrlToDelete.String}, variantImages...) {
+		if err := enqueueDeleteUpload(tx, fileName); err != nil {
+			log.Printf("Image deletion job registration error (ID=%d): %v", id, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
 		}
 	}
 
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
 	// Return successful deletion response
 	c.JSON(http.StatusOK, gin.H{"message": "Product deleted successfully"})
 }
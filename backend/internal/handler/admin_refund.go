@@ -0,0 +1,195 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Refund item request struct
+type RefundItemRequest struct {
+	OrderItemID int `json:"orderItemId" binding:"required"`
+	Quantity    int `json:"quantity" binding:"required,min=1"`
+}
+
+// Refund request struct
+// Empty request refunds everything not refunded yet
+type RefundRequest struct {
+	Items           []RefundItemRequest `json:"items"`           // Items to refund and restock
+	Amount          *int                `json:"amount"`          // Overrides amount calculated from items (amount only refund if no items)
+	IncludeShipping bool                `json:"includeShipping"` // Add shipping cost to amount calculated from items
+	Reason          string              `json:"reason"`          // duplicate, fraudulent or requested_by_customer (optional)
+}
+
+// Refund reasons accepted by Stripe
+var refundReasons = map[string]bool{"duplicate": true, "fraudulent": true, "requested_by_customer": true}
+
+// --- 2. Handler Definitions ---
+
+// Function to refund order through Stripe (POST /api/admin/orders/:id/refunds)
+// Supports full refunds (empty request) and partial refunds by items and/or amount
+func AdminCreateRefundHandler(c *gin.Context) {
+	orderID, err := getOrderIDFromParam(c) // Function defined in order.go file
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// Bind HTTP request body to RefundRequest struct (empty body means full refund)
+	var req RefundRequest
+	if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+		log.Printf("Refund request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+	if req.Reason != "" && !refundReasons[req.Reason] {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "reason must be duplicate, fraudulent or requested_by_customer"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Start transaction (order row is locked until refund is recorded)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	_, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Order state retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if state.PaymentStatus != PaymentStatusPaid && state.PaymentStatus != PaymentStatusRefunding {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only paid orders can be refunded (payment status: %s)", state.PaymentStatus)})
+		return
+	}
+
+	// Get Stripe payment reference
+	var paymentIntentID sql.NullString
+	if err := tx.QueryRow("SELECT stripe_payment_intent_id FROM orders WHERE id = ?", orderID).Scan(&paymentIntentID); err != nil {
+		log.Printf("Payment reference retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if !paymentIntentID.Valid || paymentIntentID.String == "" {
+		c.JSON(http.StatusConflict, gin.H{"error": "Order has no Stripe payment to refund"})
+		return
+	}
+
+	// Get items and amount that can still be refunded (Functions defined in refund.go file)
+	refundable, err := getRefundableItems(tx, orderID)
+	if err != nil {
+		log.Printf("Refundable items retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	refundableAmount, err := getRefundableAmount(tx, orderID)
+	if err != nil {
+		log.Printf("Refundable amount retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Build refund lines and amount
+	lines := []refundLine{}
+	amount := 0
+	if len(req.Items) == 0 && req.Amount == nil {
+		// Full refund: everything not refunded yet
+		if refundableAmount <= 0 {
+			c.JSON(http.StatusConflict, gin.H{"error": "Order has already been fully refunded"})
+			return
+		}
+		for _, item := range refundable {
+			if item.Remaining > 0 {
+				lines = append(lines, refundLine{OrderItemID: item.ID, Quantity: item.Remaining})
+			}
+		}
+		amount = refundableAmount
+	} else {
+		itemsTotal := 0
+		seen := map[int]bool{}
+		for _, reqItem := range req.Items {
+			item, ok := refundable[reqItem.OrderItemID]
+			if !ok || seen[reqItem.OrderItemID] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Invalid order item: %d", reqItem.OrderItemID)})
+				return
+			}
+			seen[reqItem.OrderItemID] = true
+			if reqItem.Quantity > item.Remaining {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Only %d of %s can be refunded", item.Remaining, item.ProductName)})
+				return
+			}
+			lines = append(lines, refundLine{OrderItemID: item.ID, Quantity: reqItem.Quantity})
+			itemsTotal += item.refundAmount(reqItem.Quantity) // Share of amount paid for line, with discount and tax
+		}
+
+		if req.Amount != nil {
+			amount = *req.Amount
+		} else {
+			amount = itemsTotal
+			if req.IncludeShipping {
+				var shipping int
+				err := tx.QueryRow("SELECT shipping_cost FROM orders WHERE id = ?", orderID).Scan(&shipping)
+				if err != nil {
+					log.Printf("Shipping cost retrieval error (ID=%d): %v", orderID, err)
+					c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+					return
+				}
+				amount += shipping
+			}
+		}
+	}
+	if amount <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Refund amount must be greater than 0"})
+		return
+	}
+	if amount > refundableAmount {
+		c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Refund amount exceeds refundable amount (%d)", refundableAmount)})
+		return
+	}
+
+	// Record refund as pending (Function defined in refund.go file)
+	refund, err := recordPendingRefund(tx, orderID, paymentIntentID.String, amount, lines, req.Reason)
+	if err != nil {
+		log.Printf("Refund registration error (OrderID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Commit transaction before calling payment provider (order row isn't locked during the request)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Create refund through payment provider (Function defined in refund.go file)
+	status, err := submitPaymentRefund(c.Request.Context(), db, refund)
+	if err != nil {
+		log.Printf("Refund creation error (OrderID=%d, RefundID=%d): %v", orderID, refund.ID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create refund"})
+		return
+	}
+
+	log.Printf("Refund created (OrderID=%d, RefundID=%d, Amount=%d, Status=%s)", orderID, refund.ID, amount, status)
+	c.JSON(http.StatusCreated, gin.H{"id": refund.ID, "amount": amount, "status": status})
+}
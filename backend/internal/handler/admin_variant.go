@@ -0,0 +1,441 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/money"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Variant form input struct (after validation)
+type variantInput struct {
+	SKU    string
+	Size   sql.NullString
+	Color  sql.NullString
+	Price  sql.NullInt64 // NULL means "use product price"
+	Stock  int
+	Weight sql.NullInt64 // Shipping weight in grams (NULL means "use product weight")
+}
+
+// MySQL error numbers handled explicitly
+const (
+	mysqlErrDuplicateEntry  = 1062 // Duplicate key violation
+	mysqlErrRowIsReferenced = 1451 // Row is referenced by foreign key
+)
+
+// Function to read and validate variant form data
+// Returns error message for client if validation fails
+// Price is entered in major units of product currency (e.g. "12.50")
+func bindVariantForm(c *gin.Context, currency money.Currency) (variantInput, string) {
+	var in variantInput
+	in.SKU = strings.TrimSpace(c.PostForm("sku"))
+	size := strings.TrimSpace(c.PostForm("size"))
+	color := strings.TrimSpace(c.PostForm("color"))
+	priceStr := strings.TrimSpace(c.PostForm("price"))
+	stockStr := c.PostForm("stock")
+	weightStr := strings.TrimSpace(c.PostForm("weight"))
+
+	if in.SKU == "" {
+		return in, "SKU is required"
+	}
+	if size == "" && color == "" {
+		return in, "Size or color is required"
+	}
+	in.Size = sql.NullString{String: size, Valid: size != ""}
+	in.Color = sql.NullString{String: color, Valid: color != ""}
+
+	// Empty price means the variant is sold at the product price
+	if priceStr != "" {
+		price, err := currency.ParseAmount(priceStr)
+		if err != nil {
+			return in, fmt.Sprintf("Price must be an amount of 0 or greater in %s", currency)
+		}
+		in.Price = sql.NullInt64{Int64: int64(price), Valid: true}
+	}
+
+	stock, err := strconv.Atoi(stockStr)
+	if err != nil || stock < 0 {
+		return in, "Stock must be an integer of 0 or greater"
+	}
+	in.Stock = stock
+
+	// Empty weight means the variant weighs the same as the product
+	if weightStr != "" {
+		weight, err := strconv.Atoi(weightStr)
+		if err != nil || weight < 0 {
+			return in, "Weight must be an integer of 0 or greater"
+		}
+		in.Weight = sql.NullInt64{Int64: int64(weight), Valid: true}
+	}
+	return in, ""
+}
+
+// Function to save uploaded variant image file (if any)
+// Returns saved file name, or empty string if no file was uploaded
+func saveVariantImage(c *gin.Context) (string, string) {
+	fileHeader, err := c.FormFile("imageFile")
+	if err != nil {
+		if err != http.ErrMissingFile {
+			log.Printf("Unexpected error during image file retrieval: %v", err)
+		}
+		return "", ""
+	}
+
+	// Validate file format
+	ext := strings.ToLower(filepath.Ext(fileHeader.Filename))
+	allowedExts := map[string]bool{".jpg": true, ".jpeg": true, ".png": true}
+	if !allowedExts[ext] {
+		return "", "Unsupported file format (jpg, jpeg, png only)"
+	}
+
+	// Generate unique file name (timestamp + random number + extension)
+	timestamp := time.Now().UnixNano() / int64(time.Millisecond)
+	random := rand.Intn(10000)
+	fileName := fmt.Sprintf("%d_%d%s", timestamp, random, ext)
+	savePath := filepath.Join("uploads", fileName)
+
+	if err := c.SaveUploadedFile(fileHeader, savePath); err != nil {
+		log.Printf("Variant image file save error: %v", err)
+		return "", "File upload failed"
+	}
+	log.Printf("Variant image file saved: %s", savePath)
+	return fileName, ""
+}
+
+// Function to check whether error is a MySQL error with given error number
+func isMySQLError(err error, number uint16) bool {
+	mysqlErr, ok := err.(*mysql.MySQLError)
+	return ok && mysqlErr.Number == number
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to return variants of product (GET /api/products/:id/variants)
+func GetProductVariantsHandler(c *gin.Context) {
+	productID, err := GetProductIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidProductID})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	var productPrice int
+	err = db.QueryRow("SELECT price FROM products WHERE id = ?", productID).Scan(&productPrice)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		} else {
+			log.Printf("Product retrieval error (ID=%d): %v", productID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		}
+		return
+	}
+
+	variants, err := getProductVariants(db, productID, productPrice)
+	if err != nil {
+		log.Printf("Variant list retrieval error (ProductID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, gin.H{
+		"options":  collectProductOptions(variants),
+		"variants": variants,
+	})
+}
+
+// Function to create product variant (POST /api/products/:id/variants)
+func AdminCreateVariantHandler(c *gin.Context) {
+	productID, err := GetProductIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidProductID})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check product exists and get its currency
+	var currency money.Currency
+	err = db.QueryRow("SELECT currency FROM products WHERE id = ?", productID).Scan(&currency)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Product not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Product check error (ID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Validate input data
+	in, msg := bindVariantForm(c, currency)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Save image file (optional)
+	fileName, msg := saveVariantImage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	removeSavedFile := func() {
+		if fileName != "" {
+			_ = os.Remove(filepath.Join("uploads", fileName))
+		}
+	}
+
+	// Register variant and update product stock total in a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		removeSavedFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	query := `
+		INSERT INTO product_variants (product_id, sku, size, color, price, stock, weight_grams, image_url)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+	`
+	result, err := tx.Exec(query, productID, in.SKU, in.Size, in.Color, in.Price, in.Stock, in.Weight,
+		sql.NullString{String: fileName, Valid: fileName != ""})
+	if err != nil {
+		removeSavedFile()
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A variant with this SKU or option combination already exists"})
+			return
+		}
+		log.Printf("Variant registration error (ProductID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	variantID, _ := result.LastInsertId()
+
+	if err := syncProductStockFromVariants(tx, productID); err != nil {
+		log.Printf("Product stock sync error (ProductID=%d): %v", productID, err)
+		removeSavedFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		removeSavedFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return successful registration response
+	c.JSON(http.StatusCreated, gin.H{"message": "Variant registered successfully", "id": variantID})
+}
+
+// Function to edit product variant (PUT /api/products/:id/variants/:variantId)
+func AdminUpdateVariantHandler(c *gin.Context) {
+	productID, err := GetProductIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidProductID})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check variant exists and get existing image file name and product currency
+	var currentImageUrl sql.NullString
+	var currency money.Currency
+	err = db.QueryRow(`
+		SELECT v.image_url, p.currency
+		FROM product_variants AS v
+		JOIN products AS p ON v.product_id = p.id
+		WHERE v.id = ? AND v.product_id = ?
+	`, variantID, productID).Scan(&currentImageUrl, &currency)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		} else {
+			log.Printf("Existing variant check error (ID=%d): %v", variantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		}
+		return
+	}
+
+	// Validate input data
+	in, msg := bindVariantForm(c, currency)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Save new image file (optional)
+	newFileName, msg := saveVariantImage(c)
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+	imageUrlToSave := currentImageUrl.String
+	if newFileName != "" {
+		imageUrlToSave = newFileName
+	}
+	removeNewFile := func() {
+		if newFileName != "" {
+			_ = os.Remove(filepath.Join("uploads", newFileName))
+		}
+	}
+
+	// Update variant and product stock total in a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		removeNewFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	query := `
+		UPDATE product_variants SET
+			sku = ?, size = ?, color = ?, price = ?, stock = ?, weight_grams = ?, image_url = ?
+		WHERE id = ? AND product_id = ?
+	`
+	_, err = tx.Exec(query, in.SKU, in.Size, in.Color, in.Price, in.Stock, in.Weight,
+		sql.NullString{String: imageUrlToSave, Valid: imageUrlToSave != ""}, variantID, productID)
+	if err != nil {
+		removeNewFile()
+		if isMySQLError(err, mysqlErrDuplicateEntry) {
+			c.JSON(http.StatusConflict, gin.H{"error": "A variant with this SKU or option combination already exists"})
+			return
+		}
+		log.Printf("Variant update error (ID=%d): %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if err := syncProductStockFromVariants(tx, productID); err != nil {
+		log.Printf("Product stock sync error (ProductID=%d): %v", productID, err)
+		removeNewFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Delete old image file after commit (if new file was saved and old file existed) (Function defined in job.go file)
+	if newFileName != "" {
+		if err := enqueueDeleteUpload(tx, currentImageUrl.String); err != nil {
+			log.Printf("Old variant image deletion job registration error (ID=%d): %v", variantID, err)
+			removeNewFile()
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		removeNewFile()
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Variant updated successfully"})
+}
+
+// Function to delete product variant (DELETE /api/products/:id/variants/:variantId)
+func AdminDeleteVariantHandler(c *gin.Context) {
+	productID, err := GetProductIDFromParam(c, "id")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidProductID})
+		return
+	}
+	variantID, err := strconv.Atoi(c.Param("variantId"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid variant ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check variant exists and get existing image file name
+	var imageUrlToDelete sql.NullString
+	err = db.QueryRow("SELECT image_url FROM product_variants WHERE id = ? AND product_id = ?", variantID, productID).Scan(&imageUrlToDelete)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Variant not found"})
+		} else {
+			log.Printf("Existing variant check error (ID=%d): %v", variantID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		}
+		return
+	}
+
+	// Delete variant and update product stock total in a transaction
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	if _, err := tx.Exec("DELETE FROM product_variants WHERE id = ?", variantID); err != nil {
+		// Variants referenced by order items cannot be deleted (ON DELETE RESTRICT)
+		if isMySQLError(err, mysqlErrRowIsReferenced) {
+			c.JSON(http.StatusConflict, gin.H{"error": "Variant cannot be deleted because it has been ordered"})
+			return
+		}
+		log.Printf("Variant deletion error (ID=%d): %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if err := syncProductStockFromVariants(tx, productID); err != nil {
+		log.Printf("Product stock sync error (ProductID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if err := resetStockOfProductWithoutVariants(tx, productID); err != nil {
+		log.Printf("Product stock reset error (ProductID=%d): %v", productID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Delete image file after commit (if it exists) (Function defined in job.go file)
+	if err := enqueueDeleteUpload(tx, imageUrlToDelete.String); err != nil {
+		log.Printf("Variant image deletion job registration error (ID=%d): %v", variantID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return successful deletion response
+	c.JSON(http.StatusOK, gin.H{"message": "Variant deleted successfully"})
+}
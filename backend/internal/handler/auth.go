@@ -196,6 +196,9 @@ func LoginHandler(c *gin.Context) {
 		true,                // Set HttpOnly attribute to prevent JavaScript access
 	)
 
+	// Merge cart used before login into user's cart (Function defined in cart.go file)
+	mergeCartAtLogin(c, user.ID)
+
 	// Return successful login response
 	c.JSON(http.StatusOK, gin.H{
 		"message": "Login successful",
@@ -0,0 +1,571 @@
+package handler
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Cart item request struct
+type CartItemRequest struct {
+	ProductID int  `json:"productId" binding:"required"`
+	VariantID *int `json:"variantId"` // Required for products sold with variants
+	Quantity  int  `json:"quantity" binding:"required,min=1"`
+}
+
+// Cart update request struct (replaces all items of cart)
+type CartRequest struct {
+	Items []CartItemRequest `json:"items" binding:"dive"`
+}
+
+// Cart line response struct (re-validated against current product data on every read)
+type CartLine struct {
+	ID           int      `json:"id"`
+	ProductID    int      `json:"productId"`
+	VariantID    *int     `json:"variantId"`
+	SKU          *string  `json:"sku"`
+	ProductName  string   `json:"productName"`
+	VariantLabel string   `json:"variantLabel"` // e.g. "M / Navy" (empty for products without variants)
+	ImageURL     *string  `json:"imageUrl"`
+	Quantity     int      `json:"quantity"`
+	UnitPrice    int      `json:"unitPrice"`    // Current price
+	AddedPrice   int      `json:"addedPrice"`   // Price when item was put in cart
+	PriceChanged bool     `json:"priceChanged"` // UnitPrice differs from AddedPrice
+	Available    int      `json:"available"`    // Stock available for checkout (stock minus active holds)
+	Subtotal     int      `json:"subtotal"`     // UnitPrice × Quantity
+	Issues       []string `json:"issues"`       // Problems preventing checkout (empty if item can be ordered)
+}
+
+// Cart response struct
+type Cart struct {
+	ID            *int64     `json:"id"` // null until first item is stored
+	Items         []CartLine `json:"items"`
+	Subtotal      int        `json:"subtotal"`
+	Currency      string     `json:"currency"` // Store currency (prices are in its minor units)
+	TotalQuantity int        `json:"totalQuantity"`
+	Valid         bool       `json:"valid"` // true if every item can be checked out as is
+	UpdatedAt     *time.Time `json:"updatedAt"`
+}
+
+// Error returned for cart items that cannot be stored (message is shown to user)
+type cartItemError struct {
+	Message string
+}
+
+func (e *cartItemError) Error() string {
+	return e.Message
+}
+
+// Interface satisfied by both *sql.DB and *sql.Tx (for read queries)
+type sqlQueryer interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+// Cookie name for anonymous cart token
+const CartTokenCookieName = "cartToken"
+
+// Anonymous cart token lifetime (seconds)
+const cartTokenMaxAge = 30 * 24 * 60 * 60
+
+// Function to generate random anonymous cart token
+func newCartToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// Function to store anonymous cart token in cookie
+func setCartTokenCookie(c *gin.Context, token string, maxAge int) {
+	c.SetCookie(CartTokenCookieName, token, maxAge, "/", Domain, IsSecure, true)
+}
+
+// Function to get owner of request cart
+// Logged-in users own one cart across devices; anonymous visitors are identified by cart token cookie
+// Returns userID 0 for anonymous visitors and empty token if visitor has no cart yet
+func getCartOwner(c *gin.Context) (int, string) {
+	if claims, ok := GetUserFromContext(c); ok {
+		return claims.UserID, ""
+	}
+	token, err := c.Cookie(CartTokenCookieName)
+	if err != nil {
+		return 0, ""
+	}
+	return 0, token
+}
+
+// Function to find cart of owner
+// Returns sql.ErrNoRows if owner has no cart
+func findCartID(q sqlQueryer, userID int, token string) (int64, error) {
+	var cartID int64
+	var err error
+	if userID != 0 {
+		err = q.QueryRow("SELECT id FROM carts WHERE user_id = ?", userID).Scan(&cartID)
+	} else if token != "" {
+		err = q.QueryRow("SELECT id FROM carts WHERE token = ? AND user_id IS NULL", token).Scan(&cartID)
+	} else {
+		err = sql.ErrNoRows
+	}
+	return cartID, err
+}
+
+// Function to get cart of owner, creating it if it doesn't exist
+// Cart row stays locked until transaction ends (concurrent updates of same cart are serialized)
+func getOrCreateCart(tx *sql.Tx, userID int, token string) (int64, error) {
+	var result sql.Result
+	var err error
+	// LAST_INSERT_ID(id) returns existing cart ID when unique key already exists
+	if userID != 0 {
+		result, err = tx.Exec("INSERT INTO carts (user_id) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", userID)
+	} else {
+		result, err = tx.Exec("INSERT INTO carts (token) VALUES (?) ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)", token)
+	}
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Function to replace all items of cart
+// Items for the same product and variant are combined, and prices are recorded as seen by customer
+func replaceCartItems(tx *sql.Tx, cartID int64, items []CartItemRequest) error {
+	// Combine duplicate lines (keeping order of first appearance)
+	type cartKey struct {
+		ProductID int
+		VariantID int // 0 for products without variants
+	}
+	quantities := map[cartKey]int{}
+	merged := []CartItemRequest{}
+	for _, item := range items {
+		key := cartKey{ProductID: item.ProductID}
+		if item.VariantID != nil {
+			key.VariantID = *item.VariantID
+		}
+		if _, ok := quantities[key]; !ok {
+			merged = append(merged, item)
+		}
+		quantities[key] += item.Quantity
+	}
+
+	// Get current prices (products are also checked for existence and required options)
+	stmtProduct, err := tx.Prepare(`
+		SELECT p.name, p.price, EXISTS (SELECT 1 FROM product_variants AS v WHERE v.product_id = p.id)
+		FROM products AS p
+		WHERE p.id = ?
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmtProduct.Close()
+	stmtVariant, err := tx.Prepare("SELECT price FROM product_variants WHERE id = ? AND product_id = ?")
+	if err != nil {
+		return err
+	}
+	defer stmtVariant.Close()
+
+	type cartRow struct {
+		CartItemRequest
+		Price int
+	}
+	rows := []cartRow{}
+	for _, item := range merged {
+		var name string
+		var price int
+		var hasVariants bool
+		err := stmtProduct.QueryRow(item.ProductID).Scan(&name, &price, &hasVariants)
+		if errors.Is(err, sql.ErrNoRows) {
+			return &cartItemError{Message: fmt.Sprintf("Product not found: %d", item.ProductID)}
+		}
+		if err != nil {
+			return err
+		}
+
+		if item.VariantID == nil {
+			if hasVariants {
+				return &cartItemError{Message: fmt.Sprintf("Please select options for %s", name)}
+			}
+		} else {
+			var variantPrice sql.NullInt64
+			err := stmtVariant.QueryRow(*item.VariantID, item.ProductID).Scan(&variantPrice)
+			if errors.Is(err, sql.ErrNoRows) {
+				return &cartItemError{Message: fmt.Sprintf("Option not found for %s", name)}
+			}
+			if err != nil {
+				return err
+			}
+			if variantPrice.Valid {
+				price = int(variantPrice.Int64)
+			}
+		}
+
+		key := cartKey{ProductID: item.ProductID}
+		if item.VariantID != nil {
+			key.VariantID = *item.VariantID
+		}
+		item.Quantity = quantities[key]
+		rows = append(rows, cartRow{CartItemRequest: item, Price: price})
+	}
+
+	// Replace items
+	if _, err := tx.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID); err != nil {
+		return err
+	}
+	stmtInsert, err := tx.Prepare(`
+		INSERT INTO cart_items (cart_id, product_id, variant_id, quantity, added_price)
+		VALUES (?, ?, ?, ?, ?)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmtInsert.Close()
+	for _, row := range rows {
+		if _, err := stmtInsert.Exec(cartID, row.ProductID, row.VariantID, row.Quantity, row.Price); err != nil {
+			return err
+		}
+	}
+
+	// Touch cart so updated_at reflects latest change (even when items are unchanged)
+	_, err = tx.Exec("UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", cartID)
+	return err
+}
+
+// Function to get cart with items re-validated against current prices and stock
+func getCart(q sqlQueryer, cartID int64) (Cart, error) {
+	cart := Cart{ID: &cartID, Items: []CartLine{}, Currency: string(StoreCurrency), Valid: true}
+
+	var updatedAt time.Time
+	if err := q.QueryRow("SELECT updated_at FROM carts WHERE id = ?", cartID).Scan(&updatedAt); err != nil {
+		return cart, err
+	}
+	cart.UpdatedAt = &updatedAt
+
+	query := fmt.Sprintf(`
+		SELECT
+			ci.id, ci.product_id, ci.variant_id, v.sku, p.name, v.size, v.color,
+			COALESCE(v.image_url, p.image_url), ci.quantity, ci.added_price, COALESCE(v.price, p.price),
+			CASE WHEN ci.variant_id IS NULL
+				THEN p.stock - COALESCE((
+					SELECT SUM(r.quantity) FROM stock_reservations AS r
+					WHERE r.product_id = p.id AND r.variant_id IS NULL AND %[1]s
+				), 0)
+				ELSE v.stock - COALESCE((
+					SELECT SUM(r.quantity) FROM stock_reservations AS r
+					WHERE r.variant_id = v.id AND %[1]s
+				), 0)
+			END,
+			EXISTS (SELECT 1 FROM product_variants AS pv WHERE pv.product_id = p.id)
+		FROM cart_items AS ci
+		JOIN products AS p ON p.id = ci.product_id
+		LEFT JOIN product_variants AS v ON v.id = ci.variant_id
+		WHERE ci.cart_id = ?
+		ORDER BY ci.id
+	`, activeHoldCondition) // Condition defined in reservation.go file
+	rows, err := q.Query(query, cartID)
+	if err != nil {
+		return cart, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var line CartLine
+		var variantID sql.NullInt64
+		var sku, size, color, imageURL sql.NullString
+		var hasVariants bool
+		if err := rows.Scan(
+			&line.ID, &line.ProductID, &variantID, &sku, &line.ProductName, &size, &color,
+			&imageURL, &line.Quantity, &line.AddedPrice, &line.UnitPrice, &line.Available, &hasVariants,
+		); err != nil {
+			return cart, err
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			line.VariantID = &id
+		}
+		if sku.Valid {
+			line.SKU = &sku.String
+		}
+		if imageURL.Valid {
+			line.ImageURL = &imageURL.String
+		}
+		line.VariantLabel = variantLabel(size, color) // Function defined in variant.go file
+		if line.Available < 0 {
+			line.Available = 0
+		}
+		line.PriceChanged = line.UnitPrice != line.AddedPrice
+		line.Subtotal = line.UnitPrice * line.Quantity
+
+		// Re-validate item (product may have gained variants or sold out since it was added)
+		line.Issues = []string{}
+		if hasVariants && line.VariantID == nil {
+			line.Issues = append(line.Issues, "Please select options")
+		}
+		if line.Available == 0 {
+			line.Issues = append(line.Issues, "Out of stock")
+		} else if line.Quantity > line.Available {
+			line.Issues = append(line.Issues, fmt.Sprintf("Only %d left in stock", line.Available))
+		}
+		if len(line.Issues) > 0 {
+			cart.Valid = false
+		}
+
+		cart.Items = append(cart.Items, line)
+		cart.Subtotal += line.Subtotal
+		cart.TotalQuantity += line.Quantity
+	}
+	return cart, rows.Err()
+}
+
+// Function to get items of stored cart as checkout items
+// Owner is user or anonymous visitor with cart token (see getCartOwner())
+// Returns sql.ErrNoRows if cart doesn't exist or belongs to someone else
+func getCartCheckoutItems(q sqlQueryer, cartID int64, userID int, token string) ([]CartItem, error) {
+	ownerCartID, err := findCartID(q, userID, token)
+	if err != nil {
+		return nil, err
+	}
+	if ownerCartID != cartID {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := q.Query("SELECT product_id, variant_id, quantity FROM cart_items WHERE cart_id = ? ORDER BY id", cartID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []CartItem{}
+	for rows.Next() {
+		var productID int
+		var variantID sql.NullInt64
+		item := CartItem{}
+		if err := rows.Scan(&productID, &variantID, &item.Quantity); err != nil {
+			return nil, err
+		}
+		item.ID = strconv.Itoa(productID)
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			item.VariantID = &id
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Function to remove ordered items from cart the order was placed from (called when payment completes)
+// Items added to cart after checkout started are kept
+func clearOrderedCartItems(tx *sql.Tx, orderID int64) error {
+	_, err := tx.Exec(`
+		DELETE ci
+		FROM cart_items AS ci
+		JOIN orders AS o ON o.cart_id = ci.cart_id
+		JOIN order_items AS oi ON oi.order_id = o.id
+			AND oi.product_id = ci.product_id
+			AND oi.variant_id <=> ci.variant_id
+		WHERE o.id = ?
+	`, orderID)
+	return err
+}
+
+// Function to merge anonymous cart into user's cart (called at login)
+// Quantities of items in both carts are added up, and anonymous cart is deleted
+func mergeAnonymousCart(db *sql.DB, userID int, token string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	var anonymousID int64
+	err = tx.QueryRow("SELECT id FROM carts WHERE token = ? AND user_id IS NULL FOR UPDATE", token).Scan(&anonymousID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil // Nothing to merge (already merged or expired)
+	}
+	if err != nil {
+		return err
+	}
+
+	userCartID, err := getOrCreateCart(tx, userID, "")
+	if err != nil {
+		return err
+	}
+
+	// Add quantities of items already in user's cart, then move remaining items
+	mergeQueries := []string{
+		`UPDATE cart_items AS u
+		JOIN cart_items AS a ON a.product_id = u.product_id AND a.variant_id <=> u.variant_id
+		SET u.quantity = u.quantity + a.quantity
+		WHERE u.cart_id = ? AND a.cart_id = ?`,
+		`DELETE a
+		FROM cart_items AS a
+		JOIN cart_items AS u ON u.product_id = a.product_id AND u.variant_id <=> a.variant_id
+		WHERE u.cart_id = ? AND a.cart_id = ?`,
+		`UPDATE cart_items SET cart_id = ? WHERE cart_id = ?`,
+	}
+	for _, query := range mergeQueries {
+		if _, err := tx.Exec(query, userCartID, anonymousID); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM carts WHERE id = ?", anonymousID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE carts SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", userCartID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to get cart of logged-in user or anonymous visitor (GET /api/cart)
+func GetCartHandler(c *gin.Context) {
+	userID, token := getCartOwner(c)
+	db := database.GetDB()
+
+	cartID, err := findCartID(db, userID, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		// Visitor hasn't stored any items yet
+		c.JSON(http.StatusOK, Cart{Items: []CartLine{}, Currency: string(StoreCurrency), Valid: true})
+		return
+	}
+	if err != nil {
+		log.Printf("Cart retrieval error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	cart, err := getCart(db, cartID)
+	if err != nil {
+		log.Printf("Cart items retrieval error (ID=%d): %v", cartID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+// Function to replace items of cart (PUT /api/cart)
+// Anonymous visitors get a cart token cookie on first update
+func UpdateCartHandler(c *gin.Context) {
+	// Bind HTTP request body to CartRequest struct
+	var req CartRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Cart request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	userID, token := getCartOwner(c)
+	if userID == 0 && token == "" {
+		newToken, err := newCartToken()
+		if err != nil {
+			log.Printf("Cart token generation error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		token = newToken
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Start transaction (cart row is locked until items are replaced)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	cartID, err := getOrCreateCart(tx, userID, token)
+	if err != nil {
+		log.Printf("Cart creation error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	err = replaceCartItems(tx, cartID, req.Items)
+	var itemErr *cartItemError
+	if errors.As(err, &itemErr) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": itemErr.Message})
+		return
+	}
+	if err != nil {
+		log.Printf("Cart update error (ID=%d): %v", cartID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update cart"})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if userID == 0 {
+		setCartTokenCookie(c, token, cartTokenMaxAge) // Refresh expiry on every update
+	}
+
+	cart, err := getCart(db, cartID)
+	if err != nil {
+		log.Printf("Cart items retrieval error (ID=%d): %v", cartID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, cart)
+}
+
+// Function to remove all items from cart (DELETE /api/cart)
+func ClearCartHandler(c *gin.Context) {
+	userID, token := getCartOwner(c)
+	db := database.GetDB()
+
+	cartID, err := findCartID(db, userID, token)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+		return
+	}
+	if err != nil {
+		log.Printf("Cart retrieval error (UserID=%d): %v", userID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	if _, err := db.Exec("DELETE FROM cart_items WHERE cart_id = ?", cartID); err != nil {
+		log.Printf("Cart clear error (ID=%d): %v", cartID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear cart"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Cart cleared"})
+}
+
+// Function to merge anonymous cart of request into user's cart and forget cart token
+// (Called from LoginHandler; failures are logged but don't block login)
+func mergeCartAtLogin(c *gin.Context, userID int) {
+	token, err := c.Cookie(CartTokenCookieName)
+	if err != nil || strings.TrimSpace(token) == "" {
+		return
+	}
+	if err := mergeAnonymousCart(database.GetDB(), userID, token); err != nil {
+		log.Printf("Cart merge error (UserID=%d): %v", userID, err)
+		return
+	}
+	setCartTokenCookie(c, "", -1) // Anonymous cart no longer exists
+}
@@ -0,0 +1,248 @@
+package handler
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Category information struct
+type Category struct {
+	ID        int       `json:"id"`
+	ParentID  *int      `json:"parent_id"` // Nullable (NULL for top-level categories)
+	Name      string    `json:"name"`
+	Slug      string    `json:"slug"`
+	SortOrder int       `json:"sort_order"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Category tree node struct (category with nested child categories)
+type CategoryNode struct {
+	Category
+	Children []*CategoryNode `json:"children"`
+}
+
+// Category summary struct (embedded in product details)
+type CategorySummary struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+	Slug string `json:"slug"`
+}
+
+// Slug validation pattern (lowercase letters, digits and hyphens)
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(?:-[a-z0-9]+)*$`)
+
+// Pattern matching characters that are not allowed in a slug
+var nonSlugChars = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Function to generate URL-friendly slug from category name
+// (e.g. "Men's Apparel" -> "mens-apparel")
+func slugify(name string) string {
+	s := strings.ToLower(strings.TrimSpace(name))
+	s = strings.ReplaceAll(s, "'", "")
+	s = nonSlugChars.ReplaceAllString(s, "-")
+	return strings.Trim(s, "-")
+}
+
+// Function to load all categories sorted by display order
+func loadCategories(db *sql.DB) ([]Category, error) {
+	query := `
+		SELECT id, parent_id, name, slug, sort_order, created_at, updated_at
+		FROM categories
+		ORDER BY sort_order ASC, name ASC
+	`
+	rows, err := db.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var cat Category
+		var parentID sql.NullInt64
+		if err := rows.Scan(
+			&cat.ID, &parentID, &cat.Name, &cat.Slug, &cat.SortOrder, &cat.CreatedAt, &cat.UpdatedAt,
+		); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			pid := int(parentID.Int64)
+			cat.ParentID = &pid
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// Function to assemble flat category list into tree structure
+func buildCategoryTree(categories []Category) []*CategoryNode {
+	nodes := make(map[int]*CategoryNode, len(categories))
+	for _, cat := range categories {
+		nodes[cat.ID] = &CategoryNode{Category: cat, Children: []*CategoryNode{}}
+	}
+
+	// Attach each node to its parent (categories are already sorted, so order is preserved)
+	roots := []*CategoryNode{}
+	for _, cat := range categories {
+		node := nodes[cat.ID]
+		if cat.ParentID != nil {
+			if parent, ok := nodes[*cat.ParentID]; ok {
+				parent.Children = append(parent.Children, node)
+				continue
+			}
+		}
+		roots = append(roots, node)
+	}
+	return roots
+}
+
+// Function to collect category ID and all descendant category IDs
+func descendantCategoryIDs(categories []Category, rootID int) []int {
+	childrenMap := make(map[int][]int)
+	for _, cat := range categories {
+		if cat.ParentID != nil {
+			childrenMap[*cat.ParentID] = append(childrenMap[*cat.ParentID], cat.ID)
+		}
+	}
+
+	ids := []int{}
+	visited := map[int]bool{}
+	queue := []int{rootID}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		if visited[id] {
+			continue // Guard against cycles in corrupted data
+		}
+		visited[id] = true
+		ids = append(ids, id)
+		queue = append(queue, childrenMap[id]...)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// Function to find category by ID or slug
+// Returns nil if no category matches
+func findCategory(categories []Category, idOrSlug string) *Category {
+	id, err := strconv.Atoi(idOrSlug)
+	for i := range categories {
+		if (err == nil && categories[i].ID == id) || categories[i].Slug == idOrSlug {
+			return &categories[i]
+		}
+	}
+	return nil
+}
+
+// Function to resolve ?category= value (ID or slug) to IDs of the category and its descendants
+// Returns nil if no category matches
+func resolveCategoryFilter(db *sql.DB, idOrSlug string) ([]int, error) {
+	categories, err := loadCategories(db)
+	if err != nil {
+		return nil, err
+	}
+	cat := findCategory(categories, idOrSlug)
+	if cat == nil {
+		return nil, nil
+	}
+	return descendantCategoryIDs(categories, cat.ID), nil
+}
+
+// Function to get categories assigned to product
+func getProductCategories(db *sql.DB, productID int) ([]CategorySummary, error) {
+	query := `
+		SELECT c.id, c.name, c.slug
+		FROM product_categories AS pc
+		JOIN categories AS c ON pc.category_id = c.id
+		WHERE pc.product_id = ?
+		ORDER BY c.sort_order ASC, c.name ASC
+	`
+	rows, err := db.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	categories := []CategorySummary{}
+	for rows.Next() {
+		var cat CategorySummary
+		if err := rows.Scan(&cat.ID, &cat.Name, &cat.Slug); err != nil {
+			return nil, err
+		}
+		categories = append(categories, cat)
+	}
+	return categories, rows.Err()
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to return category tree (GET /api/categories)
+func ListCategoriesHandler(c *gin.Context) {
+	// Get database connection
+	db := database.GetDB()
+
+	categories, err := loadCategories(db)
+	if err != nil {
+		log.Printf("Category list retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, gin.H{"categories": buildCategoryTree(categories)})
+}
+
+// Function to return category details with its subtree (GET /api/categories/:id)
+// Accepts either numeric ID or slug
+func GetCategoryHandler(c *gin.Context) {
+	// Get database connection
+	db := database.GetDB()
+
+	categories, err := loadCategories(db)
+	if err != nil {
+		log.Printf("Category retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	cat := findCategory(categories, c.Param("id"))
+	if cat == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+		return
+	}
+
+	// Find node for requested category in assembled tree
+	var find func(nodes []*CategoryNode) *CategoryNode
+	find = func(nodes []*CategoryNode) *CategoryNode {
+		for _, node := range nodes {
+			if node.ID == cat.ID {
+				return node
+			}
+			if found := find(node.Children); found != nil {
+				return found
+			}
+		}
+		return nil
+	}
+	node := find(buildCategoryTree(categories))
+	if node == nil {
+		// Category is detached from tree (e.g. orphaned parent), return it without children
+		node = &CategoryNode{Category: *cat, Children: []*CategoryNode{}}
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, node)
+}
@@ -0,0 +1,208 @@
+package handler
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
+)
+
+// These tests run checkout against migrated development database (DB_DSN) with payment.Fake,
+// and are skipped when no database is available. Rows created by a test are deleted afterwards.
+
+const testWebhookSecret = "whsec_test"
+
+var initTestDB sync.Once
+
+// Function to connect to test database, or skip test without one
+func requireTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	dsn := os.Getenv("DB_DSN")
+	if dsn == "" {
+		t.Skip("DB_DSN is not set; skipping database test")
+	}
+	conn, err := sql.Open("mysql", dsn)
+	if err == nil {
+		err = conn.Ping()
+	}
+	if err != nil {
+		t.Skipf("database is not available: %v", err)
+	}
+	conn.Close()
+
+	initTestDB.Do(database.InitDB)
+	return database.GetDB()
+}
+
+// Function to build router with checkout and webhook routes, using fake payment provider
+func newCheckoutRouter(t *testing.T) (*gin.Engine, *payment.Fake) {
+	t.Helper()
+	fake := payment.NewFake(testWebhookSecret)
+	previous := Payments
+	Payments = fake
+	t.Cleanup(func() { Payments = previous })
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/orders/checkout", CreateCheckoutSessionHandler)
+	router.POST("/api/orders/webhook", StripeWebhookHandler)
+	return router, fake
+}
+
+// Function to insert product without variants for test (deleted with its orders after test)
+func insertTestProduct(t *testing.T, db *sql.DB, price int, stock int) int64 {
+	t.Helper()
+	result, err := db.Exec(`
+		INSERT INTO products (name, description, price, currency, stock, weight_grams, tax_class, image_url, is_featured)
+		VALUES (?, 'Checkout test product', ?, ?, ?, 0, 'standard', 'test.jpg', FALSE)
+	`, fmt.Sprintf("Checkout Test %d", time.Now().UnixNano()), price, StoreCurrency, stock)
+	if err != nil {
+		t.Fatalf("product insert: %v", err)
+	}
+	productID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("product ID: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Exec("DELETE FROM orders WHERE id IN (SELECT order_id FROM order_items WHERE product_id = ?)", productID)
+		db.Exec("DELETE FROM products WHERE id = ?", productID)
+	})
+	return productID
+}
+
+// Function to check out product as guest and return session created with fake provider
+func checkoutAsGuest(t *testing.T, router *gin.Engine, fake *payment.Fake, productID int64, quantity int) payment.FakeSession {
+	t.Helper()
+	body, _ := json.Marshal(CheckoutRequest{
+		Email: fmt.Sprintf("checkout-test-%d@example.com", time.Now().UnixNano()),
+		Items: []CartItem{{ID: strconv.FormatInt(productID, 10), Quantity: quantity}},
+		ShippingAddress: &ShippingAddress{
+			Recipient: "Test Customer", PostalCode: "100-0001", Country: "JP", Region: "Tokyo",
+			City: "Chiyoda", Line1: "1-1", Phone: "0300000000",
+		},
+	})
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders/checkout", bytes.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("checkout status = %d, body = %s", rec.Code, rec.Body.String())
+	}
+
+	sessions := fake.Sessions()
+	if len(sessions) != 1 {
+		t.Fatalf("fake has %d sessions, want 1", len(sessions))
+	}
+	return sessions[0]
+}
+
+// Function to deliver webhook event and return response status (event row is deleted after test)
+func deliverWebhook(t *testing.T, router *gin.Engine, db *sql.DB, event payment.SignedEvent) int {
+	t.Helper()
+	t.Cleanup(func() { db.Exec("DELETE FROM webhook_events WHERE event_id = ?", event.ID) })
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, event.Request("/api/orders/webhook"))
+	return rec.Code
+}
+
+// Function to get order state and payment reference
+func getTestOrder(t *testing.T, db *sql.DB, orderID string) (OrderState, sql.NullString) {
+	t.Helper()
+	var state OrderState
+	var paymentIntentID sql.NullString
+	err := db.QueryRow("SELECT status, payment_status, stripe_payment_intent_id FROM orders WHERE id = ?", orderID).
+		Scan(&state.Status, &state.PaymentStatus, &paymentIntentID)
+	if err != nil {
+		t.Fatalf("order retrieval: %v", err)
+	}
+	return state, paymentIntentID
+}
+
+func TestCheckoutCompletedByWebhook(t *testing.T) {
+	db := requireTestDB(t)
+	router, fake := newCheckoutRouter(t)
+	productID := insertTestProduct(t, db, 1200, 5)
+
+	session := checkoutAsGuest(t, router, fake, productID, 2)
+	orderID := session.Params.Metadata["orderId"]
+	if state, _ := getTestOrder(t, db, orderID); state != (OrderState{Status: OrderStatusPending, PaymentStatus: PaymentStatusUnpaid}) {
+		t.Fatalf("order after checkout = %+v, want pending/unpaid", state)
+	}
+
+	event, err := fake.CompleteSession(session.ID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := deliverWebhook(t, router, db, event); code != http.StatusOK {
+		t.Fatalf("webhook status = %d, want 200", code)
+	}
+
+	state, paymentIntentID := getTestOrder(t, db, orderID)
+	if state != (OrderState{Status: OrderStatusProcessing, PaymentStatus: PaymentStatusPaid}) {
+		t.Errorf("order after payment = %+v, want processing/paid", state)
+	}
+	if paymentIntentID.String != fake.Sessions()[0].PaymentIntentID {
+		t.Errorf("payment reference = %q, want %q", paymentIntentID.String, fake.Sessions()[0].PaymentIntentID)
+	}
+	var stock, activeHolds int
+	db.QueryRow("SELECT stock FROM products WHERE id = ?", productID).Scan(&stock)
+	db.QueryRow("SELECT COUNT(*) FROM stock_reservations WHERE order_id = ? AND status = ?", orderID, ReservationStatusActive).Scan(&activeHolds)
+	if stock != 3 || activeHolds != 0 {
+		t.Errorf("stock = %d with %d active holds, want 3 with none", stock, activeHolds)
+	}
+
+	// Redelivered event changes nothing
+	if code := deliverWebhook(t, router, db, event); code != http.StatusOK {
+		t.Errorf("redelivered webhook status = %d, want 200", code)
+	}
+	db.QueryRow("SELECT stock FROM products WHERE id = ?", productID).Scan(&stock)
+	if stock != 3 {
+		t.Errorf("stock after redelivery = %d, want 3", stock)
+	}
+}
+
+func TestCheckoutPaidAfterCancellationIsRefunded(t *testing.T) {
+	db := requireTestDB(t)
+	router, fake := newCheckoutRouter(t)
+	productID := insertTestProduct(t, db, 1500, 5)
+
+	session := checkoutAsGuest(t, router, fake, productID, 1)
+	orderID := session.Params.Metadata["orderId"]
+
+	// Order is cancelled while customer is still on payment page (cancellation racing with payment)
+	if _, err := db.Exec("UPDATE orders SET status = ?, payment_status = ? WHERE id = ?", OrderStatusCancelled, PaymentStatusUnpaid, orderID); err != nil {
+		t.Fatalf("order cancellation: %v", err)
+	}
+	event, err := fake.CompleteSession(session.ID)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	if code := deliverWebhook(t, router, db, event); code != http.StatusOK {
+		t.Fatalf("webhook status = %d, want 200", code)
+	}
+
+	refunds := fake.Refunds()
+	if len(refunds) != 1 || refunds[0].Params.PaymentIntentID != fake.Sessions()[0].PaymentIntentID {
+		t.Fatalf("refunds = %+v, want one refund of session payment", refunds)
+	}
+	var totalPrice int
+	db.QueryRow("SELECT total_price FROM orders WHERE id = ?", orderID).Scan(&totalPrice)
+	if refunds[0].Amount != int64(totalPrice) {
+		t.Errorf("refund amount = %d, want order total %d", refunds[0].Amount, totalPrice)
+	}
+	if state, _ := getTestOrder(t, db, orderID); state != (OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusRefunded}) {
+		t.Errorf("order after refund = %+v, want cancelled/refunded", state)
+	}
+}
@@ -0,0 +1,510 @@
+package handler
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/promotion"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Coupon response struct
+type CouponData struct {
+	ID             int            `json:"id"`
+	Code           string         `json:"code"`
+	Description    string         `json:"description"`
+	Type           promotion.Type `json:"type"`  // percentage or fixed
+	Value          int            `json:"value"` // Percent off, or amount off in minor units of store currency
+	MinSubtotal    int            `json:"minSubtotal"`
+	StartsAt       *time.Time     `json:"startsAt"`       // null for no start
+	EndsAt         *time.Time     `json:"endsAt"`         // null for no end
+	MaxUses        *int           `json:"maxUses"`        // null for unlimited
+	MaxUsesPerUser *int           `json:"maxUsesPerUser"` // null for unlimited
+	ProductIDs     []int          `json:"productIds"`     // Empty with categoryIds for whole order
+	CategoryIDs    []int          `json:"categoryIds"`    // Subcategories are included
+	Enabled        bool           `json:"enabled"`
+	UsedCount      int            `json:"usedCount"` // Orders that used coupon
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
+}
+
+// Coupon create/update request struct
+type CouponRequest struct {
+	Code           string         `json:"code" binding:"required"` // Stored in upper case
+	Description    string         `json:"description"`
+	Type           promotion.Type `json:"type" binding:"required"`
+	Value          int            `json:"value"`
+	MinSubtotal    int            `json:"minSubtotal"`
+	StartsAt       *time.Time     `json:"startsAt"`
+	EndsAt         *time.Time     `json:"endsAt"`
+	MaxUses        *int           `json:"maxUses"`
+	MaxUsesPerUser *int           `json:"maxUsesPerUser"`
+	ProductIDs     []int          `json:"productIds"`
+	CategoryIDs    []int          `json:"categoryIds"`
+	Enabled        *bool          `json:"enabled"` // Defaults to true
+}
+
+// Coupon applied in checkout
+type appliedCoupon struct {
+	Coupon        CouponData
+	Discount      int
+	LineDiscounts []int // Discount allocated to each order line (for tax calculation)
+}
+
+// Condition for orders that count as coupon uses
+// (Orders cancelled without payment, e.g. expired checkouts, give their use back)
+const couponUseCondition = "NOT (o.status = 'cancelled' AND o.payment_status IN ('unpaid', 'failed'))"
+
+// Function to convert coupon to coupon of promotion package
+func (cp CouponData) toCoupon() promotion.Coupon {
+	return promotion.Coupon{
+		ID:             cp.ID,
+		Code:           cp.Code,
+		Type:           cp.Type,
+		Value:          cp.Value,
+		MinSubtotal:    cp.MinSubtotal,
+		StartsAt:       cp.StartsAt,
+		EndsAt:         cp.EndsAt,
+		MaxUses:        cp.MaxUses,
+		MaxUsesPerUser: cp.MaxUsesPerUser,
+		ProductIDs:     cp.ProductIDs,
+		CategoryIDs:    cp.CategoryIDs,
+		Enabled:        cp.Enabled,
+	}
+}
+
+// Function to get coupons matching condition (with products and categories they are limited to)
+func getCoupons(q sqlQueryer, condition string, args ...interface{}) ([]CouponData, error) {
+	query := fmt.Sprintf(`
+		SELECT
+			cp.id, cp.code, cp.description, cp.discount_type, cp.discount_value, cp.min_subtotal,
+			cp.starts_at, cp.ends_at, cp.max_uses, cp.max_uses_per_user, cp.enabled, cp.created_at, cp.updated_at,
+			(SELECT COUNT(*) FROM orders AS o WHERE o.coupon_id = cp.id AND %s) AS used_count
+		FROM coupons AS cp
+		WHERE %s
+		ORDER BY cp.id DESC
+	`, couponUseCondition, condition)
+	rows, err := q.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []CouponData{}
+	index := map[int]int{} // Coupon ID to index in coupons
+	for rows.Next() {
+		var cp CouponData
+		var startsAt, endsAt sql.NullTime
+		var maxUses, maxUsesPerUser sql.NullInt64
+		if err := rows.Scan(&cp.ID, &cp.Code, &cp.Description, &cp.Type, &cp.Value, &cp.MinSubtotal,
+			&startsAt, &endsAt, &maxUses, &maxUsesPerUser, &cp.Enabled, &cp.CreatedAt, &cp.UpdatedAt, &cp.UsedCount); err != nil {
+			return nil, err
+		}
+		if startsAt.Valid {
+			cp.StartsAt = &startsAt.Time
+		}
+		if endsAt.Valid {
+			cp.EndsAt = &endsAt.Time
+		}
+		if maxUses.Valid {
+			limit := int(maxUses.Int64)
+			cp.MaxUses = &limit
+		}
+		if maxUsesPerUser.Valid {
+			limit := int(maxUsesPerUser.Int64)
+			cp.MaxUsesPerUser = &limit
+		}
+		cp.ProductIDs = []int{}
+		cp.CategoryIDs = []int{}
+		index[cp.ID] = len(coupons)
+		coupons = append(coupons, cp)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(coupons) == 0 {
+		return coupons, nil
+	}
+
+	// Get products and categories of coupons in one query
+	ids := []interface{}{}
+	for _, cp := range coupons {
+		ids = append(ids, cp.ID)
+	}
+	placeholders := strings.Repeat("?,", len(ids)-1) + "?"
+	scopeQuery := fmt.Sprintf(`
+		SELECT coupon_id, 'product', product_id FROM coupon_products WHERE coupon_id IN (%s)
+		UNION ALL
+		SELECT coupon_id, 'category', category_id FROM coupon_categories WHERE coupon_id IN (%s)
+		ORDER BY 1, 2, 3
+	`, placeholders, placeholders)
+	scopeRows, err := q.Query(scopeQuery, append(ids, ids...)...)
+	if err != nil {
+		return nil, err
+	}
+	defer scopeRows.Close()
+
+	for scopeRows.Next() {
+		var couponID, targetID int
+		var kind string
+		if err := scopeRows.Scan(&couponID, &kind, &targetID); err != nil {
+			return nil, err
+		}
+		cp := &coupons[index[couponID]]
+		if kind == "product" {
+			cp.ProductIDs = append(cp.ProductIDs, targetID)
+		} else {
+			cp.CategoryIDs = append(cp.CategoryIDs, targetID)
+		}
+	}
+	return coupons, scopeRows.Err()
+}
+
+// Function to apply coupon code to order lines in checkout transaction
+// Coupon row is locked, so concurrent checkouts can't exceed usage limits
+// Returns *promotion.IneligibleError if coupon can't be used for this order
+func applyCoupon(tx *sql.Tx, db *sql.DB, code string, customer checkoutCustomer, lines []orderLine) (appliedCoupon, error) {
+	var couponID int
+	err := tx.QueryRow("SELECT id FROM coupons WHERE code = ? FOR UPDATE", promotion.NormalizeCode(code)).Scan(&couponID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return appliedCoupon{}, &promotion.IneligibleError{Reason: "Invalid coupon code"}
+	}
+	if err != nil {
+		return appliedCoupon{}, err
+	}
+	coupons, err := getCoupons(tx, "cp.id = ?", couponID)
+	if err != nil {
+		return appliedCoupon{}, err
+	}
+	if len(coupons) == 0 {
+		return appliedCoupon{}, sql.ErrNoRows
+	}
+	data := coupons[0]
+	coupon := data.toCoupon()
+
+	// Count uses of customer (total count is included in coupon data)
+	// Guest orders placed with the same email address count too, so limit can't be avoided by checking out as guest
+	usage := promotion.Usage{Total: data.UsedCount}
+	err = tx.QueryRow(fmt.Sprintf(`
+		SELECT COUNT(*) FROM orders AS o WHERE o.coupon_id = ? AND (o.user_id = ? OR o.guest_email = ?) AND %s
+	`, couponUseCondition), couponID, customer.UserID, customer.Email).Scan(&usage.ByUser)
+	if err != nil {
+		return appliedCoupon{}, err
+	}
+
+	// Category scope covers subcategories (Functions defined in category.go file)
+	productCategories := map[int][]int{}
+	if len(coupon.CategoryIDs) > 0 {
+		categories, err := loadCategories(db)
+		if err != nil {
+			return appliedCoupon{}, err
+		}
+		expanded := []int{}
+		for _, id := range coupon.CategoryIDs {
+			expanded = append(expanded, descendantCategoryIDs(categories, id)...)
+		}
+		coupon.CategoryIDs = expanded
+
+		productIDs := []interface{}{}
+		for _, line := range lines {
+			productIDs = append(productIDs, line.ProductID)
+		}
+		placeholders := strings.Repeat("?,", len(productIDs)-1) + "?"
+		rows, err := tx.Query(fmt.Sprintf(
+			"SELECT product_id, category_id FROM product_categories WHERE product_id IN (%s)", placeholders,
+		), productIDs...)
+		if err != nil {
+			return appliedCoupon{}, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var productID, categoryID int
+			if err := rows.Scan(&productID, &categoryID); err != nil {
+				return appliedCoupon{}, err
+			}
+			productCategories[productID] = append(productCategories[productID], categoryID)
+		}
+		if err := rows.Err(); err != nil {
+			return appliedCoupon{}, err
+		}
+	}
+
+	promotionLines := make([]promotion.Line, 0, len(lines))
+	for _, line := range lines {
+		promotionLines = append(promotionLines, promotion.Line{
+			ProductID:   line.ProductID,
+			CategoryIDs: productCategories[line.ProductID],
+			Amount:      line.UnitPrice * line.Quantity,
+		})
+	}
+	discount, err := coupon.Discount(promotionLines, usage, time.Now())
+	if err != nil {
+		return appliedCoupon{}, err
+	}
+	return appliedCoupon{
+		Coupon:        data,
+		Discount:      discount,
+		LineDiscounts: coupon.Allocate(promotionLines, discount),
+	}, nil
+}
+
+// Function to check IDs exist in table (duplicates are ignored)
+func countMissingIDs(db *sql.DB, table string, ids []int) (int, error) {
+	unique := []interface{}{}
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	if len(unique) == 0 {
+		return 0, nil
+	}
+	var found int
+	placeholders := strings.Repeat("?,", len(unique)-1) + "?"
+	query := fmt.Sprintf("SELECT COUNT(*) FROM %s WHERE id IN (%s)", table, placeholders)
+	if err := db.QueryRow(query, unique...).Scan(&found); err != nil {
+		return 0, err
+	}
+	return len(unique) - found, nil
+}
+
+// Function to save coupon with its products and categories (inserts if id is 0)
+// Returns error message for client if validation fails
+func saveCoupon(db *sql.DB, id int, req CouponRequest) (int64, string, error) {
+	coupon := promotion.Coupon{
+		Code:           promotion.NormalizeCode(req.Code),
+		Type:           req.Type,
+		Value:          req.Value,
+		MinSubtotal:    req.MinSubtotal,
+		StartsAt:       req.StartsAt,
+		EndsAt:         req.EndsAt,
+		MaxUses:        req.MaxUses,
+		MaxUsesPerUser: req.MaxUsesPerUser,
+	}
+	if err := coupon.Validate(); err != nil {
+		return 0, err.Error(), nil
+	}
+
+	// Check for duplicate code (excluding own coupon)
+	var count int
+	if err := db.QueryRow("SELECT COUNT(*) FROM coupons WHERE code = ? AND id != ?", coupon.Code, id).Scan(&count); err != nil {
+		return 0, "", err
+	}
+	if count > 0 {
+		return 0, "This coupon code is already in use", nil
+	}
+
+	// Check products and categories exist
+	missing, err := countMissingIDs(db, "products", req.ProductIDs)
+	if err != nil {
+		return 0, "", err
+	}
+	if missing > 0 {
+		return 0, "Some products were not found", nil
+	}
+	missing, err = countMissingIDs(db, "categories", req.CategoryIDs)
+	if err != nil {
+		return 0, "", err
+	}
+	if missing > 0 {
+		return 0, "Some categories were not found", nil
+	}
+
+	enabled := req.Enabled == nil || *req.Enabled
+	description := strings.TrimSpace(req.Description)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	couponID := int64(id)
+	if id == 0 {
+		result, err := tx.Exec(`
+			INSERT INTO coupons (
+				code, description, discount_type, discount_value, min_subtotal,
+				starts_at, ends_at, max_uses, max_uses_per_user, enabled
+			)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`, coupon.Code, description, coupon.Type, coupon.Value, coupon.MinSubtotal,
+			coupon.StartsAt, coupon.EndsAt, coupon.MaxUses, coupon.MaxUsesPerUser, enabled)
+		if err != nil {
+			return 0, "", err
+		}
+		if couponID, err = result.LastInsertId(); err != nil {
+			return 0, "", err
+		}
+	} else {
+		_, err := tx.Exec(`
+			UPDATE coupons SET
+				code = ?, description = ?, discount_type = ?, discount_value = ?, min_subtotal = ?,
+				starts_at = ?, ends_at = ?, max_uses = ?, max_uses_per_user = ?, enabled = ?
+			WHERE id = ?
+		`, coupon.Code, description, coupon.Type, coupon.Value, coupon.MinSubtotal,
+			coupon.StartsAt, coupon.EndsAt, coupon.MaxUses, coupon.MaxUsesPerUser, enabled, id)
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	// Replace products and categories
+	if _, err := tx.Exec("DELETE FROM coupon_products WHERE coupon_id = ?", couponID); err != nil {
+		return 0, "", err
+	}
+	if _, err := tx.Exec("DELETE FROM coupon_categories WHERE coupon_id = ?", couponID); err != nil {
+		return 0, "", err
+	}
+	for _, productID := range req.ProductIDs {
+		if _, err := tx.Exec("INSERT IGNORE INTO coupon_products (coupon_id, product_id) VALUES (?, ?)", couponID, productID); err != nil {
+			return 0, "", err
+		}
+	}
+	for _, categoryID := range req.CategoryIDs {
+		if _, err := tx.Exec("INSERT IGNORE INTO coupon_categories (coupon_id, category_id) VALUES (?, ?)", couponID, categoryID); err != nil {
+			return 0, "", err
+		}
+	}
+
+	return couponID, "", tx.Commit()
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to list coupons with their usage (GET /api/admin/coupons)
+func AdminListCouponsHandler(c *gin.Context) {
+	coupons, err := getCoupons(database.GetDB(), "TRUE")
+	if err != nil {
+		log.Printf("Coupons retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"coupons": coupons})
+}
+
+// Function to get coupon (GET /api/admin/coupons/:id)
+func AdminGetCouponHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	coupons, err := getCoupons(database.GetDB(), "cp.id = ?", id)
+	if err != nil {
+		log.Printf("Coupon retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if len(coupons) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+	c.JSON(http.StatusOK, coupons[0])
+}
+
+// Function to create coupon (POST /api/admin/coupons)
+func AdminCreateCouponHandler(c *gin.Context) {
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Coupon creation request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	id, msg, err := saveCoupon(database.GetDB(), 0, req)
+	if err != nil {
+		log.Printf("Coupon registration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful registration response
+	c.JSON(http.StatusCreated, gin.H{"message": "Coupon registered successfully", "id": id})
+}
+
+// Function to edit coupon (PUT /api/admin/coupons/:id)
+// (Orders that already used coupon keep their discount)
+func AdminUpdateCouponHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	var req CouponRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Coupon update request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check coupon exists
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM coupons WHERE id = ?", id).Scan(&exists); err != nil {
+		log.Printf("Coupon check error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	_, msg, err := saveCoupon(db, id, req)
+	if err != nil {
+		log.Printf("Coupon update error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon updated successfully"})
+}
+
+// Function to delete coupon (DELETE /api/admin/coupons/:id)
+// (Orders keep coupon code and discount they were given)
+func AdminDeleteCouponHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid coupon ID"})
+		return
+	}
+
+	result, err := database.GetDB().Exec("DELETE FROM coupons WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Coupon deletion error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Coupon not found"})
+		return
+	}
+
+	// Return successful deletion response
+	c.JSON(http.StatusOK, gin.H{"message": "Coupon deleted successfully"})
+}
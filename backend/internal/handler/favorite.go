@@ -40,7 +40,7 @@ func ListFavoritesHandler(c *gin.Context) {
 	// Join favorites and products tables to get required information
 	query := `
 		SELECT
-			p.id, p.name, p.price, p.image_url
+			p.id, p.name, p.price, p.currency, p.image_url
 		FROM favorites AS f
 		JOIN products AS p ON f.product_id = p.id
 		WHERE f.user_id = ?
@@ -61,7 +61,7 @@ func ListFavoritesHandler(c *gin.Context) {
 	for rows.Next() {
 		var p ProductListItem
 		var imageUrl sql.NullString
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &imageUrl); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Currency, &imageUrl); err != nil {
 			log.Printf("Favorites data scan error (UserID=%d): %v", userID, err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 			return
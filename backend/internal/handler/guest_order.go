@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Customer placing order
+// UserID is 0 for guest checkout, in which case the order is identified by email address
+type checkoutCustomer struct {
+	UserID int
+	Email  string
+}
+
+// Function to check whether customer checks out as guest
+func (c checkoutCustomer) isGuest() bool {
+	return c.UserID == 0
+}
+
+// Function to get frontend base URL (to construct links and redirect destinations)
+func frontendBaseURL() string {
+	baseURL := os.Getenv("FRONTEND_BASE_URL")
+	if baseURL == "" {
+		baseURL = "http://localhost:3000"
+	}
+	return baseURL
+}
+
+// Function to create order lookup token of guest order
+// Token is HMAC of order ID and email address, so links can't be forged for other orders
+func orderLookupToken(orderID int64, email string) string {
+	mac := hmac.New(sha256.New, JWTSecret)
+	fmt.Fprintf(mac, "order-lookup:%d:%s", orderID, strings.ToLower(email))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Function to check order lookup token of guest order
+func validOrderLookupToken(orderID int64, email string, token string) bool {
+	expected := orderLookupToken(orderID, email)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(token)))
+}
+
+// Function to get URL of frontend page where guest can track order
+func orderLookupURL(orderID int64, email string) string {
+	return fmt.Sprintf("%s/orders/%d?token=%s", frontendBaseURL(), orderID, url.QueryEscape(orderLookupToken(orderID, email)))
+}
+
+// Function to check order locked with lockOrderState() was placed by customer
+// Guest orders are matched by email address, since they may have been claimed into an account after checkout
+func orderPlacedBy(tx *sql.Tx, orderID int64, ownerID int, customer checkoutCustomer) (bool, error) {
+	if !customer.isGuest() {
+		return ownerID == customer.UserID, nil
+	}
+	var guestEmail sql.NullString
+	if err := tx.QueryRow("SELECT guest_email FROM orders WHERE id = ?", orderID).Scan(&guestEmail); err != nil {
+		return false, err
+	}
+	return guestEmail.Valid && strings.EqualFold(guestEmail.String, customer.Email), nil
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to get guest order detail with order lookup token (GET /api/orders/guest/:id?token=X)
+// Orders with invalid token are reported as not found
+func GetGuestOrderHandler(c *gin.Context) {
+	orderID, err := getOrderIDFromParam(c) // Function defined in order.go file
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	token := c.Query("token")
+
+	// Get database connection
+	db := database.GetDB()
+
+	var guestEmail sql.NullString
+	err = db.QueryRow("SELECT guest_email FROM orders WHERE id = ?", orderID).Scan(&guestEmail)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!guestEmail.Valid || !validOrderLookupToken(orderID, guestEmail.String, token))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Guest order retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Get order with items (Function defined in order.go file)
+	order, err := getOrderDetail(db, orderID, "id = ?", orderID)
+	if err != nil {
+		log.Printf("Guest order retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Return response as JSON
+	c.JSON(http.StatusOK, order)
+}
+
+// Function to add guest order to account of logged-in user (POST /api/orders/guest/:id/claim?token=X)
+// Order lookup token proves the user placed the order (email addresses of accounts are not verified,
+// so orders are never claimed just because the address matches), and account email must be the order's email,
+// so a forwarded or leaked lookup link can't move the order into another account
+func ClaimGuestOrderHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("ClaimGuestOrderHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID, err := getOrderIDFromParam(c) // Function defined in order.go file
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+	token := c.Query("token")
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Start transaction (order row is locked until owner is set)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	// Orders with invalid token are reported as not found
+	var ownerID sql.NullInt64
+	var guestEmail sql.NullString
+	err = tx.QueryRow("SELECT user_id, guest_email FROM orders WHERE id = ? FOR UPDATE", orderID).Scan(&ownerID, &guestEmail)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (!guestEmail.Valid || !validOrderLookupToken(orderID, guestEmail.String, token))) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Guest order retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Compare with current email of account (email in token may be outdated)
+	var accountEmail string
+	if err := tx.QueryRow("SELECT email FROM users WHERE id = ?", claims.UserID).Scan(&accountEmail); err != nil {
+		log.Printf("User retrieval error (ID=%d): %v", claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if !strings.EqualFold(guestEmail.String, accountEmail) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Order was placed with a different email address than your account"})
+		return
+	}
+
+	if ownerID.Valid {
+		if int(ownerID.Int64) == claims.UserID {
+			c.JSON(http.StatusOK, gin.H{"message": "Order is already in your account", "orderId": orderID})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "Order has already been added to another account"})
+		return
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET user_id = ? WHERE id = ?", claims.UserID, orderID); err != nil {
+		log.Printf("Guest order claim error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	log.Printf("Guest order claimed (ID=%d, UserID=%d)", orderID, claims.UserID)
+	c.JSON(http.StatusOK, gin.H{"message": "Order added to your account", "orderId": orderID})
+}
@@ -0,0 +1,81 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Function to insert user for test (deleted after test)
+func insertTestUser(t *testing.T, db *sql.DB, email string) int {
+	t.Helper()
+	result, err := db.Exec("INSERT INTO users (name, email, password, is_admin, enabled) VALUES ('Claim Test', ?, 'x', false, true)", email)
+	if err != nil {
+		t.Fatalf("user insert: %v", err)
+	}
+	userID, err := result.LastInsertId()
+	if err != nil {
+		t.Fatalf("user ID: %v", err)
+	}
+	t.Cleanup(func() { db.Exec("DELETE FROM users WHERE id = ?", userID) })
+	return int(userID)
+}
+
+// Function to send claim request for guest order as logged-in user and return response status
+func claimAsUser(router *gin.Engine, userID int, orderID string, token string) int {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/api/orders/guest/%s/claim?token=%s", orderID, url.QueryEscape(token)), nil)
+	req.Header.Set("X-Test-User", strconv.Itoa(userID))
+	router.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestClaimGuestOrderRequiresOrderEmail(t *testing.T) {
+	db := requireTestDB(t)
+	router, fake := newCheckoutRouter(t)
+	// Set user of request like auth middleware does
+	router.POST("/api/orders/guest/:id/claim", func(c *gin.Context) {
+		userID, _ := strconv.Atoi(c.GetHeader("X-Test-User"))
+		c.Set("user", &JWTCustomClaims{UserID: userID})
+		ClaimGuestOrderHandler(c)
+	})
+	productID := insertTestProduct(t, db, 1000, 5)
+
+	session := checkoutAsGuest(t, router, fake, productID, 1)
+	orderID := session.Params.Metadata["orderId"]
+	guestEmail := session.Params.Metadata["guestEmail"]
+	id, _ := strconv.ParseInt(orderID, 10, 64)
+	token := orderLookupToken(id, guestEmail)
+
+	// Account with other email can't claim order even with valid lookup link
+	otherUserID := insertTestUser(t, db, fmt.Sprintf("claim-other-%d@example.com", time.Now().UnixNano()))
+	if code := claimAsUser(router, otherUserID, orderID, token); code != http.StatusForbidden {
+		t.Errorf("claim by account with other email: status = %d, want 403", code)
+	}
+
+	// Invalid token is reported as not found
+	ownerID := insertTestUser(t, db, strings.ToUpper(guestEmail)) // Emails are compared case-insensitively
+	if code := claimAsUser(router, ownerID, orderID, "invalid"); code != http.StatusNotFound {
+		t.Errorf("claim with invalid token: status = %d, want 404", code)
+	}
+
+	// Account with order email claims order, and claiming again is not an error
+	for i := 0; i < 2; i++ {
+		if code := claimAsUser(router, ownerID, orderID, token); code != http.StatusOK {
+			t.Errorf("claim %d by account with order email: status = %d, want 200", i+1, code)
+		}
+	}
+	var userID sql.NullInt64
+	db.QueryRow("SELECT user_id FROM orders WHERE id = ?", orderID).Scan(&userID)
+	if !userID.Valid || int(userID.Int64) != ownerID {
+		t.Errorf("order owner = %v, want %d", userID, ownerID)
+	}
+}
@@ -0,0 +1,289 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/jobs"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Kinds of background jobs (handlers registered in RegisterJobHandlers)
+const (
+	JobDeleteUpload          = "delete_upload"           // Delete file from uploads folder
+	JobExpireCheckoutSession = "expire_checkout_session" // Expire Stripe Checkout session of cancelled order
+	JobDeleteStripeCoupon    = "delete_stripe_coupon"    // Delete one-off Stripe coupon that wasn't used for a session
+)
+
+// Valid job statuses for filtering
+var jobStatusValues = []string{jobs.StatusPending, jobs.StatusRunning, jobs.StatusCompleted, jobs.StatusDead}
+
+// Default number of jobs per page of admin job list
+const defaultJobsLimit = 50
+
+// Payload of delete_upload job
+type deleteUploadPayload struct {
+	FileName string `json:"fileName"` // File name relative to uploads folder
+}
+
+// Payload of expire_checkout_session job
+type expireCheckoutSessionPayload struct {
+	SessionID string `json:"sessionId"`
+	OrderID   int64  `json:"orderId"` // For logs only (order is already cancelled)
+}
+
+// Payload of delete_stripe_coupon job
+type deleteStripeCouponPayload struct {
+	CouponID string `json:"couponId"`
+}
+
+// Background job response struct
+type Job struct {
+	ID          int64           `json:"id"`
+	Kind        string          `json:"kind"`
+	Payload     json.RawMessage `json:"payload"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"maxAttempts"`
+	RunAt       time.Time       `json:"runAt"`     // Next (or last) run time
+	LastError   *string         `json:"lastError"` // Error of last failed attempt
+	CompletedAt *time.Time      `json:"completedAt"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	UpdatedAt   time.Time       `json:"updatedAt"`
+}
+
+// Keyset sort order of job list (newest first)
+var jobsOrder = keysetOrder{
+	Name: "new",
+	Keys: []keysetKey{{Expr: "j.id", Kind: keyKindInt}},
+	Desc: true,
+}
+
+// Columns of job row
+const jobColumns = "j.id, j.kind, j.payload, j.status, j.attempts, j.max_attempts, j.run_at, j.last_error, j.completed_at, j.created_at, j.updated_at"
+
+// Function to scan job row (selected with jobColumns)
+func scanJob(row interface{ Scan(...interface{}) error }) (Job, error) {
+	var j Job
+	var lastError sql.NullString
+	var completedAt sql.NullTime
+	err := row.Scan(&j.ID, &j.Kind, &j.Payload, &j.Status, &j.Attempts, &j.MaxAttempts, &j.RunAt, &lastError, &completedAt, &j.CreatedAt, &j.UpdatedAt)
+	if err != nil {
+		return Job{}, err
+	}
+	if lastError.Valid {
+		j.LastError = &lastError.String
+	}
+	if completedAt.Valid {
+		j.CompletedAt = &completedAt.Time
+	}
+	return j, nil
+}
+
+// Function to get job by ID
+func getJob(db *sql.DB, id int64) (Job, error) {
+	return scanJob(db.QueryRow(fmt.Sprintf("SELECT %s FROM jobs AS j WHERE j.id = ?", jobColumns), id))
+}
+
+// Function to enqueue deletion of uploaded file (no job for empty file name)
+// Pass transaction that stops referencing the file, so file is only deleted if the change is committed
+func enqueueDeleteUpload(exec jobs.Execer, fileName string) error {
+	if fileName == "" {
+		return nil
+	}
+	return jobs.Enqueue(exec, JobDeleteUpload, deleteUploadPayload{FileName: fileName})
+}
+
+// Function to enqueue jobs undoing Stripe objects created for checkout of cancelled order (empty IDs are skipped)
+// Pass transaction that cancels the order, so jobs only run if cancellation is committed
+func enqueueCheckoutCleanup(exec jobs.Execer, orderID int64, sessionID string, couponID string) error {
+	if sessionID != "" {
+		if err := jobs.Enqueue(exec, JobExpireCheckoutSession, expireCheckoutSessionPayload{SessionID: sessionID, OrderID: orderID}); err != nil {
+			return fmt.Errorf("checkout session expiry job (%s): %w", sessionID, err)
+		}
+	}
+	if couponID != "" {
+		if err := jobs.Enqueue(exec, JobDeleteStripeCoupon, deleteStripeCouponPayload{CouponID: couponID}); err != nil {
+			return fmt.Errorf("stripe coupon deletion job (%s): %w", couponID, err)
+		}
+	}
+	return nil
+}
+
+// --- 2. Background Task Definitions ---
+
+// Function to register handlers of all job kinds to runner (called from main.go)
+func RegisterJobHandlers(r *jobs.Runner) {
+	r.Register(JobDeleteUpload, runDeleteUploadJob)
+	r.Register(JobExpireCheckoutSession, runExpireCheckoutSessionJob)
+	r.Register(JobDeleteStripeCoupon, runDeleteStripeCouponJob)
+}
+
+// Function to delete uploaded file (already deleted file counts as success)
+func runDeleteUploadJob(ctx context.Context, payload json.RawMessage) error {
+	var p deleteUploadPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+	// Only plain file names are accepted, so job can't delete files outside uploads folder
+	if p.FileName == "" || filepath.Base(p.FileName) != p.FileName {
+		return fmt.Errorf("invalid file name %q", p.FileName)
+	}
+
+	filePath := filepath.Join("uploads", p.FileName)
+	if err := os.Remove(filePath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	log.Printf("Deleted image file: %s", filePath)
+	return nil
+}
+
+// Function to expire Checkout session of cancelled order, so customer can't pay for it
+// Session that was paid anyway is refunded by the checkout webhook (see refundCancelledOrderPayment)
+func runExpireCheckoutSessionJob(ctx context.Context, payload json.RawMessage) error {
+	var p expireCheckoutSessionPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	err := Payments.ExpireCheckoutSession(ctx, p.SessionID)
+	if errors.Is(err, payment.ErrSessionCompleted) {
+		log.Printf("Checkout session of cancelled order was paid, refund is left to webhook (%s, OrderID=%d)", p.SessionID, p.OrderID)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	log.Printf("Expired Checkout session of cancelled order (%s, OrderID=%d)", p.SessionID, p.OrderID)
+	return nil
+}
+
+// Function to delete one-off Stripe coupon (already deleted coupon counts as success)
+func runDeleteStripeCouponJob(ctx context.Context, payload json.RawMessage) error {
+	var p deleteStripeCouponPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return err
+	}
+
+	if err := Payments.DeleteDiscount(ctx, p.CouponID); err != nil {
+		return err
+	}
+	log.Printf("Deleted unused Stripe coupon: %s", p.CouponID)
+	return nil
+}
+
+// --- 3. Handler Definitions ---
+
+// Function to list background jobs (GET /api/admin/jobs?status=dead&cursor=X&limit=Y)
+// Lists dead jobs (failed on every attempt) unless other status is given, newest first
+func AdminListJobsHandler(c *gin.Context) {
+	params := newQueryParser(c)
+	status := params.enumParam("status", jobs.StatusDead, jobStatusValues)
+	limit := params.intParam("limit", defaultJobsLimit, 1, MaxPerPage)
+
+	conditions := []sqlCondition{{Clause: "j.status = ?", Params: []interface{}{status}}}
+	if cursor := c.Query("cursor"); cursor != "" {
+		cursorCond, err := jobsOrder.after(cursor)
+		if err != nil {
+			params.invalidCursor()
+		}
+		conditions = append(conditions, cursorCond)
+	}
+	if params.failed() {
+		return
+	}
+	whereClause, whereParams := buildWhereClause(conditions, "") // Function defined in product_filter.go file
+	orderByClause, _ := jobsOrder.orderBy()
+
+	query := fmt.Sprintf("SELECT %s FROM jobs AS j %s %s LIMIT ?", jobColumns, whereClause, orderByClause)
+	rows, err := database.GetDB().Query(query, append(whereParams, limit+1)...)
+	if err != nil {
+		log.Printf("Job list retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer rows.Close()
+
+	list := []Job{}
+	for rows.Next() {
+		j, err := scanJob(rows)
+		if err != nil {
+			log.Printf("Job scan error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		list = append(list, j)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Job row error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Extra job only signals that a next page exists
+	jobCount := len(list)
+	if jobCount > limit {
+		list = list[:limit]
+	}
+	var lastKeys []interface{}
+	if len(list) > 0 {
+		lastKeys = []interface{}{list[len(list)-1].ID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"jobs":       list,
+		"nextCursor": nextCursor(jobsOrder, jobCount, limit, lastKeys),
+	})
+}
+
+// Function to run dead job again with fresh attempts (POST /api/admin/jobs/:id/retry)
+func AdminRetryJobHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid job ID"})
+		return
+	}
+
+	db := database.GetDB()
+	result, err := db.Exec(
+		"UPDATE jobs SET status = 'pending', attempts = 0, run_at = NOW() WHERE id = ? AND status = 'dead'", id,
+	)
+	if err != nil {
+		log.Printf("Job retry error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	retried, _ := result.RowsAffected()
+
+	j, err := getJob(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Job retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if retried == 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only dead jobs can be retried (status: %s)", j.Status)})
+		return
+	}
+
+	log.Printf("Job scheduled for retry by admin (ID=%d, Kind=%s)", id, j.Kind)
+	c.JSON(http.StatusOK, j)
+}
@@ -1,9 +1,11 @@
 package handler
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"os"
@@ -14,39 +16,77 @@ import (
 
 	"github.com/gin-gonic/gin"
 	"github.com/stripe/stripe-go/v83"
-	"github.com/stripe/stripe-go/v83/checkout/session"
-	"github.com/stripe/stripe-go/v83/webhook"
 
 	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/money"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
+	"github.com/yukaty/go-trailhead/backend/internal/promotion"
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
 )
 
 // --- 1. Type Definitions (structs) ---
 
 // Cart item struct
 type CartItem struct {
-	ID       string `json:"id"`
-	Title    string `json:"title"`
-	Price    int    `json:"price"`
-	ImageURL string `json:"imageUrl"`
-	Quantity int    `json:"quantity"`
+	ID        string `json:"id"`
+	VariantID *int   `json:"variantId"` // Required for products sold with variants
+	Title     string `json:"title"`
+	Price     int    `json:"price"`
+	ImageURL  string `json:"imageUrl"`
+	Quantity  int    `json:"quantity"`
 }
 
 // Stripe Checkout session creation request struct
+// Either items or cartId (stored cart), and either addressId or shippingAddress are required
+// Guests (not logged in) check out with email and shippingAddress
 type CheckoutRequest struct {
-	Items   []CartItem `json:"items"`
-	Address string     `json:"address" binding:"required"`
+	Email           string           `json:"email"` // Required for guest checkout (ignored for logged-in users)
+	Items           []CartItem       `json:"items"`
+	CartID          *int64           `json:"cartId"`          // Check out stored cart instead of items (takes precedence)
+	AddressID       *int64           `json:"addressId"`       // Ship to address book entry (takes precedence)
+	ShippingAddress *ShippingAddress `json:"shippingAddress"` // Ship to new address (type defined in address.go file)
+	SaveAddress     bool             `json:"saveAddress"`     // Also add shippingAddress to address book
+	CouponCode      string           `json:"couponCode"`      // Optional promotion code
 }
 
 // Product information response struct (for stock check and price calculation)
 type productForOrder struct {
-	ID    int
-	Name  string
-	Price int
-	Stock int
+	ID          int
+	Name        string
+	Price       int
+	Currency    money.Currency
+	Stock       int
+	WeightGrams int
+	TaxClass    string
+	HasVariants bool
+}
+
+// Variant information struct (for stock check and price calculation)
+type variantForOrder struct {
+	ID          int
+	ProductID   int
+	SKU         string
+	Label       string
+	Price       sql.NullInt64 // NULL means "use product price"
+	Stock       int
+	WeightGrams sql.NullInt64 // NULL means "use product weight"
+}
+
+// Order line struct (cart item resolved against database)
+type orderLine struct {
+	ProductID   int
+	VariantID   *int
+	SKU         *string
+	Name        string
+	UnitPrice   int
+	Quantity    int
+	WeightGrams int    // Shipping weight per unit
+	TaxClass    string // Tax class of product
 }
 
 // Order item struct
 type OrderItem struct {
+	ProductID   int    `json:"productId"`
 	ProductName string `json:"productName"`
 	Quantity    int    `json:"quantity"`
 	UnitPrice   int    `json:"unitPrice"`
@@ -54,52 +94,186 @@ type OrderItem struct {
 
 // Order information response struct
 type OrderData struct {
-	ID            int         `json:"id"`
-	TotalPrice    int         `json:"totalPrice"`
-	Status        string      `json:"status"`        // ENUM treated as string
-	PaymentStatus string      `json:"paymentStatus"` // ENUM treated as string
-	CreatedAt     time.Time   `json:"createdAt"`
-	Items         []OrderItem `json:"items"` // Slice of order items
+	ID            int           `json:"id"`
+	TotalPrice    int           `json:"totalPrice"`
+	Currency      string        `json:"currency"`
+	Tax           int           `json:"tax"` // Included in totalPrice either way
+	Status        OrderStatus   `json:"status"`
+	PaymentStatus PaymentStatus `json:"paymentStatus"`
+	CreatedAt     time.Time     `json:"createdAt"`
+	Items         []OrderItem   `json:"items"` // Slice of order items
+}
+
+// Order line item struct with product reference
+type OrderDetailItem struct {
+	ID               int     `json:"id"`
+	ProductID        int     `json:"productId"`
+	VariantID        *int    `json:"variantId"`
+	SKU              *string `json:"sku"`
+	ProductName      string  `json:"productName"`
+	Quantity         int     `json:"quantity"`
+	UnitPrice        int     `json:"unitPrice"`
+	Subtotal         int     `json:"subtotal"`         // UnitPrice × Quantity
+	RefundedQuantity int     `json:"refundedQuantity"` // Quantity in succeeded refunds
+}
+
+// Customer order detail response struct
+type OrderDetail struct {
+	ID              int               `json:"id"`
+	Status          OrderStatus       `json:"status"`
+	PaymentStatus   PaymentStatus     `json:"paymentStatus"`
+	Subtotal        int               `json:"subtotal"` // Total of items
+	ShippingCost    int               `json:"shippingCost"`
+	Discount        int               `json:"discount"`   // Coupon discount on items
+	CouponCode      *string           `json:"couponCode"` // Null if no coupon was used
+	Tax             int               `json:"tax"`
+	TaxInclusive    bool              `json:"taxInclusive"` // Tax is part of item prices (otherwise added to total)
+	TotalPrice      int               `json:"totalPrice"`
+	Currency        string            `json:"currency"` // Amounts are in minor units of this currency
+	RefundedAmount  int               `json:"refundedAmount"`
+	ShippingAddress string            `json:"shippingAddress"`       // Formatted address text
+	AddressDetail   *ShippingAddress  `json:"shippingAddressDetail"` // Structured snapshot (null for orders placed with free-form address)
+	StripeSessionID *string           `json:"stripeSessionId"`       // Checkout session reference (null if session wasn't created)
+	CreatedAt       time.Time         `json:"createdAt"`
+	UpdatedAt       time.Time         `json:"updatedAt"`
+	Items           []OrderDetailItem `json:"items"`
 }
 
 // Order and order items join record struct
 type orderJoinRecord struct {
 	ID            int
 	TotalPrice    int
-	Status        string
-	PaymentStatus string
+	Currency      string
+	Tax           int
+	Status        OrderStatus
+	PaymentStatus PaymentStatus
 	CreatedAt     time.Time
+	ProductID     int
 	ProductName   string
 	Quantity      int
 	UnitPrice     int
 }
 
-// Order status (corresponding to orders table ENUM)
-const (
-	OrderStatusPending    = "Pending"
-	OrderStatusProcessing = "Processing"
-	// Define other statuses as needed
-)
+// Keyset sort order of order history (newest first)
+var ordersOrder = keysetOrder{
+	Name: "new",
+	Keys: []keysetKey{{Expr: "o.created_at", Kind: keyKindTime}, {Expr: "o.id", Kind: keyKindInt}},
+	Desc: true,
+}
 
-// Payment status (corresponding to orders table ENUM)
-const (
-	PaymentStatusUnpaid = "Unpaid"
-	PaymentStatusPaid   = "Payment Successful"
-	// Define other statuses as needed
-)
+// Default number of orders per page of order history
+const defaultOrdersLimit = 20
+
+// Function to get order ID from URL parameter
+func getOrderIDFromParam(c *gin.Context) (int64, error) {
+	return strconv.ParseInt(c.Param("id"), 10, 64)
+}
+
+// Function to get line items of order
+func getOrderDetailItems(db *sql.DB, orderID int64) ([]OrderDetailItem, error) {
+	rows, err := db.Query(`
+		SELECT
+			oi.id, oi.product_id, oi.variant_id, oi.sku, oi.product_name, oi.quantity, oi.unit_price,
+			COALESCE((
+				SELECT SUM(ri.quantity)
+				FROM order_refund_items AS ri
+				JOIN order_refunds AS r ON ri.refund_id = r.id
+				WHERE ri.order_item_id = oi.id AND r.status = ?
+			), 0)
+		FROM order_items AS oi
+		WHERE oi.order_id = ?
+		ORDER BY oi.id
+	`, RefundStatusSucceeded, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []OrderDetailItem{}
+	for rows.Next() {
+		var item OrderDetailItem
+		var variantID sql.NullInt64
+		var sku sql.NullString
+		if err := rows.Scan(&item.ID, &item.ProductID, &variantID, &sku, &item.ProductName, &item.Quantity, &item.UnitPrice, &item.RefundedQuantity); err != nil {
+			return nil, err
+		}
+		if variantID.Valid {
+			id := int(variantID.Int64)
+			item.VariantID = &id
+		}
+		if sku.Valid {
+			item.SKU = &sku.String
+		}
+		item.Subtotal = item.UnitPrice * item.Quantity
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+// Function to get order detail with items
+// condition selects the order (e.g. "id = ? AND user_id = ?"); returns sql.ErrNoRows if no order matches
+func getOrderDetail(db *sql.DB, orderID int64, condition string, args ...interface{}) (OrderDetail, error) {
+	var order OrderDetail
+	var sessionID, couponCode sql.NullString
+	var snapshot addressSnapshot // Type defined in address.go file
+	query := `
+		SELECT
+			id, status, payment_status, total_price, currency, shipping_cost, discount_amount, coupon_code,
+			tax_amount, tax_inclusive, refunded_amount,
+			shipping_address, stripe_session_id, created_at, updated_at, ` + addressSnapshotColumns + `
+		FROM orders
+		WHERE ` + condition
+	dest := []interface{}{
+		&order.ID, &order.Status, &order.PaymentStatus, &order.TotalPrice, &order.Currency, &order.ShippingCost, &order.Discount, &couponCode,
+		&order.Tax, &order.TaxInclusive, &order.RefundedAmount, &order.ShippingAddress, &sessionID, &order.CreatedAt, &order.UpdatedAt,
+	}
+	if err := db.QueryRow(query, args...).Scan(append(dest, snapshot.scanTargets()...)...); err != nil {
+		return OrderDetail{}, err
+	}
+	if sessionID.Valid {
+		order.StripeSessionID = &sessionID.String
+	}
+	if couponCode.Valid {
+		order.CouponCode = &couponCode.String
+	}
+	order.AddressDetail = snapshot.toAddress()
+
+	// Get order items
+	items, err := getOrderDetailItems(db, orderID)
+	if err != nil {
+		return OrderDetail{}, fmt.Errorf("order items retrieval: %w", err)
+	}
+	order.Items = items
 
-// Shipping cost (in dollars)
-const shippingCost = 500
+	// Calculate subtotal
+	for _, item := range order.Items {
+		order.Subtotal += item.Subtotal
+	}
+	return order, nil
+}
 
-// Initialize Stripe
-func init() {
-	// Get Stripe secret key from environment variable and set it
-	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
-	if stripe.Key == "" {
-		log.Println("Warning: STRIPE_SECRET_KEY environment variable is not set")
+// Currency of prices and payments (override with STORE_CURRENCY environment variable)
+// Shipping rates, fixed coupon amounts and tax rates are in this currency as well
+var StoreCurrency = storeCurrency()
+
+// Function to get store currency from environment variable
+func storeCurrency() money.Currency {
+	value := os.Getenv("STORE_CURRENCY")
+	if value == "" {
+		return "JPY"
 	}
+	currency, err := money.Parse(value)
+	if err != nil {
+		log.Printf("Warning: STORE_CURRENCY environment variable is invalid (%q), using JPY", value)
+		return "JPY"
+	}
+	return currency
 }
 
+// Payment provider used for checkout, refunds and webhook verification
+// Set in main.go (tests can set payment.Fake to run checkout without network)
+var Payments payment.Provider
+
 // --- 2. Handler Definitions ---
 
 // Function to create Stripe Checkout session (POST /api/orders/checkout)
@@ -111,25 +285,78 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request data"})
 		return
 	}
+
+	// Logged-in users check out with their account, other visitors as guest with email address
+	// (Type and functions defined in guest_order.go file)
+	var customer checkoutCustomer
+	if claims, ok := GetUserFromContext(c); ok {
+		customer = checkoutCustomer{UserID: claims.UserID, Email: claims.Email}
+	} else {
+		customer.Email = strings.TrimSpace(req.Email)
+		if !ValidateEmail(customer.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Please enter a valid email address"})
+			return
+		}
+		if req.AddressID != nil || req.SaveAddress {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Please log in to use your address book"})
+			return
+		}
+	}
+	userID := customer.UserID
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Use items of stored cart (Function defined in cart.go file)
+	// Items are re-validated below like items sent by client
+	if req.CartID != nil {
+		cartUserID, cartToken := getCartOwner(c)
+		items, err := getCartCheckoutItems(db, *req.CartID, cartUserID, cartToken)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Cart not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Cart items retrieval error (CartID=%d): %v", *req.CartID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		req.Items = items
+	}
 	if len(req.Items) == 0 {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Cart is empty"})
 		return
 	}
 
-	claims, ok := GetUserFromContext(c)
-	if !ok {
-		log.Println("CreateCheckoutSessionHandler: User information not found in context")
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+	// Resolve shipping address (Functions defined in address.go file)
+	var address ShippingAddress
+	switch {
+	case req.AddressID != nil:
+		saved, err := getSavedAddress(db, userID, *req.AddressID)
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Address not found"})
+			return
+		}
+		if err != nil {
+			log.Printf("Address retrieval error (ID=%d): %v", *req.AddressID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		address = saved.ShippingAddress
+	case req.ShippingAddress != nil:
+		address = *req.ShippingAddress
+		if msg := address.normalize(); msg != "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+			return
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping address is required"})
 		return
 	}
-	userID := claims.UserID
-	userEmail := claims.Email
-
-	// Get database connection
-	db := database.GetDB()
 
-	productIDs := []interface{}{} // Slice to store product ID list from cart
-	quantityMap := map[int]int{}  // Map to hold quantity per product ID
+	productIDs := []interface{}{} // Slice to store product ID list from cart (without duplicates)
+	variantIDs := []interface{}{} // Slice to store variant ID list from cart
+	seenProducts := map[int]bool{}
 	for _, item := range req.Items {
 		id, err := strconv.Atoi(item.ID)
 		if err != nil {
@@ -137,14 +364,29 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid product ID in cart"})
 			return
 		}
-		productIDs = append(productIDs, id)
-		quantityMap[id] = item.Quantity
+		if item.Quantity < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid quantity in cart"})
+			return
+		}
+		if !seenProducts[id] {
+			seenProducts[id] = true
+			productIDs = append(productIDs, id)
+		}
+		if item.VariantID != nil {
+			variantIDs = append(variantIDs, *item.VariantID)
+		}
 	}
 
 	// Get target product information from database (ID IN ...)
 	// Dynamically generate placeholders based on number of product IDs
 	placeholders := strings.Repeat("?,", len(productIDs)-1) + "?"
-	query := fmt.Sprintf(`SELECT id, name, price, stock FROM products WHERE id IN (%s)`, placeholders)
+	query := fmt.Sprintf(`
+		SELECT
+			p.id, p.name, p.price, p.currency, p.stock, p.weight_grams, p.tax_class,
+			EXISTS (SELECT 1 FROM product_variants AS v WHERE v.product_id = p.id) AS has_variants
+		FROM products AS p
+		WHERE p.id IN (%s)
+	`, placeholders)
 
 	rows, err := db.Query(query, productIDs...)
 	if err != nil {
@@ -155,19 +397,14 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 	defer rows.Close()
 
 	dbProducts := make(map[int]productForOrder) // Map with cart product IDs as keys
-	shortageItems := []string{}                 // List of out-of-stock product names
 	for rows.Next() {
 		var p productForOrder
-		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Stock); err != nil {
+		if err := rows.Scan(&p.ID, &p.Name, &p.Price, &p.Currency, &p.Stock, &p.WeightGrams, &p.TaxClass, &p.HasVariants); err != nil {
 			log.Printf("Product scan error during stock check: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 			return
 		}
 		dbProducts[p.ID] = p
-		// Perform stock check
-		if p.Stock < quantityMap[p.ID] {
-			shortageItems = append(shortageItems, p.Name)
-		}
 	}
 	if err = rows.Err(); err != nil {
 		log.Printf("Row error during stock check: %v", err)
@@ -181,37 +418,226 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Some cart products were not found"})
 		return
 	}
+
+	// Get target variant information from database
+	dbVariants := make(map[int]variantForOrder) // Map with cart variant IDs as keys
+	if len(variantIDs) > 0 {
+		placeholders := strings.Repeat("?,", len(variantIDs)-1) + "?"
+		query := fmt.Sprintf(`SELECT id, product_id, sku, size, color, price, stock, weight_grams FROM product_variants WHERE id IN (%s)`, placeholders)
+		variantRows, err := db.Query(query, variantIDs...)
+		if err != nil {
+			log.Printf("Variant retrieval error during stock check: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		defer variantRows.Close()
+
+		for variantRows.Next() {
+			var v variantForOrder
+			var size, color sql.NullString
+			if err := variantRows.Scan(&v.ID, &v.ProductID, &v.SKU, &size, &color, &v.Price, &v.Stock, &v.WeightGrams); err != nil {
+				log.Printf("Variant scan error during stock check: %v", err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+				return
+			}
+			v.Label = variantLabel(size, color) // Function defined in variant.go file
+			dbVariants[v.ID] = v
+		}
+		if err = variantRows.Err(); err != nil {
+			log.Printf("Row error during variant stock check: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+	}
+
+	// Resolve cart items to order lines (price, name and SKU come from database, not from client)
+	lines := []orderLine{}
+	productDemand := map[int]int{} // Total quantity per product (products without variants)
+	variantDemand := map[int]int{} // Total quantity per variant
+	for _, item := range req.Items {
+		id, _ := strconv.Atoi(item.ID)
+		product := dbProducts[id]
+		if product.Currency != StoreCurrency {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("%s is not sold in %s", product.Name, StoreCurrency)})
+			return
+		}
+		line := orderLine{
+			ProductID:   product.ID,
+			Name:        product.Name,
+			UnitPrice:   product.Price,
+			Quantity:    item.Quantity,
+			WeightGrams: product.WeightGrams,
+			TaxClass:    product.TaxClass,
+		}
+
+		if item.VariantID == nil {
+			if product.HasVariants {
+				c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("Please select options for %s", product.Name)})
+				return
+			}
+			productDemand[product.ID] += item.Quantity
+		} else {
+			variant, ok := dbVariants[*item.VariantID]
+			if !ok || variant.ProductID != product.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Some cart product options were not found"})
+				return
+			}
+			line.VariantID = &variant.ID
+			line.SKU = &variant.SKU
+			if variant.Label != "" {
+				line.Name = fmt.Sprintf("%s (%s)", product.Name, variant.Label)
+			}
+			if variant.Price.Valid {
+				line.UnitPrice = int(variant.Price.Int64)
+			}
+			if variant.WeightGrams.Valid {
+				line.WeightGrams = int(variant.WeightGrams.Int64)
+			}
+			variantDemand[variant.ID] += item.Quantity
+		}
+		lines = append(lines, line)
+	}
+
+	// Start transaction to register order information in database
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	// Lock stock rows and get stock available for new holds (stock minus active holds of other checkouts)
+	// (Function defined in reservation.go file)
+	heldProductIDs := []int{}
+	for id := range productDemand {
+		heldProductIDs = append(heldProductIDs, id)
+	}
+	heldVariantIDs := []int{}
+	for id := range variantDemand {
+		heldVariantIDs = append(heldVariantIDs, id)
+	}
+	sort.Ints(heldProductIDs)
+	sort.Ints(heldVariantIDs)
+	availableProducts, availableVariants, err := lockAvailableStock(tx, heldProductIDs, heldVariantIDs)
+	if err != nil {
+		log.Printf("Available stock retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Perform stock check
+	shortageItems := []string{} // List of out-of-stock product names
+	for id, quantity := range productDemand {
+		if availableProducts[id] < quantity {
+			shortageItems = append(shortageItems, dbProducts[id].Name)
+		}
+	}
+	for id, quantity := range variantDemand {
+		if availableVariants[id] < quantity {
+			variant := dbVariants[id]
+			shortageItems = append(shortageItems, fmt.Sprintf("%s (%s)", dbProducts[variant.ProductID].Name, variant.Label))
+		}
+	}
 	// Return error if any products are out of stock
 	if len(shortageItems) > 0 {
+		sort.Strings(shortageItems)
 		errMsg := fmt.Sprintf("Out of stock products: %s", strings.Join(shortageItems, ", "))
 		c.JSON(http.StatusBadRequest, gin.H{"error": errMsg})
 		return
 	}
 
-	// Start transaction to register order information in database
-	tx, err := db.Begin()
+	// Calculate shipping cost from destination and rate table (Function defined in shipping.go file)
+	shippingQuote, err := quoteShipping(tx, address.destination(), lines)
+	if errors.Is(err, shipping.ErrNoRate) {
+		log.Printf("No shipping rate (Destination=%s): %v", address.destination(), err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Shipping is not available to this address"})
+		return
+	}
 	if err != nil {
-		log.Printf("Transaction start error: %v", err)
+		log.Printf("Shipping cost calculation error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Apply coupon to items (Function defined in coupon.go file)
+	var couponID *int
+	var couponCode *string
+	var lineDiscounts []int
+	discount := 0
+	if strings.TrimSpace(req.CouponCode) != "" {
+		applied, err := applyCoupon(tx, db, req.CouponCode, customer, lines)
+		var ineligible *promotion.IneligibleError
+		if errors.As(err, &ineligible) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": ineligible.Reason})
+			return
+		}
+		if err != nil {
+			log.Printf("Coupon application error (Code=%s): %v", req.CouponCode, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		couponID, couponCode = &applied.Coupon.ID, &applied.Coupon.Code
+		discount, lineDiscounts = applied.Discount, applied.LineDiscounts
+	}
+
+	// Calculate tax of discounted items for destination (Function defined in tax.go file)
+	taxAmount, lineTaxes, err := calculateTax(tx, address.destination(), lines, lineDiscounts)
+	if err != nil {
+		log.Printf("Tax calculation error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 		return
 	}
-	defer tx.Rollback() // Rollback on function exit (if not committed)
 
 	// Calculate total price
 	totalPrice := 0
-	for _, item := range req.Items {
-		id, _ := strconv.Atoi(item.ID)
-		product := dbProducts[id]
-		totalPrice += product.Price * item.Quantity
+	for _, line := range lines {
+		totalPrice += line.UnitPrice * line.Quantity
+	}
+	totalPrice -= discount          // Subtract coupon discount
+	totalPrice += shippingQuote.Fee // Add shipping cost
+	if !PricesIncludeTax {
+		totalPrice += taxAmount // Add tax (included in item prices otherwise)
 	}
-	totalPrice += shippingCost // Add shipping cost
 
-	// Insert into orders table
+	// Add new address to address book
+	if req.AddressID == nil && req.SaveAddress {
+		if err := lockAddressBook(tx, userID); err != nil {
+			log.Printf("Address book lock error (UserID=%d): %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if _, err := insertSavedAddress(tx, userID, address, false); err != nil {
+			log.Printf("Address registration error (UserID=%d): %v", userID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save address"})
+			return
+		}
+	}
+
+	// Guest orders have no user and keep email address instead
+	var orderUserID, guestEmail interface{} // NULL unless set
+	if customer.isGuest() {
+		guestEmail = customer.Email
+	} else {
+		orderUserID = userID
+	}
+
+	// Insert into orders table (with snapshot of shipping address)
 	orderQuery := `
-		INSERT INTO orders (user_id, total_price, status, payment_status, shipping_address)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO orders (
+			user_id, guest_email, cart_id, total_price, currency, shipping_cost, discount_amount, tax_amount, tax_inclusive,
+			coupon_id, coupon_code, status, payment_status, shipping_address,
+			shipping_recipient, shipping_postal_code, shipping_country, shipping_region,
+			shipping_city, shipping_line1, shipping_line2, shipping_phone
+		)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
-	result, err := tx.Exec(orderQuery, userID, totalPrice, OrderStatusPending, PaymentStatusUnpaid, req.Address)
+	result, err := tx.Exec(orderQuery,
+		orderUserID, guestEmail, req.CartID, totalPrice, StoreCurrency, shippingQuote.Fee, discount, taxAmount, PricesIncludeTax,
+		couponID, couponCode, OrderStatusPending, PaymentStatusUnpaid, address.format(),
+		address.Recipient, address.PostalCode, address.Country, address.Region,
+		address.City, address.Line1, address.Line2, address.Phone,
+	)
 	if err != nil {
 		log.Printf("Order registration error: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register order"})
@@ -224,10 +650,10 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 		return
 	}
 
-	// Insert into order_items table
+	// Insert into order_items table (with share of discount and tax of each line, used for item refunds)
 	itemQuery := `
-		INSERT INTO order_items (order_id, product_id, product_name, quantity, unit_price)
-		VALUES (?, ?, ?, ?, ?)
+		INSERT INTO order_items (order_id, product_id, variant_id, sku, product_name, quantity, unit_price, discount_amount, tax_amount)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)
 	`
 	stmt, err := tx.Prepare(itemQuery) // Use prepared statement
 	if err != nil {
@@ -237,10 +663,12 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 	}
 	defer stmt.Close()
 
-	for _, item := range req.Items {
-		id, _ := strconv.Atoi(item.ID)
-		product := dbProducts[id]
-		_, err := stmt.Exec(orderID, product.ID, product.Name, item.Quantity, product.Price)
+	for i, line := range lines {
+		lineDiscount := 0
+		if lineDiscounts != nil {
+			lineDiscount = lineDiscounts[i]
+		}
+		_, err := stmt.Exec(orderID, line.ProductID, line.VariantID, line.SKU, line.Name, line.Quantity, line.UnitPrice, lineDiscount, lineTaxes[i])
 		if err != nil {
 			log.Printf("Order items INSERT execution error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register order"})
@@ -248,235 +676,403 @@ func CreateCheckoutSessionHandler(c *gin.Context) {
 		}
 	}
 
-	// Create Stripe Checkout session
-	lineItems := []*stripe.CheckoutSessionLineItemParams{}
-	for _, item := range req.Items {
-		id, _ := strconv.Atoi(item.ID)
-		product := dbProducts[id]
-		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String(string(stripe.CurrencyJPY)),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name: stripe.String(product.Name),
-				},
-				UnitAmount: stripe.Int64(int64(product.Price)),
-			},
-			Quantity: stripe.Int64(int64(item.Quantity)),
+	// Hold stock until payment completes or checkout session expires
+	// Session expiry is fixed before holds are placed, so holds always outlive the session (by checkoutHoldGrace)
+	sessionExpiresAt := time.Now().Add(CheckoutHoldDuration)
+	if err := insertStockHolds(tx, orderID, lines, CheckoutHoldDuration+checkoutHoldGrace); err != nil {
+		log.Printf("Stock hold registration error (OrderID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register order"})
+		return
+	}
+
+	// Commit order and holds before calling payment provider, so no row locks are held during network calls
+	// (Webhook events of the session always find the order; failures below cancel it again)
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to register order"})
+		return
+	}
+
+	// Create Checkout session of payment provider
+	lineItems := []payment.LineItem{}
+	for _, line := range lines {
+		lineItems = append(lineItems, payment.LineItem{Name: line.Name, UnitAmount: int64(line.UnitPrice), Quantity: int64(line.Quantity)})
+	}
+	// Add shipping cost (no line for free shipping)
+	if shippingQuote.Fee > 0 {
+		lineItems = append(lineItems, payment.LineItem{
+			Name:       fmt.Sprintf("Shipping (%s)", shippingQuote.RateName),
+			UnitAmount: int64(shippingQuote.Fee),
+			Quantity:   1,
 		})
 	}
-	// Add shipping cost
-	lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-		PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-			Currency: stripe.String(string(stripe.CurrencyJPY)),
-			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-				Name: stripe.String("Shipping"),
-			},
-			UnitAmount: stripe.Int64(int64(shippingCost)),
-		},
-		Quantity: stripe.Int64(1),
-	})
+	// Add tax (included tax is shown as text instead, because it's already part of item prices)
+	if taxAmount > 0 && !PricesIncludeTax {
+		lineItems = append(lineItems, payment.LineItem{Name: "Tax", UnitAmount: int64(taxAmount), Quantity: 1})
+	}
 
-	// Frontend base URL (to construct redirect destination)
-	frontendBaseURL := os.Getenv("FRONTEND_BASE_URL")
-	if frontendBaseURL == "" {
-		frontendBaseURL = "http://localhost:3000"
+	// Redirect destination after payment (guests are sent to order lookup page, since they have no account page)
+	successURL := fmt.Sprintf("%s/account?session_id={CHECKOUT_SESSION_ID}", frontendBaseURL())
+	if customer.isGuest() {
+		successURL = orderLookupURL(orderID, customer.Email) + "&session_id={CHECKOUT_SESSION_ID}"
 	}
 
-	params := &stripe.CheckoutSessionParams{
-		LineItems: lineItems,
-		Mode:      stripe.String(string(stripe.CheckoutSessionModePayment)), SuccessURL: stripe.String(fmt.Sprintf("%s/account?session_id={CHECKOUT_SESSION_ID}", frontendBaseURL)), CancelURL: stripe.String(fmt.Sprintf("%s/order-confirm", frontendBaseURL)), CustomerEmail: stripe.String(userEmail),
+	params := payment.SessionParams{
+		Currency:      StoreCurrency.StripeCode(),
+		LineItems:     lineItems,
+		CustomerEmail: customer.Email,
+		SuccessURL:    successURL,
+		CancelURL:     fmt.Sprintf("%s/order-confirm", frontendBaseURL()),
+		ExpiresAt:     sessionExpiresAt, // Session expires before stock holds
 		Metadata: map[string]string{ // Information used in Stripe Webhook
 			"orderId": strconv.FormatInt(orderID, 10),
-			"userId":  strconv.Itoa(userID),
+			"userId":  strconv.Itoa(userID), // 0 for guest orders
 		},
 	}
+	if customer.isGuest() {
+		params.Metadata["guestEmail"] = customer.Email
+	}
+
+	if taxAmount > 0 && PricesIncludeTax {
+		params.SubmitMessage = fmt.Sprintf("Prices include tax of %s.", StoreCurrency.Format(taxAmount))
+	}
+
+	// Reflect coupon discount with one-off discount for exact amount
+	if discount > 0 {
+		discountID, err := Payments.CreateDiscount(c.Request.Context(), payment.DiscountParams{
+			Name:     *couponCode,
+			Amount:   int64(discount),
+			Currency: StoreCurrency.StripeCode(),
+		})
+		if err != nil {
+			log.Printf("Discount creation error (OrderID=%d): %v", orderID, err)
+			abandonCheckoutOrder(orderID, "", "")
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "[backend] Failed to generate payment page"})
+			return
+		}
+		params.DiscountID = discountID
+	}
 
-	s, err := session.New(params)
+	s, err := Payments.CreateCheckoutSession(c.Request.Context(), params)
 	if err != nil {
-		log.Printf("Stripe Checkout session creation error: %v", err)
+		log.Printf("Checkout session creation error: %v", err)
+		abandonCheckoutOrder(orderID, "", params.DiscountID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "[backend] Failed to generate payment page"})
 		return
 	}
 
-	// Commit transaction
-	if err := tx.Commit(); err != nil {
-		log.Printf("Transaction commit error: %v", err)
+	// Save Checkout session reference (used to expire session or look up payment later)
+	if _, err := db.Exec("UPDATE orders SET stripe_session_id = ? WHERE id = ?", s.ID, orderID); err != nil {
+		log.Printf("Checkout session reference update error (OrderID=%d): %v", orderID, err)
+		abandonCheckoutOrder(orderID, s.ID, params.DiscountID)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to confirm order"})
 		return
 	}
 
 	// Return Stripe Checkout session URL as response
-	c.JSON(http.StatusOK, gin.H{"url": s.URL})
+	// Guests also get link to order lookup page, where they can track order without account
+	response := gin.H{"url": s.URL}
+	if customer.isGuest() {
+		response["orderUrl"] = orderLookupURL(orderID, customer.Email)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
-// Function to handle Stripe Webhook events (POST /api/orders/webhook)
-func StripeWebhookHandler(c *gin.Context) {
-	// Get Stripe Webhook signing secret
-	webhookSecret := os.Getenv("STRIPE_WEBHOOK_SECRET")
-	if webhookSecret == "" {
-		log.Println("Warning: STRIPE_WEBHOOK_SECRET environment variable is not set")
-		c.Status(http.StatusInternalServerError)
-		return
+// Function to update order for Checkout session event (called from webhook.go file)
+// Returns errInvalidWebhookPayload if event doesn't carry order information
+func handleCheckoutSessionEvent(event stripe.Event) error {
+	var session stripe.CheckoutSession
+	// Unmarshal event data to CheckoutSession object
+	if err := json.Unmarshal(event.Data.Raw, &session); err != nil {
+		log.Printf("Webhook event data parsing error: %v", err)
+		return errInvalidWebhookPayload
+	}
+
+	// Get orderId and userId from metadata
+	orderIDStr, okOrderId := session.Metadata["orderId"]
+	userIDStr, okUserId := session.Metadata["userId"]
+	if !okOrderId || !okUserId {
+		log.Printf("Webhook metadata missing: orderId=%s, userId=%s", orderIDStr, userIDStr)
+		return errInvalidWebhookPayload
 	}
+	orderID, errOrderId := strconv.ParseInt(orderIDStr, 10, 64)
+	userID, errUserId := strconv.Atoi(userIDStr)
+	if errOrderId != nil || errUserId != nil {
+		log.Printf("Webhook metadata format error: orderId=%s, userId=%s", orderIDStr, userIDStr)
+		return errInvalidWebhookPayload
+	}
+
+	// Guest orders (userId 0) are identified by email address instead
+	customer := checkoutCustomer{UserID: userID, Email: session.Metadata["guestEmail"]}
 
-	// Read HTTP request body
-	payload, err := io.ReadAll(c.Request.Body)
+	// Start transaction to update database
+	log.Printf("Webhook received (%s): OrderID=%d, UserID=%d", event.Type, orderID, userID)
+	tx, err := database.GetDB().Begin()
 	if err != nil {
-		log.Printf("Webhook request body read error: %v", err)
-		c.Status(http.StatusBadRequest)
-		return
+		return fmt.Errorf("transaction start: %w", err)
 	}
+	defer tx.Rollback()
 
-	// Verify signing secret and construct event
-	signature := c.GetHeader("Stripe-Signature")
-	event, err := webhook.ConstructEventWithOptions(
-		payload,
-		signature,
-		webhookSecret,
-		webhook.ConstructEventOptions{
-			IgnoreAPIVersionMismatch: true, // Ignore errors from API version differences
-		},
-	)
+	// Update order according to event
+	var updated bool
+	var lateRefund *pendingRefund // Refund of payment for cancelled order, sent after commit
+	switch {
+	case event.Type == "checkout.session.expired":
+		updated, err = cancelExpiredOrder(tx, orderID, customer)
+	case event.Type == "checkout.session.async_payment_failed":
+		updated, err = failOrderPayment(tx, orderID, customer)
+	case event.Type == "checkout.session.completed" && session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid:
+		updated, err = awaitOrderPayment(tx, orderID, customer)
+	default: // completed with payment, or async_payment_succeeded
+		updated, err = completeOrderPayment(tx, orderID, customer)
+		if err == nil && !updated {
+			// Payment may have completed after order was cancelled, so money must go back to customer
+			paymentIntentID := ""
+			if session.PaymentIntent != nil {
+				paymentIntentID = session.PaymentIntent.ID
+			}
+			updated, lateRefund, err = refundCancelledOrderPayment(tx, orderID, customer, paymentIntentID)
+		}
+	}
 	if err != nil {
-		log.Printf("Webhook signature verification error: %v", err)
-		c.Status(http.StatusBadRequest) // Invalid signature
-		return
+		return fmt.Errorf("order update (OrderID=%d): %w", orderID, err)
+	}
+	if !updated {
+		// Event was received, but there is nothing to do
+		log.Printf("Webhook: No order status to update (OrderID=%d, UserID=%d)", orderID, userID)
+		return nil
 	}
 
-	// Handle checkout.session.completed (payment successful) event
-	if event.Type == "checkout.session.completed" {
-		var session stripe.CheckoutSession
-		// Unmarshal event data to CheckoutSession object
-		err := json.Unmarshal(event.Data.Raw, &session)
+	// Save payment reference (used for refunds)
+	if session.PaymentIntent != nil && session.PaymentIntent.ID != "" {
+		_, err := tx.Exec("UPDATE orders SET stripe_payment_intent_id = ? WHERE id = ?", session.PaymentIntent.ID, orderID)
 		if err != nil {
-			log.Printf("Webhook event data parsing error: %v", err)
-			c.Status(http.StatusBadRequest)
-			return
+			return fmt.Errorf("payment reference update (OrderID=%d): %w", orderID, err)
 		}
+	}
 
-		// Get orderId and userId from metadata
-		orderIDStr, okOrderId := session.Metadata["orderId"]
-		userIDStr, okUserId := session.Metadata["userId"]
-		if !okOrderId || !okUserId {
-			log.Printf("Webhook metadata missing: orderId=%s, userId=%s", orderIDStr, userIDStr)
-			c.Status(http.StatusBadRequest)
-			return
-		}
-		orderID, errOrderId := strconv.ParseInt(orderIDStr, 10, 64)
-		userID, errUserId := strconv.Atoi(userIDStr)
-		if errOrderId != nil || errUserId != nil {
-			log.Printf("Webhook metadata format error: orderId=%s, userId=%s", orderIDStr, userIDStr)
-			c.Status(http.StatusBadRequest)
-			return
-		}
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("transaction commit (OrderID=%d): %w", orderID, err)
+	}
 
-		// Start transaction to update database
-		log.Printf("Webhook received (checkout.session.completed): OrderID=%d, UserID=%d", orderID, userID)
-		db := database.GetDB()
-		tx, err := db.Begin()
-		if err != nil {
-			log.Printf("Webhook: Transaction start error: %v", err)
-			c.Status(http.StatusInternalServerError)
-			return
+	// Returning error keeps event in failed list, so admin notices payment that couldn't be refunded
+	if lateRefund != nil {
+		if _, err := submitPaymentRefund(context.Background(), database.GetDB(), *lateRefund); err != nil { // Function defined in refund.go file
+			return fmt.Errorf("refund of cancelled order (OrderID=%d, RefundID=%d): %w", orderID, lateRefund.ID, err)
 		}
-		defer tx.Rollback()
+	}
 
-		// Update order status
-		// (For idempotency, do nothing if payment status is already "Payment Successful")
-		updateOrderQuery := `
-			UPDATE orders
-			SET status = ?, payment_status = ?
-			WHERE id = ? AND user_id = ? AND payment_status != ?
-		`
-		result, err := tx.Exec(updateOrderQuery, OrderStatusProcessing, PaymentStatusPaid, orderID, userID, PaymentStatusPaid)
-		if err != nil {
-			log.Printf("Webhook: Order status update error (OrderID=%d): %v", orderID, err)
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			log.Printf("Webhook: No order status to update (OrderID=%d, UserID=%d)", orderID, userID)
-			// Return success to Stripe (event was received)
-			c.Status(http.StatusOK)
-			return
-		}
+	log.Printf("Webhook processing successful (%s, OrderID=%d)", event.Type, orderID)
+	return nil
+}
 
-		// Get ordered products and quantities
-		itemsQuery := "SELECT product_id, quantity FROM order_items WHERE order_id = ?"
-		rows, err := tx.Query(itemsQuery, orderID)
-		if err != nil {
-			log.Printf("Webhook: Order items retrieval error (OrderID=%d): %v", orderID, err)
-			c.Status(http.StatusInternalServerError)
-			return
-		}
-		type orderItem struct{ ProductID, Quantity int }
-		itemsToUpdate := []orderItem{}
-		for rows.Next() {
-			var item orderItem
-			if err := rows.Scan(&item.ProductID, &item.Quantity); err != nil {
-				log.Printf("Webhook: Order items scan error (OrderID=%d): %v", orderID, err)
-				c.Status(http.StatusInternalServerError)
-				rows.Close()
-				return
-			}
-			itemsToUpdate = append(itemsToUpdate, item)
-		}
-		rows.Close()
-		if err = rows.Err(); err != nil {
-			log.Printf("Webhook: Order items row error (OrderID=%d): %v", orderID, err)
-			c.Status(http.StatusInternalServerError)
-			return
+// Function to change order state for webhook event
+// Returns false (without error) if order wasn't placed by customer or change isn't allowed from current state
+// (Webhook events can be delivered more than once or out of order)
+func applyWebhookTransition(tx *sql.Tx, orderID int64, customer checkoutCustomer, next OrderState) (bool, error) {
+	ownerID, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	placed := false
+	if err == nil {
+		placed, err = orderPlacedBy(tx, orderID, ownerID, customer) // Function defined in guest_order.go file
+	}
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !placed) {
+		log.Printf("Webhook: Order not found (OrderID=%d, UserID=%d)", orderID, customer.UserID)
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("order state retrieval: %w", err)
+	}
+
+	if err := updateOrderState(tx, orderID, state, next); err != nil {
+		var transitionErr *TransitionError
+		if errors.As(err, &transitionErr) {
+			log.Printf("Webhook: %v (OrderID=%d)", err, orderID)
+			return false, nil
 		}
+		return false, fmt.Errorf("order status update: %w", err)
+	}
+	return true, nil
+}
 
-		// Prepare SQL statement to update stock
-		updateStockQuery := `
-			UPDATE products
-			SET stock = stock - ?, sales_count = sales_count + ?
-			WHERE id = ? AND stock >= ? -- Re-verify sufficient stock (for safety)
-		`
-		stmt, err := tx.Prepare(updateStockQuery)
-		if err != nil {
-			log.Printf("Webhook: Stock update preparation error: %v", err)
-			c.Status(http.StatusInternalServerError)
-			return
+// Function to mark order as paid, decrement stock and convert stock holds
+// Returns false if order was already paid, cancelled or not found (webhook events can be delivered more than once)
+func completeOrderPayment(tx *sql.Tx, orderID int64, customer checkoutCustomer) (bool, error) {
+	// Update order status
+	// (For idempotency, do nothing unless order is still waiting for payment)
+	updated, err := applyWebhookTransition(tx, orderID, customer, OrderState{Status: OrderStatusProcessing, PaymentStatus: PaymentStatusPaid})
+	if err != nil || !updated {
+		return false, err
+	}
+
+	// Get ordered products and quantities
+	itemsQuery := "SELECT product_id, variant_id, quantity FROM order_items WHERE order_id = ?"
+	rows, err := tx.Query(itemsQuery, orderID)
+	if err != nil {
+		return false, fmt.Errorf("order items retrieval: %w", err)
+	}
+	type orderItem struct {
+		ProductID int
+		VariantID sql.NullInt64
+		Quantity  int
+	}
+	itemsToUpdate := []orderItem{}
+	for rows.Next() {
+		var item orderItem
+		if err := rows.Scan(&item.ProductID, &item.VariantID, &item.Quantity); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("order items scan: %w", err)
 		}
-		defer stmt.Close()
+		itemsToUpdate = append(itemsToUpdate, item)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return false, fmt.Errorf("order items row: %w", err)
+	}
+
+	// Prepare SQL statement to update stock
+	updateStockQuery := `
+		UPDATE products
+		SET stock = stock - ?, sales_count = sales_count + ?
+		WHERE id = ? AND stock >= ? -- Re-verify sufficient stock (for safety)
+	`
+	stmt, err := tx.Prepare(updateStockQuery)
+	if err != nil {
+		return false, fmt.Errorf("stock update preparation: %w", err)
+	}
+	defer stmt.Close()
 
-		// Update stock for each product
-		for _, item := range itemsToUpdate {
-			res, err := stmt.Exec(item.Quantity, item.Quantity, item.ProductID, item.Quantity)
+	// Prepare SQL statement to update variant stock
+	updateVariantStockQuery := `
+		UPDATE product_variants
+		SET stock = stock - ?
+		WHERE id = ? AND stock >= ?
+	`
+	variantStmt, err := tx.Prepare(updateVariantStockQuery)
+	if err != nil {
+		return false, fmt.Errorf("variant stock update preparation: %w", err)
+	}
+	defer variantStmt.Close()
+
+	// Update stock for each product (and variant)
+	for _, item := range itemsToUpdate {
+		if item.VariantID.Valid {
+			res, err := variantStmt.Exec(item.Quantity, item.VariantID.Int64, item.Quantity)
 			if err != nil {
-				log.Printf("Webhook: Stock update execution error (ProductID=%d): %v", item.ProductID, err)
-				c.Status(http.StatusInternalServerError)
-				return
+				return false, fmt.Errorf("variant stock update (VariantID=%d): %w", item.VariantID.Int64, err)
 			}
 			affected, _ := res.RowsAffected()
 			if affected == 0 {
-				log.Printf("Webhook: Insufficient stock or product not found (ProductID=%d)", item.ProductID)
-				c.Status(http.StatusInternalServerError)
-				return
+				return false, fmt.Errorf("insufficient stock or variant not found (VariantID=%d)", item.VariantID.Int64)
 			}
 		}
 
-		// Commit transaction
-		if err := tx.Commit(); err != nil {
-			log.Printf("Webhook: Transaction commit error (OrderID=%d): %v", orderID, err)
-			c.Status(http.StatusInternalServerError)
-			return
+		res, err := stmt.Exec(item.Quantity, item.Quantity, item.ProductID, item.Quantity)
+		if err != nil {
+			return false, fmt.Errorf("stock update (ProductID=%d): %w", item.ProductID, err)
+		}
+		affected, _ := res.RowsAffected()
+		if affected == 0 {
+			return false, fmt.Errorf("insufficient stock or product not found (ProductID=%d)", item.ProductID)
 		}
+	}
 
-		log.Printf("Webhook processing successful (OrderID=%d)", orderID)
-	} else {
-		// Ignore events other than checkout.session.completed (but log them)
-		log.Printf("Webhook received (ignoring event): %s", event.Type)
+	// Mark stock holds as converted (stock was decremented above)
+	if err := convertStockHolds(tx, orderID); err != nil {
+		return false, fmt.Errorf("stock hold conversion: %w", err)
+	}
+
+	// Remove ordered items from stored cart (Function defined in cart.go file)
+	if err := clearOrderedCartItems(tx, orderID); err != nil {
+		return false, fmt.Errorf("cart update: %w", err)
+	}
+	return true, nil
+}
+
+// Function to record refund of payment completed for order that was already cancelled (order stays cancelled)
+// Returns false unless order is cancelled and unpaid; stock holds were released at cancellation, so nothing is restocked
+// Returned refund is sent to payment provider after transaction is committed (nil if nothing to refund)
+func refundCancelledOrderPayment(tx *sql.Tx, orderID int64, customer checkoutCustomer, paymentIntentID string) (bool, *pendingRefund, error) {
+	ownerID, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	placed := false
+	if err == nil {
+		placed, err = orderPlacedBy(tx, orderID, ownerID, customer) // Function defined in guest_order.go file
+	}
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && !placed) {
+		return false, nil, nil
+	}
+	if err != nil {
+		return false, nil, fmt.Errorf("order state retrieval: %w", err)
+	}
+	if state != (OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusUnpaid}) {
+		return false, nil, nil
+	}
+	if paymentIntentID == "" {
+		// Returning error keeps event in failed list, so admin can refund payment manually
+		return false, nil, errors.New("payment of cancelled order has no payment reference")
+	}
+
+	refundableAmount, err := getRefundableAmount(tx, orderID) // Function defined in refund.go file
+	if err != nil {
+		return false, nil, fmt.Errorf("refundable amount retrieval: %w", err)
+	}
+	if refundableAmount <= 0 {
+		return true, nil, nil
+	}
+	log.Printf("Webhook: Payment completed for cancelled order, refunding %d (OrderID=%d)", refundableAmount, orderID)
+	// Cancelled order never keeps payment, so it goes straight to refunding
+	if err := updateOrderState(tx, orderID, state, OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusRefunding}); err != nil {
+		return false, nil, fmt.Errorf("order status update: %w", err)
+	}
+	refund, err := recordPendingRefund(tx, orderID, paymentIntentID, refundableAmount, nil, "")
+	if err != nil {
+		return false, nil, fmt.Errorf("refund registration: %w", err)
+	}
+	return true, &refund, nil
+}
+
+// Function to mark order as waiting for delayed payment (e.g. bank transfer)
+// Stock holds are extended, since Stripe reports the result later with async_payment_succeeded/failed
+func awaitOrderPayment(tx *sql.Tx, orderID int64, customer checkoutCustomer) (bool, error) {
+	updated, err := applyWebhookTransition(tx, orderID, customer, OrderState{Status: OrderStatusPending, PaymentStatus: PaymentStatusProcessing})
+	if err != nil || !updated {
+		return false, err
+	}
+
+	if err := extendStockHolds(tx, orderID, asyncPaymentHoldDuration); err != nil { // Function defined in reservation.go file
+		return false, fmt.Errorf("stock hold extension: %w", err)
+	}
+	return true, nil
+}
+
+// Function to cancel order whose delayed payment failed and release its stock holds
+func failOrderPayment(tx *sql.Tx, orderID int64, customer checkoutCustomer) (bool, error) {
+	updated, err := applyWebhookTransition(tx, orderID, customer, OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusFailed})
+	if err != nil || !updated {
+		return false, err
+	}
+
+	if _, err := releaseStockHolds(tx, orderID); err != nil {
+		return false, fmt.Errorf("stock hold release: %w", err)
+	}
+	return true, nil
+}
+
+// Function to cancel order whose Checkout session expired without payment and release its stock holds
+func cancelExpiredOrder(tx *sql.Tx, orderID int64, customer checkoutCustomer) (bool, error) {
+	updated, err := applyWebhookTransition(tx, orderID, customer, OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusUnpaid})
+	if err != nil || !updated {
+		return false, err
 	}
 
-	// Notify Stripe that webhook event was successfully received
-	c.Status(http.StatusOK)
+	if _, err := releaseStockHolds(tx, orderID); err != nil {
+		return false, fmt.Errorf("stock hold release: %w", err)
+	}
+	return true, nil
 }
 
-// Function to get order history
+// Function to get order history (GET /api/orders?cursor=X&limit=Y)
+// Orders are returned newest first, limit orders per page
 func GetOrdersHandler(c *gin.Context) {
 	claims, ok := GetUserFromContext(c)
 	if !ok {
@@ -486,19 +1082,44 @@ func GetOrdersHandler(c *gin.Context) {
 	}
 	userID := claims.UserID
 
+	// Get "orders per page" from query parameter (?limit=X)
+	params := newQueryParser(c)
+	limit := params.intParam("limit", defaultOrdersLimit, 1, MaxPerPage)
+
+	// Build conditions for orders page (start right after last order of previous page)
+	conditions := []sqlCondition{{Clause: "o.user_id = ?", Params: []interface{}{userID}}}
+	if cursor := c.Query("cursor"); cursor != "" {
+		cursorCond, err := ordersOrder.after(cursor)
+		if err != nil {
+			params.invalidCursor()
+		}
+		conditions = append(conditions, cursorCond)
+	}
+	if params.failed() {
+		return
+	}
+	whereClause, whereParams := buildWhereClause(conditions, "") // Function defined in product_filter.go file
+	orderByClause, _ := ordersOrder.orderBy()
+
 	// Get order data from database
-	// Join orders and order_items tables, filter by user ID, sort by creation time and order item ID
+	// Select one page of orders (plus one extra order to know whether a next page exists),
+	// then join order_items, sort by creation time and order item ID
 	db := database.GetDB()
-	query := `
+	query := fmt.Sprintf(`
 		SELECT
-			o.id, o.total_price, o.status, o.payment_status, o.created_at,
-			oi.product_name, oi.quantity, oi.unit_price
-		FROM orders AS o
+			o.id, o.total_price, o.currency, o.tax_amount, o.status, o.payment_status, o.created_at,
+			oi.product_id, oi.product_name, oi.quantity, oi.unit_price
+		FROM (
+			SELECT o.id, o.total_price, o.currency, o.tax_amount, o.status, o.payment_status, o.created_at
+			FROM orders AS o
+			%s
+			%s
+			LIMIT ?
+		) AS o
 		JOIN order_items AS oi ON o.id = oi.order_id
-		WHERE o.user_id = ?
-		ORDER BY o.created_at DESC, oi.id ASC
-	`
-	rows, err := db.Query(query, userID)
+		%s, oi.id ASC
+	`, whereClause, orderByClause, orderByClause)
+	rows, err := db.Query(query, append(whereParams, limit+1)...)
 	if err != nil {
 		log.Printf("Order history retrieval error (UserID=%d): %v", userID, err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
@@ -506,16 +1127,17 @@ func GetOrdersHandler(c *gin.Context) {
 	}
 	defer rows.Close()
 
-	// Map to store order data
-	ordersMap := make(map[int]*OrderData)
+	// Slice to store order data (in order of appearance) and map from order ID to slice index
+	orders := []OrderData{}
+	orderIndex := make(map[int]int)
 	// Variable to temporarily store scan results
 	var record orderJoinRecord
 
 	// Scan SQL execution results
 	for rows.Next() {
 		err := rows.Scan(
-			&record.ID, &record.TotalPrice, &record.Status, &record.PaymentStatus, &record.CreatedAt,
-			&record.ProductName, &record.Quantity, &record.UnitPrice,
+			&record.ID, &record.TotalPrice, &record.Currency, &record.Tax, &record.Status, &record.PaymentStatus, &record.CreatedAt,
+			&record.ProductID, &record.ProductName, &record.Quantity, &record.UnitPrice,
 		)
 		if err != nil {
 			log.Printf("Order history scan error (UserID=%d): %v", userID, err)
@@ -523,29 +1145,33 @@ func GetOrdersHandler(c *gin.Context) {
 			return
 		}
 
-		// Use map to group data by order ID (key: order.id, value: pointer to OrderData struct)
-		orderData, exists := ordersMap[record.ID]
+		// Use map to group data by order ID (key: order.id, value: index in orders slice)
+		idx, exists := orderIndex[record.ID]
 		if !exists {
-			// If this order ID isn't in map yet, create new OrderData struct pointer and add it
-			orderData = &OrderData{
+			// If this order ID isn't in map yet, add new OrderData struct
+			orders = append(orders, OrderData{
 				ID:            record.ID,
 				TotalPrice:    record.TotalPrice,
+				Currency:      record.Currency,
+				Tax:           record.Tax,
 				Status:        record.Status,
 				PaymentStatus: record.PaymentStatus,
 				CreatedAt:     record.CreatedAt,
 				Items:         []OrderItem{}, // Initialize with empty slice
-			}
-			ordersMap[record.ID] = orderData
+			})
+			idx = len(orders) - 1
+			orderIndex[record.ID] = idx
 		}
 
 		// Create order item (OrderItem struct) from current record
 		item := OrderItem{
+			ProductID:   record.ProductID,
 			ProductName: record.ProductName,
 			Quantity:    record.Quantity,
 			UnitPrice:   record.UnitPrice,
 		}
 		// Add order item to Items field
-		orderData.Items = append(orderData.Items, item)
+		orders[idx].Items = append(orders[idx].Items, item)
 	}
 	if err = rows.Err(); err != nil {
 		log.Printf("Order history row error (UserID=%d): %v", userID, err)
@@ -553,17 +1179,261 @@ func GetOrdersHandler(c *gin.Context) {
 		return
 	}
 
-	// Create final response slice from map
-	orders := make([]OrderData, 0, len(ordersMap))
-	for _, order := range ordersMap {
-		orders = append(orders, *order) // Add pointer contents to slice
+	// Extra order only signals that a next page exists
+	orderCount := len(orders)
+	if orderCount > limit {
+		orders = orders[:limit]
+	}
+	var lastKeys []interface{}
+	if len(orders) > 0 {
+		last := orders[len(orders)-1]
+		lastKeys = []interface{}{last.CreatedAt, int64(last.ID)}
 	}
 
-	// Sort by creation time (newest first)
-	sort.Slice(orders, func(i, j int) bool {
-		return orders[i].CreatedAt.After(orders[j].CreatedAt)
+	// Return response as JSON
+	c.JSON(http.StatusOK, gin.H{
+		"orders":     orders,
+		"nextCursor": nextCursor(ordersOrder, orderCount, limit, lastKeys),
 	})
+}
+
+// Function to get order detail of logged-in user (GET /api/orders/:id)
+// Orders of other users are reported as not found
+func GetOrderHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("GetOrderHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID, err := getOrderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// Get order with items (ownership is checked with user ID from JWT)
+	order, err := getOrderDetail(database.GetDB(), orderID, "id = ? AND user_id = ?", orderID, claims.UserID)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Order retrieval error (ID=%d, UserID=%d): %v", orderID, claims.UserID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
 
 	// Return response as JSON
-	c.JSON(http.StatusOK, gin.H{"orders": orders})
+	c.JSON(http.StatusOK, order)
+}
+
+// Function to cancel order of logged-in user (POST /api/orders/:id/cancel)
+// Unpaid orders expire their Checkout session, paid orders that aren't shipped yet are refunded in full
+func CancelOrderHandler(c *gin.Context) {
+	claims, ok := GetUserFromContext(c)
+	if !ok {
+		log.Println("CancelOrderHandler: User information not found in context")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Authentication required"})
+		return
+	}
+
+	orderID, err := getOrderIDFromParam(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid order ID"})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Start transaction (order row is locked until cancellation is committed)
+	tx, err := db.Begin()
+	if err != nil {
+		log.Printf("Transaction start error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	// Lock order and check ownership (orders of other users are reported as not found)
+	ownerID, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && ownerID != claims.UserID) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Order not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Order state retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	var sessionID, paymentIntentID sql.NullString
+	err = tx.QueryRow("SELECT stripe_session_id, stripe_payment_intent_id FROM orders WHERE id = ?", orderID).Scan(&sessionID, &paymentIntentID)
+	if err != nil {
+		log.Printf("Payment reference retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	var refund *pendingRefund // Sent to payment provider after commit
+	switch {
+	case state.Status == OrderStatusPending && state.PaymentStatus == PaymentStatusUnpaid:
+		// Not paid yet: cancel order and expire Checkout session so payment can no longer be completed
+		// (Session is expired by background job after commit; payment completed before that is refunded by webhook)
+		if err := updateOrderState(tx, orderID, state, OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusUnpaid}); err != nil {
+			log.Printf("Order cancellation error (ID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if err := enqueueCheckoutCleanup(tx, orderID, sessionID.String, ""); err != nil { // Function defined in job.go file
+			log.Printf("Checkout session expiry job registration error (OrderID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		// Stock was only held, so releasing holds restores it
+		if _, err := releaseStockHolds(tx, orderID); err != nil { // Function defined in reservation.go file
+			log.Printf("Stock hold release error (OrderID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+
+	case state.Status == OrderStatusProcessing && state.PaymentStatus == PaymentStatusPaid:
+		// Paid but not shipped: restock items and refund remaining amount
+		if !paymentIntentID.Valid || paymentIntentID.String == "" {
+			log.Printf("Order cancellation error (ID=%d): paid order has no payment reference", orderID)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		refundableAmount, err := getRefundableAmount(tx, orderID) // Function defined in refund.go file
+		if err != nil {
+			log.Printf("Refundable amount retrieval error (ID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		// Cancelled order never keeps payment, so it goes straight to refunding (or refunded if nothing is left to refund)
+		next := OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusRefunding}
+		if refundableAmount <= 0 {
+			next.PaymentStatus = PaymentStatusRefunded
+		}
+		if err := updateOrderState(tx, orderID, state, next); err != nil {
+			log.Printf("Order cancellation error (ID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if err := restockOrderItems(tx, orderID); err != nil {
+			log.Printf("Restock error (OrderID=%d): %v", orderID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if refundableAmount > 0 {
+			// Items were restocked above, so refund is recorded without items (nothing restocked twice)
+			r, err := recordPendingRefund(tx, orderID, paymentIntentID.String, refundableAmount, nil, "requested_by_customer")
+			if err != nil {
+				log.Printf("Refund registration error (OrderID=%d): %v", orderID, err)
+				c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+				return
+			}
+			refund = &r
+		}
+
+	default:
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Order can no longer be cancelled (status: %s, payment: %s)", state.Status, state.PaymentStatus)})
+		return
+	}
+
+	// Commit transaction
+	if err := tx.Commit(); err != nil {
+		log.Printf("Transaction commit error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Refund paid order (cancellation stays committed if refund fails; failed refund is shown on the order)
+	if refund != nil {
+		if _, err := submitPaymentRefund(c.Request.Context(), db, *refund); err != nil { // Function defined in refund.go file
+			log.Printf("Refund creation error (OrderID=%d, RefundID=%d): %v", orderID, refund.ID, err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Order was cancelled, but the refund failed. Please contact support"})
+			return
+		}
+	}
+
+	// Return new order state (payment status changes to refunded once Stripe completes refund)
+	err = db.QueryRow("SELECT status, payment_status FROM orders WHERE id = ?", orderID).Scan(&state.Status, &state.PaymentStatus)
+	if err != nil {
+		log.Printf("Order state retrieval error (ID=%d): %v", orderID, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	log.Printf("Order cancelled by customer (ID=%d, UserID=%d)", orderID, claims.UserID)
+	c.JSON(http.StatusOK, state)
+}
+
+// Function to cancel order whose checkout failed after the order was committed (releases stock holds and coupon use)
+// Jobs undoing payment provider objects are registered in the same transaction, so they only run for cancelled orders
+// Failure is only logged: customer already gets error response, and an open session still expires at its expiry time,
+// which cancels the order through the webhook
+func abandonCheckoutOrder(orderID int64, sessionID string, discountID string) {
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		log.Printf("Abandoned checkout cancellation error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	defer tx.Rollback() // Rollback on function exit (if not committed)
+
+	_, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	if err != nil {
+		log.Printf("Abandoned checkout cancellation error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	if state != (OrderState{Status: OrderStatusPending, PaymentStatus: PaymentStatusUnpaid}) {
+		// Webhook already updated order (e.g. session was paid), so it is kept
+		log.Printf("Abandoned checkout order was already updated (OrderID=%d, Status=%s, Payment=%s)", orderID, state.Status, state.PaymentStatus)
+		return
+	}
+	if err := updateOrderState(tx, orderID, state, OrderState{Status: OrderStatusCancelled, PaymentStatus: PaymentStatusUnpaid}); err != nil {
+		log.Printf("Abandoned checkout cancellation error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	if _, err := releaseStockHolds(tx, orderID); err != nil { // Function defined in reservation.go file
+		log.Printf("Stock hold release error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	if err := enqueueCheckoutCleanup(tx, orderID, sessionID, discountID); err != nil { // Function defined in job.go file
+		log.Printf("Checkout cleanup job registration error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		log.Printf("Abandoned checkout cancellation error (OrderID=%d): %v", orderID, err)
+		return
+	}
+	log.Printf("Order of failed checkout cancelled (ID=%d)", orderID)
+}
+
+// Function to return stock and sales count of order items not refunded yet (order was paid but not shipped)
+func restockOrderItems(tx *sql.Tx, orderID int64) error {
+	items, err := getRefundableItems(tx, orderID) // Function defined in refund.go file
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		if item.Remaining <= 0 {
+			continue
+		}
+		_, err := tx.Exec(
+			"UPDATE products SET stock = stock + ?, sales_count = GREATEST(sales_count - ?, 0) WHERE id = ?",
+			item.Remaining, item.Remaining, item.ProductID,
+		)
+		if err != nil {
+			return err
+		}
+		if item.VariantID.Valid {
+			_, err := tx.Exec("UPDATE product_variants SET stock = stock + ? WHERE id = ?", item.Remaining, item.VariantID.Int64)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
 }
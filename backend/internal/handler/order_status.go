@@ -0,0 +1,175 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Order status (mirrors orders.status ENUM exactly)
+type OrderStatus string
+
+const (
+	OrderStatusPending    OrderStatus = "pending"    // Order created, waiting for payment
+	OrderStatusProcessing OrderStatus = "processing" // Paid, being prepared for shipment
+	OrderStatusShipped    OrderStatus = "shipped"
+	OrderStatusDelivered  OrderStatus = "delivered"
+	OrderStatusCancelled  OrderStatus = "cancelled"
+	OrderStatusRefunded   OrderStatus = "refunded"
+)
+
+// Payment status (mirrors orders.payment_status ENUM exactly)
+type PaymentStatus string
+
+const (
+	PaymentStatusUnpaid     PaymentStatus = "unpaid"
+	PaymentStatusProcessing PaymentStatus = "processing" // Delayed payment method (e.g. bank transfer) in progress
+	PaymentStatusPaid       PaymentStatus = "paid"
+	PaymentStatusFailed     PaymentStatus = "failed"
+	PaymentStatusRefunding  PaymentStatus = "refunding" // Refund requested, waiting for confirmation
+	PaymentStatusRefunded   PaymentStatus = "refunded"
+)
+
+// All order status values (used to validate query parameters)
+var orderStatusValues = []string{
+	string(OrderStatusPending), string(OrderStatusProcessing), string(OrderStatusShipped),
+	string(OrderStatusDelivered), string(OrderStatusCancelled), string(OrderStatusRefunded),
+}
+
+// All payment status values (used to validate query parameters)
+var paymentStatusValues = []string{
+	string(PaymentStatusUnpaid), string(PaymentStatusProcessing), string(PaymentStatusPaid),
+	string(PaymentStatusFailed), string(PaymentStatusRefunding), string(PaymentStatusRefunded),
+}
+
+// Legal order status transitions (statuses not listed as keys are final)
+var orderStatusTransitions = map[OrderStatus][]OrderStatus{
+	OrderStatusPending:    {OrderStatusProcessing, OrderStatusCancelled},
+	OrderStatusProcessing: {OrderStatusShipped, OrderStatusCancelled, OrderStatusRefunded},
+	OrderStatusShipped:    {OrderStatusDelivered, OrderStatusRefunded},
+	OrderStatusDelivered:  {OrderStatusRefunded},
+}
+
+// Legal payment status transitions (statuses not listed as keys are final)
+var paymentStatusTransitions = map[PaymentStatus][]PaymentStatus{
+	PaymentStatusUnpaid:     {PaymentStatusProcessing, PaymentStatusPaid, PaymentStatusFailed, PaymentStatusRefunding}, // Refunding if paid after cancellation
+	PaymentStatusProcessing: {PaymentStatusPaid, PaymentStatusFailed},
+	PaymentStatusPaid:       {PaymentStatusRefunding, PaymentStatusRefunded},
+	PaymentStatusRefunding:  {PaymentStatusRefunded, PaymentStatusPaid}, // Back to paid if refund fails
+}
+
+// Payment statuses each order status can be combined with
+// (e.g. orders are only shipped while paid, and cancelled orders never keep a payment that isn't being refunded)
+var orderStatePaymentStatuses = map[OrderStatus][]PaymentStatus{
+	OrderStatusPending:    {PaymentStatusUnpaid, PaymentStatusProcessing},
+	OrderStatusProcessing: {PaymentStatusPaid, PaymentStatusRefunding},
+	OrderStatusShipped:    {PaymentStatusPaid, PaymentStatusRefunding},
+	OrderStatusDelivered:  {PaymentStatusPaid, PaymentStatusRefunding},
+	OrderStatusCancelled:  {PaymentStatusUnpaid, PaymentStatusFailed, PaymentStatusRefunding, PaymentStatusRefunded},
+	OrderStatusRefunded:   {PaymentStatusRefunded},
+}
+
+// Order state struct (status and payment status change together)
+type OrderState struct {
+	Status        OrderStatus   `json:"status"`
+	PaymentStatus PaymentStatus `json:"paymentStatus"`
+}
+
+// Error returned for transitions not allowed by lifecycle
+type TransitionError struct {
+	From OrderState
+	To   OrderState
+}
+
+func (e *TransitionError) Error() string {
+	return fmt.Sprintf("illegal order transition: %s/%s → %s/%s",
+		e.From.Status, e.From.PaymentStatus, e.To.Status, e.To.PaymentStatus)
+}
+
+// Function to check whether value is one of orders.status ENUM values
+func (s OrderStatus) Valid() bool {
+	switch s {
+	case OrderStatusPending, OrderStatusProcessing, OrderStatusShipped,
+		OrderStatusDelivered, OrderStatusCancelled, OrderStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// Function to check whether order status can change to next
+func (s OrderStatus) CanTransitionTo(next OrderStatus) bool {
+	for _, allowed := range orderStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check whether value is one of orders.payment_status ENUM values
+func (s PaymentStatus) Valid() bool {
+	switch s {
+	case PaymentStatusUnpaid, PaymentStatusProcessing, PaymentStatusPaid,
+		PaymentStatusFailed, PaymentStatusRefunding, PaymentStatusRefunded:
+		return true
+	}
+	return false
+}
+
+// Function to check whether payment status can change to next
+func (s PaymentStatus) CanTransitionTo(next PaymentStatus) bool {
+	for _, allowed := range paymentStatusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to check whether status and payment status can be combined
+func (s OrderState) Valid() bool {
+	for _, allowed := range orderStatePaymentStatuses[s.Status] {
+		if allowed == s.PaymentStatus {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to validate change to next state
+// Each of status and payment status must either stay the same or make a legal transition,
+// at least one of them must change, and next state must be a valid combination
+func (s OrderState) Transition(next OrderState) error {
+	statusOK := s.Status == next.Status || s.Status.CanTransitionTo(next.Status)
+	paymentOK := s.PaymentStatus == next.PaymentStatus || s.PaymentStatus.CanTransitionTo(next.PaymentStatus)
+	if !statusOK || !paymentOK || s == next || !next.Valid() {
+		return &TransitionError{From: s, To: next}
+	}
+	return nil
+}
+
+// Function to lock order row and get its owner and current state
+// Owner is 0 for guest orders that haven't been claimed into an account
+// Returns sql.ErrNoRows if order doesn't exist
+func lockOrderState(tx *sql.Tx, orderID int64) (int, OrderState, error) {
+	var userID sql.NullInt64
+	var state OrderState
+	err := tx.QueryRow(
+		"SELECT user_id, status, payment_status FROM orders WHERE id = ? FOR UPDATE", orderID,
+	).Scan(&userID, &state.Status, &state.PaymentStatus)
+	return int(userID.Int64), state, err
+}
+
+// Function to change order state after validating transition
+// from must be the state read with lockOrderState() in the same transaction
+func updateOrderState(tx *sql.Tx, orderID int64, from OrderState, to OrderState) error {
+	if err := from.Transition(to); err != nil {
+		return err
+	}
+	_, err := tx.Exec(
+		"UPDATE orders SET status = ?, payment_status = ? WHERE id = ?",
+		to.Status, to.PaymentStatus, orderID,
+	)
+	return err
+}
@@ -0,0 +1,49 @@
+package handler
+
+import "testing"
+
+func TestOrderStateTransition(t *testing.T) {
+	tests := []struct {
+		from, to OrderState
+		legal    bool
+	}{
+		// Checkout and payment
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusProcessing, PaymentStatusPaid}, true},
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusPending, PaymentStatusProcessing}, true},
+		{OrderState{OrderStatusPending, PaymentStatusProcessing}, OrderState{OrderStatusCancelled, PaymentStatusFailed}, true},
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusCancelled, PaymentStatusUnpaid}, true},
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusProcessing, PaymentStatusUnpaid}, false},
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusPending, PaymentStatusPaid}, false},
+
+		// Shipping
+		{OrderState{OrderStatusProcessing, PaymentStatusPaid}, OrderState{OrderStatusShipped, PaymentStatusPaid}, true},
+		{OrderState{OrderStatusProcessing, PaymentStatusRefunding}, OrderState{OrderStatusShipped, PaymentStatusRefunding}, true},
+		{OrderState{OrderStatusShipped, PaymentStatusPaid}, OrderState{OrderStatusDelivered, PaymentStatusPaid}, true},
+		{OrderState{OrderStatusProcessing, PaymentStatusPaid}, OrderState{OrderStatusShipped, PaymentStatusRefunded}, false},
+		{OrderState{OrderStatusPending, PaymentStatusUnpaid}, OrderState{OrderStatusShipped, PaymentStatusUnpaid}, false},
+
+		// Cancellation and refunds
+		{OrderState{OrderStatusProcessing, PaymentStatusPaid}, OrderState{OrderStatusCancelled, PaymentStatusRefunding}, true},
+		{OrderState{OrderStatusProcessing, PaymentStatusPaid}, OrderState{OrderStatusCancelled, PaymentStatusPaid}, false},
+		{OrderState{OrderStatusCancelled, PaymentStatusUnpaid}, OrderState{OrderStatusCancelled, PaymentStatusRefunding}, true},
+		{OrderState{OrderStatusCancelled, PaymentStatusUnpaid}, OrderState{OrderStatusCancelled, PaymentStatusPaid}, false},
+		{OrderState{OrderStatusCancelled, PaymentStatusRefunding}, OrderState{OrderStatusCancelled, PaymentStatusRefunded}, true},
+		{OrderState{OrderStatusCancelled, PaymentStatusRefunding}, OrderState{OrderStatusCancelled, PaymentStatusPaid}, false},
+		{OrderState{OrderStatusDelivered, PaymentStatusPaid}, OrderState{OrderStatusDelivered, PaymentStatusRefunding}, true},
+		{OrderState{OrderStatusDelivered, PaymentStatusRefunding}, OrderState{OrderStatusRefunded, PaymentStatusRefunded}, true},
+		{OrderState{OrderStatusDelivered, PaymentStatusRefunding}, OrderState{OrderStatusRefunded, PaymentStatusRefunding}, false},
+		{OrderState{OrderStatusShipped, PaymentStatusPaid}, OrderState{OrderStatusShipped, PaymentStatusRefunded}, false},
+
+		// Final states and no-op changes
+		{OrderState{OrderStatusCancelled, PaymentStatusFailed}, OrderState{OrderStatusProcessing, PaymentStatusPaid}, false},
+		{OrderState{OrderStatusRefunded, PaymentStatusRefunded}, OrderState{OrderStatusShipped, PaymentStatusRefunded}, false},
+		{OrderState{OrderStatusProcessing, PaymentStatusPaid}, OrderState{OrderStatusProcessing, PaymentStatusPaid}, false},
+	}
+	for _, tt := range tests {
+		err := tt.from.Transition(tt.to)
+		if legal := err == nil; legal != tt.legal {
+			t.Errorf("%s/%s → %s/%s: legal = %v, want %v (err: %v)",
+				tt.from.Status, tt.from.PaymentStatus, tt.to.Status, tt.to.PaymentStatus, legal, tt.legal, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Value types of keyset sort keys (used to restore cursor values with correct type)
+const (
+	keyKindInt    = "int"
+	keyKindFloat  = "float"
+	keyKindString = "string"
+	keyKindTime   = "time"
+)
+
+// Keyset sort key struct (one ORDER BY expression)
+type keysetKey struct {
+	Expr   string        // SQL expression (e.g. "p.created_at")
+	Kind   string        // Value type of expression
+	Params []interface{} // Parameters for placeholders in Expr (e.g. MATCH ... AGAINST (?))
+}
+
+// Keyset sort order struct
+// The last key must be unique (primary key) so that every row has a distinct position
+type keysetOrder struct {
+	Name string      // Sort order name (a cursor is only valid for the order it was issued for)
+	Keys []keysetKey // Sort keys in priority order
+	Desc bool        // All keys are sorted in the same direction
+}
+
+// Cursor payload struct (position of last item on previous page)
+type pageCursor struct {
+	Order  string   `json:"o"`
+	Values []string `json:"v"`
+}
+
+// Error returned for malformed or mismatched cursors
+var errInvalidCursor = errors.New("invalid cursor")
+
+// Function to build ORDER BY clause and its parameters
+func (o keysetOrder) orderBy() (string, []interface{}) {
+	direction := "ASC"
+	if o.Desc {
+		direction = "DESC"
+	}
+	exprs := make([]string, len(o.Keys))
+	params := []interface{}{}
+	for i, key := range o.Keys {
+		exprs[i] = key.Expr + " " + direction
+		params = append(params, key.Params...)
+	}
+	return "ORDER BY " + strings.Join(exprs, ", "), params
+}
+
+// Function to build SELECT columns returning sort key values (appended to select list)
+func (o keysetOrder) selectColumns() (string, []interface{}) {
+	columns := ""
+	params := []interface{}{}
+	for i, key := range o.Keys {
+		columns += fmt.Sprintf(", %s AS sort_key_%d", key.Expr, i)
+		params = append(params, key.Params...)
+	}
+	return columns, params
+}
+
+// Function to build condition selecting rows after cursor position
+// Uses row constructor comparison: (a, b, id) < (?, ?, ?)
+func (o keysetOrder) after(encoded string) (sqlCondition, error) {
+	cur, err := decodeCursor(encoded)
+	if err != nil {
+		return sqlCondition{}, err
+	}
+	if cur.Order != o.Name || len(cur.Values) != len(o.Keys) {
+		return sqlCondition{}, errInvalidCursor
+	}
+
+	exprs := make([]string, len(o.Keys))
+	placeholders := make([]string, len(o.Keys))
+	params := []interface{}{}
+	values := []interface{}{}
+	for i, key := range o.Keys {
+		exprs[i] = key.Expr
+		placeholders[i] = "?"
+		params = append(params, key.Params...)
+		value, err := parseKeyValue(key.Kind, cur.Values[i])
+		if err != nil {
+			return sqlCondition{}, errInvalidCursor
+		}
+		values = append(values, value)
+	}
+
+	operator := ">"
+	if o.Desc {
+		operator = "<"
+	}
+	return sqlCondition{
+		Clause: fmt.Sprintf("(%s) %s (%s)", strings.Join(exprs, ", "), operator, strings.Join(placeholders, ", ")),
+		Params: append(params, values...),
+	}, nil
+}
+
+// Function to create cursor from sort key values scanned from last row of page
+func (o keysetOrder) cursorFor(values []interface{}) string {
+	cur := pageCursor{Order: o.Name, Values: make([]string, len(values))}
+	for i, v := range values {
+		cur.Values[i] = formatKeyValue(v)
+	}
+	data, _ := json.Marshal(cur)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// Function to decode opaque cursor string
+func decodeCursor(encoded string) (pageCursor, error) {
+	var cur pageCursor
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return cur, errInvalidCursor
+	}
+	if err := json.Unmarshal(data, &cur); err != nil {
+		return cur, errInvalidCursor
+	}
+	return cur, nil
+}
+
+// Function to convert scanned sort key value to string stored in cursor
+func formatKeyValue(v interface{}) string {
+	switch val := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(val)
+	case string:
+		return val
+	case int64:
+		return strconv.FormatInt(val, 10)
+	case float64:
+		return strconv.FormatFloat(val, 'g', -1, 64)
+	case time.Time:
+		return val.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(val)
+	}
+}
+
+// Function to restore sort key value from cursor string as SQL parameter
+func parseKeyValue(kind string, s string) (interface{}, error) {
+	switch kind {
+	case keyKindInt:
+		return strconv.ParseInt(s, 10, 64)
+	case keyKindFloat:
+		return strconv.ParseFloat(s, 64)
+	case keyKindTime:
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return s, nil
+	}
+}
+
+// Function to create cursor for next page (nil if there is no next page)
+// rowCount is number of rows fetched with LIMIT limit+1, lastKeys are sort key values of last row returned
+func nextCursor(order keysetOrder, rowCount int, limit int, lastKeys []interface{}) *string {
+	if rowCount <= limit || lastKeys == nil {
+		return nil
+	}
+	cur := order.cursorFor(lastKeys)
+	return &cur
+}
@@ -6,12 +6,13 @@ import (
 	"log"
 	"math"
 	"net/http"
-	"strconv"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/search"
 )
 
 // --- 1. Type Definitions (structs) ---
@@ -22,7 +23,8 @@ import (
 type ProductListItem struct {
 	ID          int       `json:"id"`
 	Name        string    `json:"name"`
-	Price       int       `json:"price"`
+	Price       int       `json:"price"`    // In minor units of currency
+	Currency    string    `json:"currency"` // ISO 4217 code
 	Stock       int       `json:"stock"`
 	ImageURL    *string   `json:"image_url"`
 	ReviewAvg   float64   `json:"review_avg"`
@@ -32,16 +34,20 @@ type ProductListItem struct {
 
 // Product detail struct
 type Product struct {
-	ID          int       `json:"id"`
-	Name        string    `json:"name"`
-	Description *string   `json:"description"` // Nullable
-	Price       int       `json:"price"`
-	Stock       int       `json:"stock"`
-	ImageURL    *string   `json:"image_url"` // Nullable
-	SalesCount  int       `json:"sales_count"`
-	IsFeatured  bool      `json:"is_featured"`
-	CreatedAt   time.Time `json:"created_at"`
-	UpdatedAt   time.Time `json:"updated_at"`
+	ID          int               `json:"id"`
+	Name        string            `json:"name"`
+	Description *string           `json:"description"` // Nullable
+	Price       int               `json:"price"`       // In minor units of currency
+	Currency    string            `json:"currency"`    // ISO 4217 code
+	Stock       int               `json:"stock"`
+	ImageURL    *string           `json:"image_url"` // Nullable
+	SalesCount  int               `json:"sales_count"`
+	IsFeatured  bool              `json:"is_featured"`
+	Categories  []CategorySummary `json:"categories"` // Type defined in category.go file
+	Options     ProductOptions    `json:"options"`    // Option axes offered by variants (type defined in variant.go file)
+	Variants    []ProductVariant  `json:"variants"`   // Empty for products sold without variants
+	CreatedAt   time.Time         `json:"created_at"`
+	UpdatedAt   time.Time         `json:"updated_at"`
 }
 
 // Pagination information struct
@@ -55,14 +61,17 @@ type Pagination struct {
 // Product list page response struct
 type ProductsPageData struct {
 	Products   []ProductListItem `json:"products"`
-	Pagination Pagination        `json:"pagination"`
+	Pagination *Pagination       `json:"pagination,omitempty"` // Page mode only
+	NextCursor *string           `json:"nextCursor,omitempty"` // Cursor mode only (omitted on last page)
+	Facets     *ProductFacets    `json:"facets,omitempty"`     // Omitted on subsequent cursor pages (type defined in product_filter.go file)
 }
 
 // Homepage product struct
 type HomePageProduct struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
-	Price       int     `json:"price"`
+	Price       int     `json:"price"`    // In minor units of currency
+	Currency    string  `json:"currency"` // ISO 4217 code
 	ImageURL    *string `json:"image_url"`
 	ReviewAvg   float64 `json:"review_avg"`
 	ReviewCount int     `json:"review_count"`
@@ -75,95 +84,249 @@ type HomePageData struct {
 	BestSellers []HomePageProduct `json:"bestSellers"`
 }
 
+// Valid values for sort query parameter of product list
+var productSortOptions = []string{"new", "priceAsc", "priceDesc", "popular", "rating", "name", "relevance"}
+
+// Function to return keyset sort order for sort query parameter
+// p.id is added as tie-breaker so products with equal sort values keep a stable order across pages
+// Returns false for unknown sort values
+func productSortOrder(sort string, booleanQuery string) (keysetOrder, bool) {
+	id := keysetKey{Expr: "p.id", Kind: keyKindInt}
+	createdAt := keysetKey{Expr: "p.created_at", Kind: keyKindTime}
+	switch sort {
+	case "priceAsc": // Price low to high
+		return keysetOrder{Name: sort, Keys: []keysetKey{{Expr: "p.price", Kind: keyKindInt}, id}}, true
+	case "priceDesc": // Price high to low
+		return keysetOrder{Name: sort, Keys: []keysetKey{{Expr: "p.price", Kind: keyKindInt}, id}, Desc: true}, true
+	case "new": // New arrivals
+		return keysetOrder{Name: sort, Keys: []keysetKey{createdAt, id}, Desc: true}, true
+	case "popular": // Best sellers
+		return keysetOrder{Name: sort, Keys: []keysetKey{{Expr: "p.sales_count", Kind: keyKindInt}, id}, Desc: true}, true
+	case "rating": // Highest rated (ties broken by number of reviews)
+		return keysetOrder{Name: sort, Keys: []keysetKey{
+			{Expr: "COALESCE(rs.review_avg, 0)", Kind: keyKindFloat},
+			{Expr: "COALESCE(rs.review_count, 0)", Kind: keyKindInt},
+			id,
+		}, Desc: true}, true
+	case "name": // Alphabetical
+		return keysetOrder{Name: sort, Keys: []keysetKey{{Expr: "p.name", Kind: keyKindString}, id}}, true
+	case "relevance": // Best match for search keyword (new arrivals if there is nothing to rank)
+		if booleanQuery == "" {
+			return keysetOrder{Name: "new", Keys: []keysetKey{createdAt, id}, Desc: true}, true
+		}
+		relevance := keysetKey{
+			Expr:   "MATCH(p.name, p.description) AGAINST (? IN BOOLEAN MODE)",
+			Kind:   keyKindFloat,
+			Params: []interface{}{booleanQuery},
+		}
+		return keysetOrder{Name: sort, Keys: []keysetKey{relevance, createdAt, id}, Desc: true}, true
+	default:
+		return keysetOrder{}, false
+	}
+}
+
 // --- 2. Handler Definitions ---
 
 // Function to return product list
 func GetProductsHandler(c *gin.Context) {
 
-	// Get "page number" from query parameter (?page=X)
-	// Set default to 1 if query parameter doesn't exist or has invalid value
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
-	}
+	// Parse query parameters (invalid values are rejected with 400 naming the offending parameter)
+	// ?page=X&perPage=Y for page mode, ?cursor=X&limit=Y for cursor mode (enabled by either parameter)
+	params := newQueryParser(c)
+	list := params.listParams(16)
 
-	// Get "items per page" from query parameter (?perPage=X)
-	// Set default to 16 if query parameter doesn't exist or has invalid value
-	perPageStr := c.DefaultQuery("perPage", "16")
-	perPage, err := strconv.Atoi(perPageStr)
-	if err != nil || perPage < 1 {
-		perPage = 16
-	}
+	// Get "search keyword" from query parameter (?keyword=X)
+	// Multiple words are combined with AND, "quoted text" is matched as a phrase
+	keyword := c.DefaultQuery("keyword", "")
+	searchQuery := search.Parse(keyword)
+	booleanQuery := searchQuery.BooleanMode()
 
 	// Get "sort order" from query parameter (?sort=X) (default is new arrivals)
-	sort := c.DefaultQuery("sort", "new")
+	// Unknown values are rejected instead of silently falling back to default order
+	sort := params.enumParam("sort", "new", productSortOptions)
 
-	// Build sort condition (ORDER BY clause)
-	var orderByClause string
-	switch sort {
-	case "priceAsc": // Price low to high
-		orderByClause = "ORDER BY p.price ASC"
-	case "new": // New arrivals
-		orderByClause = "ORDER BY p.created_at DESC"
-	default:
-		// Default to new arrivals for any other value
-		orderByClause = "ORDER BY p.created_at DESC"
-	}
+	// Get filters from query parameters
+	// Prices are given in major units of store currency (e.g. ?minPrice=12.50) and compared in minor units
+	minPrice, hasMinPrice := params.optionalAmount("minPrice", StoreCurrency) // ?minPrice=X (inclusive)
+	maxPrice, hasMaxPrice := params.optionalAmount("maxPrice", StoreCurrency) // ?maxPrice=Y (inclusive)
+	inStock, _ := params.optionalBool("inStock")                              // ?inStock=true
+	minRating, hasMinRating := params.optionalFloat("minRating", 0, 5)        // ?minRating=X
+	featured, hasFeatured := params.optionalBool("featured")                  // ?featured=true or ?featured=false
 
-	// Get "search keyword" from query parameter (?keyword=X)
-	keyword := c.DefaultQuery("keyword", "")
+	// Build sort condition (ORDER BY clause)
+	order, _ := productSortOrder(sort, booleanQuery)
+	orderByClause, orderParams := order.orderBy()
 
-	// Build search condition (WHERE clause)
-	var whereClause string
-	var whereParams []interface{} // Slice to store parameters for WHERE clause
-	if keyword != "" {
-		whereClause = "WHERE (p.name LIKE ? OR p.description LIKE ?)"
-		// Add parameter (%keyword%) to slice
-		likeKeyword := "%" + keyword + "%"
-		whereParams = append(whereParams, likeKeyword, likeKeyword)
+	// Build condition selecting rows after cursor position (cursor must match sort order)
+	var cursorCond *sqlCondition
+	if list.Cursor != "" {
+		cond, err := order.after(list.Cursor)
+		if err != nil {
+			params.invalidCursor()
+		}
+		cursorCond = &cond
+	}
+	if params.failed() {
+		return
 	}
 
 	// Get database connection
 	db := database.GetDB()
 
-	// Execute SQL query to get total product count
+	// Build search conditions (WHERE clause)
+	var conditions []sqlCondition // Slice to store conditions joined with AND (type defined in product_filter.go file)
+	if booleanQuery != "" {
+		// Search with FULLTEXT index (ft_products_name_description)
+		conditions = append(conditions, sqlCondition{
+			Clause: "MATCH(p.name, p.description) AGAINST (? IN BOOLEAN MODE)",
+			Params: []interface{}{booleanQuery},
+		})
+	}
+	for _, term := range searchQuery.ShortTerms {
+		// Words and phrases shorter than FULLTEXT minimum token length are matched with LIKE
+		likeTerm := "%" + term + "%"
+		conditions = append(conditions, sqlCondition{
+			Clause: "(p.name LIKE ? OR p.description LIKE ?)",
+			Params: []interface{}{likeTerm, likeTerm},
+		})
+	}
+
+	// Get "category" from query parameter (?category=X, ID or slug)
+	// Products in descendant categories are also included
+	if category := c.Query("category"); category != "" {
+		categoryIDs, err := resolveCategoryFilter(db, category)
+		if err != nil {
+			log.Printf("Category filter resolution error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		if categoryIDs == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+			return
+		}
+		placeholders := strings.Repeat("?,", len(categoryIDs)-1) + "?"
+		cond := sqlCondition{Clause: fmt.Sprintf(
+			"EXISTS (SELECT 1 FROM product_categories AS pc WHERE pc.product_id = p.id AND pc.category_id IN (%s))",
+			placeholders,
+		)}
+		for _, id := range categoryIDs {
+			cond.Params = append(cond.Params, id)
+		}
+		conditions = append(conditions, cond)
+	}
+
+	// Add filter conditions
+	if hasMinPrice {
+		conditions = append(conditions, sqlCondition{Facet: facetPrice, Clause: "p.price >= ?", Params: []interface{}{minPrice}})
+	}
+	if hasMaxPrice {
+		conditions = append(conditions, sqlCondition{Facet: facetPrice, Clause: "p.price <= ?", Params: []interface{}{maxPrice}})
+	}
+	if inStock {
+		conditions = append(conditions, sqlCondition{Clause: "p.stock > 0"})
+	}
+	if hasMinRating {
+		conditions = append(conditions, sqlCondition{Facet: facetRating, Clause: "COALESCE(rs.review_avg, 0) >= ?", Params: []interface{}{minRating}})
+	}
+	if hasFeatured {
+		conditions = append(conditions, sqlCondition{Clause: "p.is_featured = ?", Params: []interface{}{featured}})
+	}
+
+	whereClause, whereParams := buildWhereClause(conditions, "")
+
+	// Get total product count and facet counts with concurrent processing
+	// (Skipped on subsequent cursor pages, where the client already has them)
 	var totalItems int
-	countQuery := fmt.Sprintf("SELECT COUNT(*) FROM products AS p %s", whereClause)
+	facets := ProductFacets{Currency: StoreCurrency}
+	var countErr, priceFacetErr, ratingFacetErr error
+	var wg sync.WaitGroup
+	firstCursorPage := list.CursorMode && list.Cursor == ""
 
-	// Expand slice contents with whereParams... and pass to QueryRow() method
-	err = db.QueryRow(countQuery, whereParams...).Scan(&totalItems)
-	if err != nil {
-		log.Printf("Product count retrieval error: %v", err)
+	if !list.CursorMode || firstCursorPage {
+		wg.Add(2)
+
+		// Goroutine 1: Get product count per price bucket
+		go func() {
+			defer wg.Done()
+			facets.Price, priceFacetErr = countPriceFacets(db, conditions)
+			if priceFacetErr != nil {
+				log.Printf("Price facet retrieval error: %v", priceFacetErr)
+			}
+		}()
+
+		// Goroutine 2: Get product count per rating tier
+		go func() {
+			defer wg.Done()
+			facets.Rating, ratingFacetErr = countRatingFacets(db, conditions)
+			if ratingFacetErr != nil {
+				log.Printf("Rating facet retrieval error: %v", ratingFacetErr)
+			}
+		}()
+	}
+
+	if !list.CursorMode {
+		wg.Add(1)
+
+		// Goroutine 3: Get total product count (page mode only)
+		go func() {
+			defer wg.Done()
+			countQuery := fmt.Sprintf("SELECT COUNT(*) %s %s", productListFrom, whereClause)
+			// Expand slice contents with whereParams... and pass to QueryRow() method
+			countErr = db.QueryRow(countQuery, whereParams...).Scan(&totalItems)
+			if countErr != nil {
+				log.Printf("Product count retrieval error: %v", countErr)
+			}
+		}()
+	}
+
+	// Wait for all goroutines to complete
+	wg.Wait()
+	if countErr != nil || priceFacetErr != nil || ratingFacetErr != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 		return
 	}
 
-	// Calculate pagination information
-	totalPages := int(math.Ceil(float64(totalItems) / float64(perPage)))
-	offset := (page - 1) * perPage
+	// Build LIMIT clause
+	// Page mode skips rows with OFFSET, cursor mode starts right after last row of previous page
+	// and fetches one extra row to know whether a next page exists
+	listWhereClause, listWhereParams := whereClause, whereParams
+	limitClause := "LIMIT ? OFFSET ?"
+	limitParams := []interface{}{list.PerPage, (list.Page - 1) * list.PerPage}
+	if list.CursorMode {
+		listConditions := conditions
+		if cursorCond != nil {
+			listConditions = append(append([]sqlCondition{}, conditions...), *cursorCond)
+		}
+		listWhereClause, listWhereParams = buildWhereClause(listConditions, "")
+		limitClause = "LIMIT ?"
+		limitParams = []interface{}{list.Limit + 1}
+	}
 
-	// Prepare SQL query to get product list
+	// Prepare SQL query to get product list (sort key values are also selected to build next cursor)
+	sortKeyColumns, sortKeyParams := order.selectColumns()
 	query := fmt.Sprintf(`
 			SELECT
 				p.id,
 				p.name,
 				p.price,
+				p.currency,
 				p.stock,
 				p.image_url,
 				p.updated_at,
-				COALESCE(ROUND(AVG(r.score), 1), 0.0) AS review_avg,
-				COALESCE(COUNT(r.id), 0) AS review_count
-			FROM products AS p
-			LEFT JOIN reviews AS r ON p.id = r.product_id
+				COALESCE(rs.review_avg, 0.0) AS review_avg,
+				COALESCE(rs.review_count, 0) AS review_count
+				%s
 			%s
-			GROUP BY p.id, p.name, p.price, p.stock, p.image_url, p.updated_at
 			%s
-			LIMIT ? OFFSET ?
-		`, whereClause, orderByClause)
+			%s
+			%s
+		`, sortKeyColumns, productListFrom, listWhereClause, orderByClause, limitClause)
 
-	// Prepare parameters to pass to SQL query
-	queryParams := append(whereParams, perPage, offset)
+	// Prepare parameters to pass to SQL query (in order of placeholders)
+	queryParams := append([]interface{}{}, sortKeyParams...)
+	queryParams = append(queryParams, listWhereParams...)
+	queryParams = append(queryParams, orderParams...)
+	queryParams = append(queryParams, limitParams...)
 
 	// Execute SQL query
 	rows, err := db.Query(query, queryParams...)
@@ -176,51 +339,71 @@ func GetProductsHandler(c *gin.Context) {
 
 	// Slice to store product data
 	products := []ProductListItem{}
+	rowCount := 0
+	var lastKeys []interface{} // Sort key values of last product in response
 
 	// Scan SQL query results
 	for rows.Next() {
+		rowCount++
 		var p ProductListItem
 		// Use sql.NullString variable imageUrl to handle NULL image_url column
 		var imageUrl sql.NullString
-		// Map retrieved data to ProductListItem struct fields
-		// Scan image_url column into imageUrl variable
-		if err := rows.Scan(
+		sortKeys := make([]interface{}, len(order.Keys))
+		dest := []interface{}{
 			&p.ID,
 			&p.Name,
 			&p.Price,
+			&p.Currency,
 			&p.Stock,
 			&imageUrl,
 			&p.UpdatedAt,
 			&p.ReviewAvg,
 			&p.ReviewCount,
-		); err != nil {
+		}
+		for i := range sortKeys {
+			dest = append(dest, &sortKeys[i])
+		}
+		// Map retrieved data to ProductListItem struct fields
+		// Scan image_url column into imageUrl variable
+		if err := rows.Scan(dest...); err != nil {
 			log.Printf("Product data scan error: %v", err)
 			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 			return
 		}
+		// Extra row fetched in cursor mode only signals that a next page exists
+		if list.CursorMode && rowCount > list.Limit {
+			continue
+		}
 		// Only set ProductListItem ImageURL field if imageUrl variable is not NULL
 		if imageUrl.Valid {
 			p.ImageURL = &imageUrl.String
 		}
 		products = append(products, p)
+		lastKeys = sortKeys
 	}
 	if err = rows.Err(); err != nil {
 		log.Printf("Row error during product list data retrieval: %v", err)
 		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
 		return
 	}
-	// Create pagination information
-	pagination := Pagination{
-		CurrentPage: page,       // Current page
-		PerPage:     perPage,    // Items per page
-		TotalItems:  totalItems, // Total products
-		TotalPages:  totalPages, // Total pages
-	}
 
 	// Assemble final response
-	response := ProductsPageData{
-		Products:   products,
-		Pagination: pagination,
+	response := ProductsPageData{Products: products}
+	if list.CursorMode {
+		response.NextCursor = nextCursor(order, rowCount, list.Limit, lastKeys)
+		if firstCursorPage {
+			response.Facets = &facets
+		}
+	} else {
+		// Create pagination information
+		totalPages := int(math.Ceil(float64(totalItems) / float64(list.PerPage)))
+		response.Pagination = &Pagination{
+			CurrentPage: list.Page,    // Current page
+			PerPage:     list.PerPage, // Items per page
+			TotalItems:  totalItems,   // Total products
+			TotalPages:  totalPages,   // Total pages
+		}
+		response.Facets = &facets
 	}
 
 	// Return response as JSON
@@ -244,6 +427,7 @@ func GetProductByIDHandler(c *gin.Context) {
 			id, name,
 			description,
 			price,
+			currency,
 			stock,
 			image_url,
 			sales_count,
@@ -263,6 +447,7 @@ func GetProductByIDHandler(c *gin.Context) {
 		&p.Name,
 		&description,
 		&p.Price,
+		&p.Currency,
 		&p.Stock,
 		&imageUrl,
 		&p.SalesCount,
@@ -290,6 +475,23 @@ func GetProductByIDHandler(c *gin.Context) {
 		p.ImageURL = &imageUrl.String
 	}
 
+	// Get categories assigned to product
+	p.Categories, err = getProductCategories(db, id)
+	if err != nil {
+		log.Printf("Product categories retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Get variants of product and option axes offered by them
+	p.Variants, err = getProductVariants(db, id, p.Price)
+	if err != nil {
+		log.Printf("Product variants retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	p.Options = collectProductOptions(p.Variants)
+
 	// Return response as JSON
 	c.JSON(http.StatusOK, p)
 }
@@ -317,6 +519,7 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				id,
 				name,
 				price,
+				currency,
 				image_url
 			FROM products
 			ORDER BY sales_count DESC
@@ -337,6 +540,7 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				&p.ID,
 				&p.Name,
 				&p.Price,
+				&p.Currency,
 				&imageUrl,
 			); err != nil {
 				log.Printf("Featured products scan error: %v", err)
@@ -361,12 +565,13 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				p.id,
 				p.name,
 				p.price,
+				p.currency,
 				p.image_url,
 				COALESCE(ROUND(AVG(r.score), 1), 0.0) AS review_avg,
 				COALESCE(COUNT(r.id), 0) AS review_count
 			FROM products AS p
 			LEFT JOIN reviews AS r ON p.id = r.product_id
-			GROUP BY p.id, p.name, p.price, p.image_url, p.created_at
+			GROUP BY p.id, p.name, p.price, p.currency, p.image_url, p.created_at
 			ORDER BY p.created_at DESC
 			LIMIT 4
 		`
@@ -385,6 +590,7 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				&p.ID,
 				&p.Name,
 				&p.Price,
+				&p.Currency,
 				&imageUrl,
 				&p.ReviewAvg,
 				&p.ReviewCount,
@@ -410,13 +616,14 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				p.id,
 				p.name,
 				p.price,
+				p.currency,
 				p.image_url,
 				COALESCE(ROUND(AVG(r.score), 1), 0.0) AS review_avg,
 				COALESCE(COUNT(r.id), 0) AS review_count
 			FROM products AS p
 			LEFT JOIN reviews AS r ON p.id = r.product_id
 			WHERE p.is_featured = true
-			GROUP BY p.id, p.name, p.price, p.image_url
+			GROUP BY p.id, p.name, p.price, p.currency, p.image_url
 			ORDER BY RAND()
 			LIMIT 4
 		`
@@ -435,6 +642,7 @@ func GetHomePageProductsHandler(c *gin.Context) {
 				&p.ID,
 				&p.Name,
 				&p.Price,
+				&p.Currency,
 				&imageUrl,
 				&p.ReviewAvg,
 				&p.ReviewCount,
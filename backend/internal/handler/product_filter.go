@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/yukaty/go-trailhead/backend/internal/money"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// WHERE condition struct for product list query
+type sqlCondition struct {
+	Facet  string        // Facet dimension filtered by this condition ("price", "rating"), empty for others
+	Clause string        // SQL expression (e.g. "p.price >= ?")
+	Params []interface{} // Parameters for placeholders in Clause
+}
+
+// Price bucket definition and count struct
+// Bounds are in minor units of store currency, like product prices
+type PriceBucket struct {
+	Min   int  `json:"min"`
+	Max   *int `json:"max"` // Exclusive upper bound (null for the highest bucket)
+	Count int  `json:"count"`
+}
+
+// Rating tier count struct ("N stars & up")
+type RatingTier struct {
+	MinRating int `json:"minRating"`
+	Count     int `json:"count"`
+}
+
+// Facet counts struct returned with product list
+type ProductFacets struct {
+	Currency money.Currency `json:"currency"` // Currency of price bucket bounds
+	Price    []PriceBucket  `json:"price"`
+	Rating   []RatingTier   `json:"rating"`
+}
+
+// Facet dimension names
+const (
+	facetPrice  = "price"
+	facetRating = "rating"
+)
+
+// Lower bounds of price buckets in major units of store currency (each bucket ends where the next one starts)
+var priceBucketBounds = []int{0, 50, 100, 200, 500}
+
+// Rating tiers shown in filter sidebar
+var ratingTiers = []int{4, 3, 2, 1}
+
+// FROM clause shared by product list, count and facet queries
+// (Review statistics are aggregated in a derived table so the outer query needs no GROUP BY)
+const productListFrom = `
+	FROM products AS p
+	LEFT JOIN (
+		SELECT product_id, ROUND(AVG(score), 1) AS review_avg, COUNT(*) AS review_count
+		FROM reviews
+		GROUP BY product_id
+	) AS rs ON p.id = rs.product_id
+`
+
+// Function to build WHERE clause from conditions
+// Conditions for excludeFacet are skipped (so facet counts ignore their own filter)
+func buildWhereClause(conditions []sqlCondition, excludeFacet string) (string, []interface{}) {
+	clauses := []string{}
+	params := []interface{}{}
+	for _, cond := range conditions {
+		if excludeFacet != "" && cond.Facet == excludeFacet {
+			continue
+		}
+		clauses = append(clauses, cond.Clause)
+		params = append(params, cond.Params...)
+	}
+	if len(clauses) == 0 {
+		return "", params
+	}
+	return "WHERE " + strings.Join(clauses, " AND "), params
+}
+
+// Function to get lower bounds of price buckets in minor units of currency
+func priceBucketMinorBounds(currency money.Currency) []int {
+	unit := 1
+	for i := 0; i < currency.Exponent(); i++ {
+		unit *= 10
+	}
+	bounds := make([]int, len(priceBucketBounds))
+	for i, bound := range priceBucketBounds {
+		bounds[i] = bound * unit
+	}
+	return bounds
+}
+
+// Function to count products in each price bucket (bounds in minor units of store currency)
+func countPriceFacets(db *sql.DB, conditions []sqlCondition) ([]PriceBucket, error) {
+	bounds := priceBucketMinorBounds(StoreCurrency)
+	buckets := make([]PriceBucket, len(bounds))
+	columns := make([]string, len(bounds))
+	for i, min := range bounds {
+		buckets[i].Min = min
+		if i+1 < len(bounds) {
+			max := bounds[i+1]
+			buckets[i].Max = &max
+			columns[i] = fmt.Sprintf("COALESCE(SUM(p.price >= %d AND p.price < %d), 0)", min, max)
+		} else {
+			columns[i] = fmt.Sprintf("COALESCE(SUM(p.price >= %d), 0)", min)
+		}
+	}
+
+	whereClause, params := buildWhereClause(conditions, facetPrice)
+	query := fmt.Sprintf("SELECT %s %s %s", strings.Join(columns, ", "), productListFrom, whereClause)
+
+	dest := make([]interface{}, len(buckets))
+	for i := range buckets {
+		dest[i] = &buckets[i].Count
+	}
+	if err := db.QueryRow(query, params...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	return buckets, nil
+}
+
+// Function to count products in each rating tier
+func countRatingFacets(db *sql.DB, conditions []sqlCondition) ([]RatingTier, error) {
+	tiers := make([]RatingTier, len(ratingTiers))
+	columns := make([]string, len(ratingTiers))
+	for i, min := range ratingTiers {
+		tiers[i].MinRating = min
+		columns[i] = fmt.Sprintf("COALESCE(SUM(COALESCE(rs.review_avg, 0) >= %d), 0)", min)
+	}
+
+	whereClause, params := buildWhereClause(conditions, facetRating)
+	query := fmt.Sprintf("SELECT %s %s %s", strings.Join(columns, ", "), productListFrom, whereClause)
+
+	dest := make([]interface{}, len(tiers))
+	for i := range tiers {
+		dest[i] = &tiers[i].Count
+	}
+	if err := db.QueryRow(query, params...).Scan(dest...); err != nil {
+		return nil, err
+	}
+	return tiers, nil
+}
@@ -0,0 +1,258 @@
+package handler
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/money"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Query parameter validation error struct (returned as 400 response body)
+type QueryParamError struct {
+	Message       string   `json:"error"`                   // Human-readable message (same key as other error responses)
+	Field         string   `json:"field"`                   // Name of offending query parameter
+	Code          string   `json:"code"`                    // Machine-readable reason (see constants below)
+	AllowedValues []string `json:"allowedValues,omitempty"` // Valid values for enumerated parameters
+	Min           *float64 `json:"min,omitempty"`           // Lower bound for numeric parameters
+	Max           *float64 `json:"max,omitempty"`           // Upper bound for numeric parameters
+}
+
+// Validation error codes
+const (
+	ParamCodeInvalid      = "invalid"       // Value has wrong format
+	ParamCodeOutOfRange   = "out_of_range"  // Numeric value is outside allowed range
+	ParamCodeUnknownValue = "unknown_value" // Value is not one of allowed values
+)
+
+func (e *QueryParamError) Error() string {
+	return e.Message
+}
+
+// Common list query parameters struct
+// Page mode uses page/perPage, cursor mode (enabled by ?cursor= or ?limit=) uses cursor/limit
+type listParams struct {
+	Page       int
+	PerPage    int
+	Cursor     string
+	Limit      int
+	CursorMode bool
+}
+
+// Maximum items per page for list endpoints (override with MAX_PER_PAGE environment variable)
+var MaxPerPage = getEnvInt("MAX_PER_PAGE", 100)
+
+// Maximum page number for page mode, limiting OFFSET depth (override with MAX_PAGE environment variable)
+// Deeper pages should be fetched with cursor pagination
+var MaxPage = getEnvInt("MAX_PAGE", 1000)
+
+// Function to read positive integer from environment variable
+// Returns defaultValue if variable is not set or invalid
+func getEnvInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return defaultValue
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		log.Printf("Warning: %s environment variable is invalid (%q), using %d", name, value, defaultValue)
+		return defaultValue
+	}
+	return n
+}
+
+// Query parameter parser struct
+// Keeps the first validation error, so handlers parse all parameters and check once with failed()
+type queryParser struct {
+	c   *gin.Context
+	err *QueryParamError
+}
+
+// Function to create query parameter parser for request
+func newQueryParser(c *gin.Context) *queryParser {
+	return &queryParser{c: c}
+}
+
+// Function to record validation error (only the first error is kept)
+func (p *queryParser) fail(e *QueryParamError) {
+	if p.err == nil {
+		p.err = e
+	}
+}
+
+// Function to build range error for numeric parameter
+func rangeError(name string, min, max float64, kind string) *QueryParamError {
+	return &QueryParamError{
+		Message: fmt.Sprintf("%s must be %s between %s and %s", name, kind,
+			strconv.FormatFloat(min, 'f', -1, 64), strconv.FormatFloat(max, 'f', -1, 64)),
+		Field: name,
+		Code:  ParamCodeOutOfRange,
+		Min:   &min,
+		Max:   &max,
+	}
+}
+
+// Function to get optional integer parameter within [min, max]
+// Returns false if parameter is absent or invalid
+func (p *queryParser) optionalInt(name string, min, max int) (int, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		p.fail(&QueryParamError{Message: fmt.Sprintf("%s must be an integer", name), Field: name, Code: ParamCodeInvalid})
+		return 0, false
+	}
+	if n < min || n > max {
+		p.fail(rangeError(name, float64(min), float64(max), "an integer"))
+		return 0, false
+	}
+	return n, true
+}
+
+// Function to get integer parameter within [min, max], or defaultValue if absent
+func (p *queryParser) intParam(name string, defaultValue, min, max int) int {
+	if n, ok := p.optionalInt(name, min, max); ok {
+		return n
+	}
+	return defaultValue
+}
+
+// Function to get optional number parameter within [min, max]
+// Returns false if parameter is absent or invalid
+func (p *queryParser) optionalFloat(name string, min, max float64) (float64, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return 0, false
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		p.fail(&QueryParamError{Message: fmt.Sprintf("%s must be a number", name), Field: name, Code: ParamCodeInvalid})
+		return 0, false
+	}
+	if f < min || f > max {
+		p.fail(rangeError(name, min, max, "a number"))
+		return 0, false
+	}
+	return f, true
+}
+
+// Function to get optional amount parameter in major units of currency (e.g. "12.50")
+// Returns amount in minor units, or false if parameter is absent or invalid
+func (p *queryParser) optionalAmount(name string, currency money.Currency) (int, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return 0, false
+	}
+	amount, err := currency.ParseAmount(value)
+	if err != nil {
+		p.fail(&QueryParamError{
+			Message: fmt.Sprintf("%s must be an amount of 0 or greater in %s (up to %d decimal places)", name, currency, currency.Exponent()),
+			Field:   name,
+			Code:    ParamCodeInvalid,
+		})
+		return 0, false
+	}
+	return amount, true
+}
+
+// Function to get optional boolean parameter ("true" or "false")
+// Returns false as second value if parameter is absent or invalid
+func (p *queryParser) optionalBool(name string) (bool, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return false, false
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		p.fail(&QueryParamError{
+			Message:       fmt.Sprintf("%s must be true or false", name),
+			Field:         name,
+			Code:          ParamCodeInvalid,
+			AllowedValues: []string{"true", "false"},
+		})
+		return false, false
+	}
+	return b, true
+}
+
+// Function to get optional parameter that must be one of allowed values
+// Returns false if parameter is absent or invalid
+func (p *queryParser) optionalEnum(name string, allowed []string) (string, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return "", false
+	}
+	for _, a := range allowed {
+		if value == a {
+			return value, true
+		}
+	}
+	p.fail(&QueryParamError{
+		Message:       fmt.Sprintf("Invalid %s value: %s (valid options: %s)", name, value, strings.Join(allowed, ", ")),
+		Field:         name,
+		Code:          ParamCodeUnknownValue,
+		AllowedValues: allowed,
+	})
+	return "", false
+}
+
+// Function to get parameter that must be one of allowed values, or defaultValue if absent
+func (p *queryParser) enumParam(name string, defaultValue string, allowed []string) string {
+	if value, ok := p.optionalEnum(name, allowed); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// Function to get optional date parameter (YYYY-MM-DD, in server local time zone)
+// Returns false if parameter is absent or invalid
+func (p *queryParser) optionalDate(name string) (time.Time, bool) {
+	value := p.c.Query(name)
+	if value == "" {
+		return time.Time{}, false
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		p.fail(&QueryParamError{Message: fmt.Sprintf("%s must be a date in YYYY-MM-DD format", name), Field: name, Code: ParamCodeInvalid})
+		return time.Time{}, false
+	}
+	return date, true
+}
+
+// Function to get common list parameters (page/perPage or cursor/limit)
+// defaultPerPage is used for both perPage and limit when they are absent
+func (p *queryParser) listParams(defaultPerPage int) listParams {
+	params := listParams{
+		Page:    p.intParam("page", 1, 1, MaxPage),
+		PerPage: p.intParam("perPage", defaultPerPage, 1, MaxPerPage),
+		Cursor:  p.c.Query("cursor"),
+	}
+	params.CursorMode = params.Cursor != "" || p.c.Query("limit") != ""
+	params.Limit = p.intParam("limit", params.PerPage, 1, MaxPerPage)
+	return params
+}
+
+// Function to record invalid cursor error
+func (p *queryParser) invalidCursor() {
+	p.fail(&QueryParamError{Message: "Invalid cursor", Field: "cursor", Code: ParamCodeInvalid})
+}
+
+// Function to check whether any parameter was invalid
+// Writes 400 response with structured error body if so
+func (p *queryParser) failed() bool {
+	if p.err == nil {
+		return false
+	}
+	p.c.JSON(http.StatusBadRequest, p.err)
+	return true
+}
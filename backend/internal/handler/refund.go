@@ -0,0 +1,472 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Refund status (corresponding to order_refunds table ENUM)
+type RefundStatus string
+
+const (
+	RefundStatusPending   RefundStatus = "pending" // Waiting for Stripe to confirm
+	RefundStatusSucceeded RefundStatus = "succeeded"
+	RefundStatusFailed    RefundStatus = "failed"
+	RefundStatusCanceled  RefundStatus = "canceled"
+)
+
+// Refund information response struct
+type OrderRefund struct {
+	ID        int          `json:"id"`
+	Amount    int          `json:"amount"`
+	Status    RefundStatus `json:"status"`
+	Reason    *string      `json:"reason"`
+	CreatedAt time.Time    `json:"createdAt"`
+}
+
+// Order item that can still be refunded
+type refundableItem struct {
+	ID          int
+	ProductID   int
+	VariantID   sql.NullInt64
+	ProductName string
+	Quantity    int
+	Paid        int // Amount paid for line (after coupon discount, with tax unless it is included in price)
+	Remaining   int // Ordered quantity minus quantity in pending or succeeded refunds
+}
+
+// Refund recorded as pending but not sent to payment provider yet
+type pendingRefund struct {
+	ID              int64
+	OrderID         int64
+	PaymentIntentID string
+	Amount          int
+	Reason          string
+}
+
+// Refund line struct (order item and quantity to restock)
+type refundLine struct {
+	OrderItemID int
+	Quantity    int
+}
+
+// Error returned when webhook payload can't be parsed (Stripe shouldn't retry)
+var errInvalidWebhookPayload = errors.New("invalid webhook payload")
+
+// Function to convert Stripe refund status to order_refunds status
+// (requires_action is still waiting for the customer, so it stays pending)
+func refundStatusFromStripe(status stripe.RefundStatus) RefundStatus {
+	switch status {
+	case stripe.RefundStatusSucceeded:
+		return RefundStatusSucceeded
+	case stripe.RefundStatusFailed:
+		return RefundStatusFailed
+	case stripe.RefundStatusCanceled:
+		return RefundStatusCanceled
+	default:
+		return RefundStatusPending
+	}
+}
+
+// Function to calculate refund amount of next quantity units of item
+// Amount is taken from paid line amount in proportion to quantity, counting units refunded before,
+// so refunds of all units add up to exactly the paid amount
+func (item refundableItem) refundAmount(quantity int) int {
+	refunded := item.Quantity - item.Remaining
+	return item.Paid*(refunded+quantity)/item.Quantity - item.Paid*refunded/item.Quantity
+}
+
+// Function to get items of order with quantities that can still be refunded
+// Keys of returned map are order item IDs
+func getRefundableItems(tx *sql.Tx, orderID int64) (map[int]refundableItem, error) {
+	rows, err := tx.Query(`
+		SELECT
+			oi.id, oi.product_id, oi.variant_id, oi.product_name, oi.quantity,
+			oi.unit_price * oi.quantity - oi.discount_amount + IF(o.tax_inclusive, 0, oi.tax_amount),
+			oi.quantity - COALESCE((
+				SELECT SUM(ri.quantity)
+				FROM order_refund_items AS ri
+				JOIN order_refunds AS r ON ri.refund_id = r.id
+				WHERE ri.order_item_id = oi.id AND r.status IN (?, ?)
+			), 0)
+		FROM order_items AS oi
+		JOIN orders AS o ON oi.order_id = o.id
+		WHERE oi.order_id = ?
+	`, RefundStatusPending, RefundStatusSucceeded, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := map[int]refundableItem{}
+	for rows.Next() {
+		var item refundableItem
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.VariantID, &item.ProductName, &item.Quantity, &item.Paid, &item.Remaining); err != nil {
+			return nil, err
+		}
+		items[item.ID] = item
+	}
+	return items, rows.Err()
+}
+
+// Function to get amount of order that can still be refunded
+// (total minus pending and succeeded refunds)
+func getRefundableAmount(tx *sql.Tx, orderID int64) (int, error) {
+	var remaining int
+	err := tx.QueryRow(`
+		SELECT o.total_price - COALESCE((
+			SELECT SUM(r.amount) FROM order_refunds AS r WHERE r.order_id = o.id AND r.status IN (?, ?)
+		), 0)
+		FROM orders AS o
+		WHERE o.id = ?
+	`, RefundStatusPending, RefundStatusSucceeded, orderID).Scan(&remaining)
+	return remaining, err
+}
+
+// Function to record refund of order as pending (sent to payment provider with submitPaymentRefund)
+// Caller commits the transaction before submitting, so no row locks are held during the network call
+// and the refund row exists before the provider can report it through webhooks
+func recordPendingRefund(tx *sql.Tx, orderID int64, paymentIntentID string, amount int, lines []refundLine, reason string) (pendingRefund, error) {
+	var reasonValue interface{}
+	if reason != "" {
+		reasonValue = reason
+	}
+	result, err := tx.Exec(
+		"INSERT INTO order_refunds (order_id, amount, status, reason) VALUES (?, ?, ?, ?)",
+		orderID, amount, RefundStatusPending, reasonValue,
+	)
+	if err != nil {
+		return pendingRefund{}, fmt.Errorf("refund registration: %w", err)
+	}
+	refundID, err := result.LastInsertId()
+	if err != nil {
+		return pendingRefund{}, fmt.Errorf("refund ID retrieval: %w", err)
+	}
+
+	for _, line := range lines {
+		_, err := tx.Exec(
+			"INSERT INTO order_refund_items (refund_id, order_item_id, quantity) VALUES (?, ?, ?)",
+			refundID, line.OrderItemID, line.Quantity,
+		)
+		if err != nil {
+			return pendingRefund{}, fmt.Errorf("refund item registration: %w", err)
+		}
+	}
+
+	// Mark order as refunding while Stripe processes refund
+	if err := settleOrderRefundState(tx, orderID); err != nil {
+		return pendingRefund{}, err
+	}
+	return pendingRefund{ID: refundID, OrderID: orderID, PaymentIntentID: paymentIntentID, Amount: amount, Reason: reason}, nil
+}
+
+// Function to send committed pending refund to payment provider and apply the result in a new transaction
+// Refund ID is used as idempotency key; if provider rejects refund, it is marked as failed so order goes back to paid
+// (Pending refunds are completed later by refund.updated / charge.refunded webhooks)
+func submitPaymentRefund(ctx context.Context, db *sql.DB, refund pendingRefund) (RefundStatus, error) {
+	r, refundErr := Payments.CreateRefund(ctx, payment.RefundParams{
+		PaymentIntentID: refund.PaymentIntentID,
+		Amount:          int64(refund.Amount),
+		Reason:          refund.Reason,
+		Metadata: map[string]string{ // Information used in Stripe Webhook
+			"orderId":  strconv.FormatInt(refund.OrderID, 10),
+			"refundId": strconv.FormatInt(refund.ID, 10),
+		},
+		IdempotencyKey: fmt.Sprintf("order-%d-refund-%d", refund.OrderID, refund.ID),
+	})
+
+	tx, err := db.Begin()
+	if err != nil {
+		return "", fmt.Errorf("transaction start: %w", err)
+	}
+	defer tx.Rollback()
+
+	if refundErr != nil {
+		// Refund is recorded again from webhook if it was created after all (see reconcileStripeRefund)
+		if err := applyRefundResult(tx, refund.ID, RefundStatusFailed); err != nil {
+			return "", err
+		}
+		if err := tx.Commit(); err != nil {
+			return "", fmt.Errorf("transaction commit: %w", err)
+		}
+		return "", fmt.Errorf("payment refund creation: %w", refundErr)
+	}
+
+	if _, err := tx.Exec("UPDATE order_refunds SET stripe_refund_id = ? WHERE id = ?", r.ID, refund.ID); err != nil {
+		return "", fmt.Errorf("stripe refund ID update: %w", err)
+	}
+	status := refundStatusFromStripe(r.Status)
+	if err := applyRefundResult(tx, refund.ID, status); err != nil {
+		return "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", fmt.Errorf("transaction commit: %w", err)
+	}
+	return status, nil
+}
+
+// Function to apply final result of refund
+// Succeeded refunds restock their items and add to order's refunded amount; nothing happens if refund is already final
+func applyRefundResult(tx *sql.Tx, refundID int64, status RefundStatus) error {
+	var orderID int64
+	var amount int
+	var current RefundStatus
+	err := tx.QueryRow("SELECT order_id, amount, status FROM order_refunds WHERE id = ? FOR UPDATE", refundID).Scan(&orderID, &amount, &current)
+	if err != nil {
+		return fmt.Errorf("refund retrieval (RefundID=%d): %w", refundID, err)
+	}
+	if current != RefundStatusPending || status == RefundStatusPending {
+		return nil
+	}
+
+	if _, err := tx.Exec("UPDATE order_refunds SET status = ? WHERE id = ?", status, refundID); err != nil {
+		return fmt.Errorf("refund status update (RefundID=%d): %w", refundID, err)
+	}
+
+	if status == RefundStatusSucceeded {
+		// Restock refunded quantities (refunded items no longer count as sales)
+		_, err := tx.Exec(`
+			UPDATE products AS p
+			JOIN (
+				SELECT oi.product_id, SUM(ri.quantity) AS quantity
+				FROM order_refund_items AS ri
+				JOIN order_items AS oi ON ri.order_item_id = oi.id
+				WHERE ri.refund_id = ?
+				GROUP BY oi.product_id
+			) AS rq ON p.id = rq.product_id
+			SET p.stock = p.stock + rq.quantity, p.sales_count = GREATEST(p.sales_count - rq.quantity, 0)
+		`, refundID)
+		if err != nil {
+			return fmt.Errorf("restock (RefundID=%d): %w", refundID, err)
+		}
+		_, err = tx.Exec(`
+			UPDATE product_variants AS v
+			JOIN (
+				SELECT oi.variant_id, SUM(ri.quantity) AS quantity
+				FROM order_refund_items AS ri
+				JOIN order_items AS oi ON ri.order_item_id = oi.id
+				WHERE ri.refund_id = ? AND oi.variant_id IS NOT NULL
+				GROUP BY oi.variant_id
+			) AS rq ON v.id = rq.variant_id
+			SET v.stock = v.stock + rq.quantity
+		`, refundID)
+		if err != nil {
+			return fmt.Errorf("variant restock (RefundID=%d): %w", refundID, err)
+		}
+
+		if _, err := tx.Exec("UPDATE orders SET refunded_amount = refunded_amount + ? WHERE id = ?", amount, orderID); err != nil {
+			return fmt.Errorf("refunded amount update (OrderID=%d): %w", orderID, err)
+		}
+	}
+
+	return settleOrderRefundState(tx, orderID)
+}
+
+// Function to bring order state in line with its refunds
+// Fully refunded orders become refunded (cancelled orders stay cancelled), orders with pending refunds
+// are refunding, and others go back to paid
+// (Cancelled orders stay refunding after a failed refund, since their payment still has to be returned)
+func settleOrderRefundState(tx *sql.Tx, orderID int64) error {
+	_, state, err := lockOrderState(tx, orderID) // Function defined in order_status.go file
+	if err != nil {
+		return fmt.Errorf("order state retrieval (OrderID=%d): %w", orderID, err)
+	}
+
+	var totalPrice, refundedAmount, pendingCount int
+	err = tx.QueryRow(`
+		SELECT o.total_price, o.refunded_amount,
+			(SELECT COUNT(*) FROM order_refunds AS r WHERE r.order_id = o.id AND r.status = ?)
+		FROM orders AS o
+		WHERE o.id = ?
+	`, RefundStatusPending, orderID).Scan(&totalPrice, &refundedAmount, &pendingCount)
+	if err != nil {
+		return fmt.Errorf("refund totals retrieval (OrderID=%d): %w", orderID, err)
+	}
+
+	next := state
+	switch {
+	case pendingCount > 0:
+		next.PaymentStatus = PaymentStatusRefunding
+	case refundedAmount >= totalPrice:
+		next.PaymentStatus = PaymentStatusRefunded
+		if state.Status != OrderStatusCancelled {
+			next.Status = OrderStatusRefunded
+		}
+	case state.Status == OrderStatusCancelled:
+		next.PaymentStatus = PaymentStatusRefunding
+	default:
+		next.PaymentStatus = PaymentStatusPaid
+	}
+	if next == state {
+		return nil
+	}
+	return updateOrderState(tx, orderID, state, next)
+}
+
+// Function to reconcile refund reported by Stripe with order_refunds
+// Refunds created outside this application (e.g. Stripe Dashboard) are recorded as amount-only refunds
+func reconcileStripeRefund(tx *sql.Tx, r *stripe.Refund) error {
+	var refundID int64
+	err := tx.QueryRow("SELECT id FROM order_refunds WHERE stripe_refund_id = ? FOR UPDATE", r.ID).Scan(&refundID)
+	if errors.Is(err, sql.ErrNoRows) {
+		refundID, err = attachStripeRefund(tx, r)
+		if err == nil && refundID == 0 {
+			refundID, err = recordExternalRefund(tx, r)
+		}
+		if err != nil || refundID == 0 {
+			return err
+		}
+	} else if err != nil {
+		return fmt.Errorf("refund retrieval (Stripe refund %s): %w", r.ID, err)
+	}
+
+	return applyRefundResult(tx, refundID, refundStatusFromStripe(r.Status))
+}
+
+// Function to link Stripe refund to pending refund created by this application (reported before its ID was saved)
+// Returns 0 if there is no such refund, e.g. it was marked failed after Stripe request error but was created after all
+func attachStripeRefund(tx *sql.Tx, r *stripe.Refund) (int64, error) {
+	refundID, err := strconv.ParseInt(r.Metadata["refundId"], 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	// Locking read waits for submitPaymentRefund() still saving the ID
+	var stripeRefundID sql.NullString
+	var status RefundStatus
+	err = tx.QueryRow(
+		"SELECT stripe_refund_id, status FROM order_refunds WHERE id = ? AND order_id = ? FOR UPDATE",
+		refundID, r.Metadata["orderId"],
+	).Scan(&stripeRefundID, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("refund retrieval (RefundID=%d): %w", refundID, err)
+	}
+
+	switch {
+	case stripeRefundID.Valid && stripeRefundID.String == r.ID:
+		return refundID, nil
+	case !stripeRefundID.Valid && status == RefundStatusPending:
+		if _, err := tx.Exec("UPDATE order_refunds SET stripe_refund_id = ? WHERE id = ?", r.ID, refundID); err != nil {
+			return 0, fmt.Errorf("stripe refund ID update (RefundID=%d): %w", refundID, err)
+		}
+		return refundID, nil
+	default:
+		return 0, nil
+	}
+}
+
+// Function to record refund created outside this application
+// Returns 0 if refund doesn't belong to any order
+func recordExternalRefund(tx *sql.Tx, r *stripe.Refund) (int64, error) {
+	if r.PaymentIntent == nil || r.PaymentIntent.ID == "" {
+		return 0, nil
+	}
+	var orderID int64
+	err := tx.QueryRow("SELECT id FROM orders WHERE stripe_payment_intent_id = ?", r.PaymentIntent.ID).Scan(&orderID)
+	if errors.Is(err, sql.ErrNoRows) {
+		log.Printf("Webhook: Refund for unknown payment (Stripe refund %s)", r.ID)
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("order retrieval (Stripe refund %s): %w", r.ID, err)
+	}
+
+	var reason interface{}
+	if r.Reason != "" {
+		reason = string(r.Reason)
+	}
+	result, err := tx.Exec(
+		"INSERT INTO order_refunds (order_id, stripe_refund_id, amount, status, reason) VALUES (?, ?, ?, ?, ?)",
+		orderID, r.ID, r.Amount, RefundStatusPending, reason,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("external refund registration (Stripe refund %s): %w", r.ID, err)
+	}
+	log.Printf("Webhook: Recorded refund created outside application (OrderID=%d, Stripe refund %s)", orderID, r.ID)
+	return result.LastInsertId()
+}
+
+// Function to handle refund webhook events (refund.updated, charge.refunded)
+// charge.refunded doesn't always include refund list, so refunds of the payment are fetched from payment provider
+func handleRefundEvent(event stripe.Event) error {
+	refunds := []*stripe.Refund{}
+	switch event.Type {
+	case "refund.updated":
+		var r stripe.Refund
+		if err := json.Unmarshal(event.Data.Raw, &r); err != nil {
+			return errInvalidWebhookPayload
+		}
+		refunds = append(refunds, &r)
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := json.Unmarshal(event.Data.Raw, &charge); err != nil {
+			return errInvalidWebhookPayload
+		}
+		if charge.PaymentIntent == nil {
+			return nil
+		}
+		list, err := Payments.ListRefunds(context.Background(), charge.PaymentIntent.ID)
+		if err != nil {
+			return fmt.Errorf("refund list (PaymentIntent %s): %w", charge.PaymentIntent.ID, err)
+		}
+		refunds = list
+	}
+
+	// Start transaction to update database
+	tx, err := database.GetDB().Begin()
+	if err != nil {
+		return fmt.Errorf("transaction start: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, r := range refunds {
+		if err := reconcileStripeRefund(tx, r); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Function to get refunds of order (newest first)
+func getOrderRefunds(db *sql.DB, orderID int64) ([]OrderRefund, error) {
+	rows, err := db.Query(`
+		SELECT id, amount, status, reason, created_at
+		FROM order_refunds
+		WHERE order_id = ?
+		ORDER BY created_at DESC, id DESC
+	`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	refunds := []OrderRefund{}
+	for rows.Next() {
+		var r OrderRefund
+		var reason sql.NullString
+		if err := rows.Scan(&r.ID, &r.Amount, &r.Status, &reason, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if reason.Valid {
+			r.Reason = &reason.String
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, rows.Err()
+}
@@ -0,0 +1,66 @@
+package handler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/yukaty/go-trailhead/backend/internal/promotion"
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+	"github.com/yukaty/go-trailhead/backend/internal/tax"
+)
+
+// Item refunds of discounted order with exclusive tax return what was paid for each line
+func TestRefundAmountOfDiscountedTaxedOrder(t *testing.T) {
+	// 3 x 3000 tent and 2 x 1500 stove, 1000 off whole order, 10% tax added to discounted prices
+	type line struct{ unitPrice, quantity int }
+	lines := []line{{3000, 3}, {1500, 2}}
+	coupon := promotion.Coupon{Type: promotion.TypeFixed, Value: 1000, Enabled: true}
+	promotionLines := []promotion.Line{}
+	for i, l := range lines {
+		promotionLines = append(promotionLines, promotion.Line{ProductID: i + 1, Amount: l.unitPrice * l.quantity})
+	}
+	discount, err := coupon.Discount(promotionLines, promotion.Usage{}, time.Now())
+	if err != nil {
+		t.Fatalf("Discount: %v", err)
+	}
+	lineDiscounts := coupon.Allocate(promotionLines, discount)
+
+	table := tax.Table{{Country: "JP", Class: tax.DefaultClass, BasisPoints: 1000}}
+	taxLines := []tax.Line{}
+	for i, l := range promotionLines {
+		taxLines = append(taxLines, tax.Line{Class: tax.DefaultClass, Amount: l.Amount - lineDiscounts[i]})
+	}
+	lineTaxes := table.Allocate(shipping.Destination{Country: "JP"}, taxLines, false)
+
+	// Order total without shipping: 12000 - 1000 + 1100 tax
+	itemsPaid := 0
+	for i, l := range lines {
+		itemsPaid += l.unitPrice*l.quantity - lineDiscounts[i] + lineTaxes[i]
+	}
+	if itemsPaid != 12100 {
+		t.Fatalf("items paid = %d, want 12100", itemsPaid)
+	}
+
+	// Refund tent one unit at a time: each refund is 2750 net of discount plus 275 tax, never the 3000 list price
+	tent := refundableItem{Quantity: 3, Remaining: 3, Paid: 9000 - lineDiscounts[0] + lineTaxes[0]}
+	refunded := 0
+	for tent.Remaining > 0 {
+		amount := tent.refundAmount(1)
+		if amount != 3025 {
+			t.Errorf("refund of 1 tent with %d remaining = %d, want 3025", tent.Remaining, amount)
+		}
+		refunded += amount
+		tent.Remaining--
+	}
+	if refunded != tent.Paid {
+		t.Errorf("tent refunds add up to %d, want amount paid %d", refunded, tent.Paid)
+	}
+
+	// Uneven split: partial refunds still add up to amount paid for line
+	item := refundableItem{Quantity: 3, Remaining: 3, Paid: 1001}
+	first := item.refundAmount(2)
+	item.Remaining -= 2
+	if total := first + item.refundAmount(1); total != item.Paid {
+		t.Errorf("partial refunds add up to %d, want %d", total, item.Paid)
+	}
+}
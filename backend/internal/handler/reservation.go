@@ -0,0 +1,207 @@
+package handler
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Stock reservation status (corresponding to stock_reservations table ENUM)
+const (
+	ReservationStatusActive    = "active"    // Stock is held for checkout
+	ReservationStatusConverted = "converted" // Payment completed, stock was decremented
+	ReservationStatusReleased  = "released"  // Checkout was abandoned, expired or cancelled
+)
+
+// How long checkout holds stock (override with CHECKOUT_HOLD_MINUTES environment variable)
+// Stripe Checkout sessions expire after this duration, and holds are kept for checkoutHoldGrace longer,
+// so payment cannot complete after hold is gone
+var CheckoutHoldDuration = checkoutHoldDuration()
+
+// Extra time holds outlive their Checkout session (covers request latency and clock difference to database)
+// Holds of expired sessions are released earlier by checkout.session.expired webhook
+const checkoutHoldGrace = 5 * time.Minute
+
+// Shortest checkout hold (Stripe's 30-minute minimum session lifetime plus margin for request latency)
+const minCheckoutHoldMinutes = 31
+
+// How long holds are kept while a delayed payment method (e.g. bank transfer) is being processed
+const asyncPaymentHoldDuration = 7 * 24 * time.Hour
+
+// Interval between sweeps releasing expired holds
+const stockHoldSweepInterval = time.Minute
+
+// Condition for holds that still reduce available stock
+// (Expired holds stop counting immediately, even before the sweeper releases them)
+const activeHoldCondition = "r.status = 'active' AND r.expires_at > NOW()"
+
+// Function to get checkout hold duration from environment variable
+// Stripe accepts session expiry between 30 minutes and 24 hours after session creation, so value is clamped to that range
+// (minimum is 31 minutes, so expiry is still 30 minutes ahead when Stripe receives request)
+func checkoutHoldDuration() time.Duration {
+	minutes := getEnvInt("CHECKOUT_HOLD_MINUTES", minCheckoutHoldMinutes) // Function defined in query_params.go file
+	if minutes < minCheckoutHoldMinutes {
+		minutes = minCheckoutHoldMinutes
+	}
+	if minutes > 24*60 {
+		minutes = 24 * 60
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+// Function to lock product and variant rows and return stock available for new holds
+// Rows stay locked until transaction ends, so concurrent checkouts for same items are serialized
+// Products are looked up by holds without variant (products sold with variants are held per variant)
+func lockAvailableStock(tx *sql.Tx, productIDs []int, variantIDs []int) (map[int]int, map[int]int, error) {
+	productStock := map[int]int{}
+	if len(productIDs) > 0 {
+		query := fmt.Sprintf(`
+			SELECT p.id, p.stock - COALESCE((
+				SELECT SUM(r.quantity) FROM stock_reservations AS r
+				WHERE r.product_id = p.id AND r.variant_id IS NULL AND %s
+			), 0)
+			FROM products AS p
+			WHERE p.id IN (%s)
+			ORDER BY p.id
+			FOR UPDATE
+		`, activeHoldCondition, strings.Repeat("?,", len(productIDs)-1)+"?")
+		if err := scanAvailableStock(tx, query, productIDs, productStock); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	variantStock := map[int]int{}
+	if len(variantIDs) > 0 {
+		query := fmt.Sprintf(`
+			SELECT v.id, v.stock - COALESCE((
+				SELECT SUM(r.quantity) FROM stock_reservations AS r
+				WHERE r.variant_id = v.id AND %s
+			), 0)
+			FROM product_variants AS v
+			WHERE v.id IN (%s)
+			ORDER BY v.id
+			FOR UPDATE
+		`, activeHoldCondition, strings.Repeat("?,", len(variantIDs)-1)+"?")
+		if err := scanAvailableStock(tx, query, variantIDs, variantStock); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	return productStock, variantStock, nil
+}
+
+// Function to run available stock query and store results in map (ID → available quantity)
+func scanAvailableStock(tx *sql.Tx, query string, ids []int, dest map[int]int) error {
+	args := make([]interface{}, len(ids))
+	for i, id := range ids {
+		args[i] = id
+	}
+	rows, err := tx.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id, available int
+		if err := rows.Scan(&id, &available); err != nil {
+			return err
+		}
+		dest[id] = available
+	}
+	return rows.Err()
+}
+
+// Function to place holds on stock for order lines
+// Must be called in the same transaction as lockAvailableStock()
+func insertStockHolds(tx *sql.Tx, orderID int64, lines []orderLine, duration time.Duration) error {
+	stmt, err := tx.Prepare(`
+		INSERT INTO stock_reservations (order_id, product_id, variant_id, quantity, status, expires_at)
+		VALUES (?, ?, ?, ?, ?, DATE_ADD(NOW(), INTERVAL ? SECOND))
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, line := range lines {
+		_, err := stmt.Exec(orderID, line.ProductID, line.VariantID, line.Quantity, ReservationStatusActive, int(duration.Seconds()))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Function to mark holds of paid order as converted (stock itself is decremented by caller)
+// Holds already released by sweeper are converted too, since payment was completed anyway
+func convertStockHolds(exec sqlExecutor, orderID int64) error {
+	_, err := exec.Exec(`
+		UPDATE stock_reservations SET status = ?
+		WHERE order_id = ? AND status IN (?, ?)
+	`, ReservationStatusConverted, orderID, ReservationStatusActive, ReservationStatusReleased)
+	return err
+}
+
+// Function to extend active (or already expired but not yet released) holds of order
+func extendStockHolds(exec sqlExecutor, orderID int64, duration time.Duration) error {
+	_, err := exec.Exec(`
+		UPDATE stock_reservations SET expires_at = DATE_ADD(NOW(), INTERVAL ? SECOND)
+		WHERE order_id = ? AND status = ?
+	`, int(duration.Seconds()), orderID, ReservationStatusActive)
+	return err
+}
+
+// Function to release active holds of order (checkout abandoned, expired or cancelled)
+// Returns number of holds released
+func releaseStockHolds(exec sqlExecutor, orderID int64) (int64, error) {
+	result, err := exec.Exec(`
+		UPDATE stock_reservations SET status = ?
+		WHERE order_id = ? AND status = ?
+	`, ReservationStatusReleased, orderID, ReservationStatusActive)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// Function to release all holds past their expiry time
+// Returns number of holds released
+func releaseExpiredStockHolds(db *sql.DB) (int64, error) {
+	result, err := db.Exec(`
+		UPDATE stock_reservations SET status = ?
+		WHERE status = ? AND expires_at <= NOW()
+	`, ReservationStatusReleased, ReservationStatusActive)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// --- 2. Background Task Definitions ---
+
+// Function to start background sweeper releasing holds of abandoned or expired checkouts
+// Runs until process exits
+func StartStockHoldSweeper() {
+	go func() {
+		ticker := time.NewTicker(stockHoldSweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			released, err := releaseExpiredStockHolds(database.GetDB())
+			if err != nil {
+				log.Printf("Stock hold sweep error: %v", err)
+				continue
+			}
+			if released > 0 {
+				log.Printf("Stock hold sweep: released %d expired holds", released)
+			}
+		}
+	}()
+}
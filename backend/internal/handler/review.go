@@ -2,10 +2,10 @@ package handler
 
 import (
 	"database/sql"
+	"fmt"
 	"log"
 	"math"
 	"net/http"
-	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -31,8 +31,16 @@ type ReviewData struct {
 // Response struct for reviews list API (/api/products/:id/reviews)
 type ReviewsPageData struct {
 	Reviews    []ReviewData `json:"reviews"`
-	ReviewAvg  float64      `json:"review_avg"` // Average rating
-	Pagination Pagination   `json:"pagination"` // Pagination information (type defined in product.go file)
+	ReviewAvg  float64      `json:"review_avg"`           // Average rating
+	Pagination *Pagination  `json:"pagination,omitempty"` // Pagination information, page mode only (type defined in product.go file)
+	NextCursor *string      `json:"nextCursor,omitempty"` // Cursor mode only (omitted on last page)
+}
+
+// Keyset sort order of reviews list (newest first)
+var reviewsOrder = keysetOrder{
+	Name: "new",
+	Keys: []keysetKey{{Expr: "r.created_at", Kind: keyKindTime}, {Expr: "r.id", Kind: keyKindInt}},
+	Desc: true,
 }
 
 // Review submission request struct
@@ -51,22 +59,40 @@ func GetReviewsHandler(c *gin.Context) {
 		return
 	}
 
-	// Get pagination information from query parameter (?page=X)
-	pageStr := c.DefaultQuery("page", "1")
-	page, err := strconv.Atoi(pageStr)
-	if err != nil || page < 1 {
-		page = 1
+	// Get pagination information from query parameters (default 10 reviews per page)
+	// ?page=X&perPage=Y for page mode, ?cursor=X&limit=Y for cursor mode (enabled by either parameter)
+	params := newQueryParser(c)
+	list := params.listParams(10)
+
+	// Build conditions, ORDER BY and LIMIT clauses
+	conditions := []sqlCondition{{Clause: "r.product_id = ?", Params: []interface{}{productID}}}
+	limitClause := "LIMIT ? OFFSET ?"
+	limitParams := []interface{}{list.PerPage, (list.Page - 1) * list.PerPage}
+	if list.CursorMode {
+		if list.Cursor != "" {
+			cursorCond, err := reviewsOrder.after(list.Cursor)
+			if err != nil {
+				params.invalidCursor()
+			}
+			conditions = append(conditions, cursorCond)
+		}
+		// Fetch one extra row to know whether a next page exists
+		limitClause = "LIMIT ?"
+		limitParams = []interface{}{list.Limit + 1}
 	}
-
-	// Set number of reviews per page
-	perPage := 10
-	offset := (page - 1) * perPage
+	if params.failed() {
+		return
+	}
+	whereClause, whereParams := buildWhereClause(conditions, "") // Function defined in product_filter.go file
+	orderByClause, _ := reviewsOrder.orderBy()
 
 	// Get database connection
 	db := database.GetDB()
 
 	// Get reviews list, total review count, and average rating with concurrent processing
 	var reviews []ReviewData
+	var lastKeys []interface{} // Sort key values of last review in response
+	rowCount := 0
 	var totalItems int
 	var reviewAvg sql.NullFloat64 // AVG (average rating) can be NULL
 	var reviewsErr, statsErr error
@@ -79,17 +105,17 @@ func GetReviewsHandler(c *gin.Context) {
 	// Goroutine 1: Get reviews list
 	go func() {
 		defer wg.Done()
-		query := `
+		query := fmt.Sprintf(`
 			SELECT
 				r.id, r.product_id, r.user_id, r.score, r.content, r.created_at,
 				u.name AS user_name
 			FROM reviews AS r
 			JOIN users AS u ON r.user_id = u.id
-			WHERE r.product_id = ?
-			ORDER BY r.created_at DESC
-			LIMIT ? OFFSET ?
-		`
-		rows, err := db.Query(query, productID, perPage, offset)
+			%s
+			%s
+			%s
+		`, whereClause, orderByClause, limitClause)
+		rows, err := db.Query(query, append(whereParams, limitParams...)...)
 		if err != nil {
 			log.Printf("Reviews list retrieval error (ProductID=%d): %v", productID, err)
 			reviewsErr = err
@@ -107,7 +133,13 @@ func GetReviewsHandler(c *gin.Context) {
 				reviewsErr = err
 				return
 			}
+			rowCount++
+			// Extra row fetched in cursor mode only signals that a next page exists
+			if list.CursorMode && rowCount > list.Limit {
+				continue
+			}
 			reviews = append(reviews, r)
+			lastKeys = []interface{}{r.CreatedAt, int64(r.ID)}
 		}
 		reviewsErr = rows.Err()
 	}()
@@ -142,20 +174,22 @@ func GetReviewsHandler(c *gin.Context) {
 	// Round to 1 decimal place
 	avg = math.Round(avg*10) / 10
 
-	// Create pagination information
-	totalPages := int(math.Ceil(float64(totalItems) / float64(perPage)))
-	pagination := Pagination{ // Type defined in product.go file
-		CurrentPage: page,
-		PerPage:     perPage,
-		TotalItems:  totalItems,
-		TotalPages:  totalPages,
-	}
-
 	// Assemble final response
 	response := ReviewsPageData{
-		Reviews:    reviews,
-		ReviewAvg:  avg,
-		Pagination: pagination,
+		Reviews:   reviews,
+		ReviewAvg: avg,
+	}
+	if list.CursorMode {
+		response.NextCursor = nextCursor(reviewsOrder, rowCount, list.Limit, lastKeys)
+	} else {
+		// Create pagination information
+		totalPages := int(math.Ceil(float64(totalItems) / float64(list.PerPage)))
+		response.Pagination = &Pagination{ // Type defined in product.go file
+			CurrentPage: list.Page,
+			PerPage:     list.PerPage,
+			TotalItems:  totalItems,
+			TotalPages:  totalPages,
+		}
 	}
 
 	// Return response as JSON
@@ -0,0 +1,285 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Shipping rate response struct
+type ShippingRate struct {
+	ID            int                `json:"id"`
+	Name          string             `json:"name"`
+	Country       string             `json:"country"` // 2-letter country code, or "*" for any country
+	Region        string             `json:"region"`  // Empty for whole country
+	Method        shipping.Method    `json:"method"`  // flat, weight or quantity
+	FlatFee       int                `json:"flatFee"`
+	Brackets      []shipping.Bracket `json:"brackets"`      // Weight (grams) or quantity brackets
+	FreeThreshold *int               `json:"freeThreshold"` // Subtotal for free shipping (null if never free)
+	Enabled       bool               `json:"enabled"`
+	CreatedAt     time.Time          `json:"createdAt"`
+	UpdatedAt     time.Time          `json:"updatedAt"`
+}
+
+// Shipping rate create/update request struct
+type ShippingRateRequest struct {
+	Name          string             `json:"name" binding:"required"`
+	Country       string             `json:"country"` // Defaults to "*"
+	Region        string             `json:"region"`
+	Method        shipping.Method    `json:"method" binding:"required"`
+	FlatFee       int                `json:"flatFee"`
+	Brackets      []shipping.Bracket `json:"brackets"`
+	FreeThreshold *int               `json:"freeThreshold"`
+	Enabled       *bool              `json:"enabled"` // Defaults to true
+}
+
+// Country used when shipping address doesn't specify one (override with SHIPPING_DEFAULT_COUNTRY environment variable)
+var DefaultShippingCountry = defaultShippingCountry()
+
+// Function to get default shipping country from environment variable
+func defaultShippingCountry() string {
+	country := strings.ToUpper(strings.TrimSpace(os.Getenv("SHIPPING_DEFAULT_COUNTRY")))
+	if country == "" {
+		return "US"
+	}
+	return country
+}
+
+// Function to convert request to rate of shipping package (normalizing country and region)
+func (req ShippingRateRequest) toRate() shipping.Rate {
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country == "" {
+		country = shipping.AnyCountry
+	}
+	return shipping.Rate{
+		Name:          strings.TrimSpace(req.Name),
+		Country:       country,
+		Region:        strings.TrimSpace(req.Region),
+		Method:        req.Method,
+		FlatFee:       req.FlatFee,
+		Brackets:      req.Brackets,
+		FreeThreshold: req.FreeThreshold,
+	}
+}
+
+// Function to get shipping rates
+// If enabledOnly is true, disabled rates are left out (used for quoting)
+func getShippingRates(q sqlQueryer, enabledOnly bool) ([]ShippingRate, error) {
+	query := `
+		SELECT id, name, country, region, method, flat_fee, brackets, free_threshold, enabled, created_at, updated_at
+		FROM shipping_rates
+	`
+	if enabledOnly {
+		query += " WHERE enabled = TRUE"
+	}
+	query += " ORDER BY country, region, id"
+
+	rows, err := q.Query(query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []ShippingRate{}
+	for rows.Next() {
+		var r ShippingRate
+		var brackets []byte
+		var freeThreshold sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.Name, &r.Country, &r.Region, &r.Method, &r.FlatFee, &brackets,
+			&freeThreshold, &r.Enabled, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		r.Brackets = []shipping.Bracket{}
+		if len(brackets) > 0 {
+			if err := json.Unmarshal(brackets, &r.Brackets); err != nil {
+				return nil, err
+			}
+		}
+		if freeThreshold.Valid {
+			threshold := int(freeThreshold.Int64)
+			r.FreeThreshold = &threshold
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// Function to calculate shipping fee of order lines to destination
+// Returns error wrapping shipping.ErrNoRate if destination cannot be shipped to
+func quoteShipping(q sqlQueryer, dest shipping.Destination, lines []orderLine) (shipping.Quote, error) {
+	rates, err := getShippingRates(q, true)
+	if err != nil {
+		return shipping.Quote{}, err
+	}
+	table := make(shipping.Table, 0, len(rates))
+	for _, r := range rates {
+		table = append(table, shipping.Rate{
+			ID: r.ID, Name: r.Name, Country: r.Country, Region: r.Region, Method: r.Method,
+			FlatFee: r.FlatFee, Brackets: r.Brackets, FreeThreshold: r.FreeThreshold,
+		})
+	}
+
+	parcel := shipping.Parcel{}
+	for _, line := range lines {
+		parcel.Subtotal += line.UnitPrice * line.Quantity
+		parcel.Quantity += line.Quantity
+		parcel.WeightGrams += line.WeightGrams * line.Quantity
+	}
+	return table.Quote(dest, parcel)
+}
+
+// Function to save shipping rate (inserts if id is 0)
+// Returns error message for client if validation fails
+func saveShippingRate(db *sql.DB, id int, req ShippingRateRequest) (int64, string, error) {
+	rate := req.toRate()
+	if err := rate.Validate(); err != nil {
+		return 0, err.Error(), nil
+	}
+
+	var brackets interface{} // NULL for flat rates
+	if rate.Method != shipping.MethodFlat {
+		data, err := json.Marshal(rate.Brackets)
+		if err != nil {
+			return 0, "", err
+		}
+		brackets = string(data)
+	}
+	enabled := req.Enabled == nil || *req.Enabled
+
+	if id == 0 {
+		result, err := db.Exec(`
+			INSERT INTO shipping_rates (name, country, region, method, flat_fee, brackets, free_threshold, enabled)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`, rate.Name, rate.Country, rate.Region, rate.Method, rate.FlatFee, brackets, rate.FreeThreshold, enabled)
+		if err != nil {
+			return 0, "", err
+		}
+		newID, err := result.LastInsertId()
+		return newID, "", err
+	}
+
+	_, err := db.Exec(`
+		UPDATE shipping_rates SET
+			name = ?, country = ?, region = ?, method = ?, flat_fee = ?, brackets = ?, free_threshold = ?, enabled = ?
+		WHERE id = ?
+	`, rate.Name, rate.Country, rate.Region, rate.Method, rate.FlatFee, brackets, rate.FreeThreshold, enabled, id)
+	return int64(id), "", err
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to list shipping rates (GET /api/admin/shipping-rates)
+func AdminListShippingRatesHandler(c *gin.Context) {
+	rates, err := getShippingRates(database.GetDB(), false)
+	if err != nil {
+		log.Printf("Shipping rates retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rates": rates})
+}
+
+// Function to create shipping rate (POST /api/admin/shipping-rates)
+func AdminCreateShippingRateHandler(c *gin.Context) {
+	var req ShippingRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Shipping rate creation request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	id, msg, err := saveShippingRate(database.GetDB(), 0, req)
+	if err != nil {
+		log.Printf("Shipping rate registration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful registration response
+	c.JSON(http.StatusCreated, gin.H{"message": "Shipping rate registered successfully", "id": id})
+}
+
+// Function to edit shipping rate (PUT /api/admin/shipping-rates/:id)
+func AdminUpdateShippingRateHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping rate ID"})
+		return
+	}
+
+	var req ShippingRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Shipping rate update request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check shipping rate exists
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM shipping_rates WHERE id = ?", id).Scan(&exists); err != nil {
+		log.Printf("Shipping rate check error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rate not found"})
+		return
+	}
+
+	_, msg, err := saveShippingRate(db, id, req)
+	if err != nil {
+		log.Printf("Shipping rate update error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping rate updated successfully"})
+}
+
+// Function to delete shipping rate (DELETE /api/admin/shipping-rates/:id)
+// (Orders keep the shipping cost they were charged)
+func AdminDeleteShippingRateHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid shipping rate ID"})
+		return
+	}
+
+	result, err := database.GetDB().Exec("DELETE FROM shipping_rates WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Shipping rate deletion error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Shipping rate not found"})
+		return
+	}
+
+	// Return successful deletion response
+	c.JSON(http.StatusOK, gin.H{"message": "Shipping rate deleted successfully"})
+}
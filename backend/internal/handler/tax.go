@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"database/sql"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+	"github.com/yukaty/go-trailhead/backend/internal/tax"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Tax rate response struct
+type TaxRate struct {
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Country     string    `json:"country"` // 2-letter country code, or "*" for any country
+	Region      string    `json:"region"`  // Empty for whole country
+	TaxClass    string    `json:"taxClass"`
+	BasisPoints int       `json:"basisPoints"` // 1000 = 10%
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+// Tax rate create/update request struct
+type TaxRateRequest struct {
+	Name        string `json:"name" binding:"required"`
+	Country     string `json:"country"`  // Defaults to "*"
+	Region      string `json:"region"`   // Empty for whole country
+	TaxClass    string `json:"taxClass"` // Defaults to "standard"
+	BasisPoints int    `json:"basisPoints"`
+}
+
+// Whether product prices include tax (override with TAX_PRICES_INCLUDE_TAX environment variable)
+// If false, tax is added to order total at checkout
+var PricesIncludeTax = pricesIncludeTax()
+
+// Function to get tax pricing mode from environment variable
+func pricesIncludeTax() bool {
+	value := os.Getenv("TAX_PRICES_INCLUDE_TAX")
+	if value == "" {
+		return true
+	}
+	include, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Printf("Warning: TAX_PRICES_INCLUDE_TAX environment variable is invalid (%q), using true", value)
+		return true
+	}
+	return include
+}
+
+// Function to convert request to rate of tax package (normalizing country, region and class)
+func (req TaxRateRequest) toRate() tax.Rate {
+	country := strings.ToUpper(strings.TrimSpace(req.Country))
+	if country == "" {
+		country = tax.AnyCountry
+	}
+	return tax.Rate{
+		Name:        strings.TrimSpace(req.Name),
+		Country:     country,
+		Region:      strings.TrimSpace(req.Region),
+		Class:       tax.NormalizeClass(req.TaxClass),
+		BasisPoints: req.BasisPoints,
+	}
+}
+
+// Function to get tax rates
+func getTaxRates(q sqlQueryer) ([]TaxRate, error) {
+	rows, err := q.Query(`
+		SELECT id, name, country, region, tax_class, basis_points, created_at, updated_at
+		FROM tax_rates
+		ORDER BY country, region, tax_class, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []TaxRate{}
+	for rows.Next() {
+		var r TaxRate
+		if err := rows.Scan(&r.ID, &r.Name, &r.Country, &r.Region, &r.TaxClass, &r.BasisPoints, &r.CreatedAt, &r.UpdatedAt); err != nil {
+			return nil, err
+		}
+		rates = append(rates, r)
+	}
+	return rates, rows.Err()
+}
+
+// Function to calculate tax of order lines shipped to destination
+// lineDiscounts is coupon discount of each line (nil if no coupon), so tax is charged on discounted prices
+// Returns total tax and tax of each line (shipping is not taxed)
+func calculateTax(q sqlQueryer, dest shipping.Destination, lines []orderLine, lineDiscounts []int) (int, []int, error) {
+	rates, err := getTaxRates(q)
+	if err != nil {
+		return 0, nil, err
+	}
+	table := make(tax.Table, 0, len(rates))
+	for _, r := range rates {
+		table = append(table, tax.Rate{
+			ID: r.ID, Name: r.Name, Country: r.Country, Region: r.Region, Class: r.TaxClass, BasisPoints: r.BasisPoints,
+		})
+	}
+
+	taxLines := make([]tax.Line, 0, len(lines))
+	for i, line := range lines {
+		amount := line.UnitPrice * line.Quantity
+		if lineDiscounts != nil {
+			amount -= lineDiscounts[i]
+		}
+		taxLines = append(taxLines, tax.Line{Class: line.TaxClass, Amount: amount})
+	}
+	lineTaxes := table.Allocate(dest, taxLines, PricesIncludeTax)
+	total := 0
+	for _, lineTax := range lineTaxes {
+		total += lineTax
+	}
+	return total, lineTaxes, nil
+}
+
+// Function to save tax rate (inserts if id is 0)
+// Returns error message for client if validation fails
+func saveTaxRate(db *sql.DB, id int, req TaxRateRequest) (int64, string, error) {
+	rate := req.toRate()
+	if err := rate.Validate(); err != nil {
+		return 0, err.Error(), nil
+	}
+
+	if id == 0 {
+		result, err := db.Exec(`
+			INSERT INTO tax_rates (name, country, region, tax_class, basis_points)
+			VALUES (?, ?, ?, ?, ?)
+		`, rate.Name, rate.Country, rate.Region, rate.Class, rate.BasisPoints)
+		if err != nil {
+			return 0, "", err
+		}
+		newID, err := result.LastInsertId()
+		return newID, "", err
+	}
+
+	_, err := db.Exec(`
+		UPDATE tax_rates SET name = ?, country = ?, region = ?, tax_class = ?, basis_points = ?
+		WHERE id = ?
+	`, rate.Name, rate.Country, rate.Region, rate.Class, rate.BasisPoints, id)
+	return int64(id), "", err
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to list tax rates (GET /api/admin/tax-rates)
+func AdminListTaxRatesHandler(c *gin.Context) {
+	rates, err := getTaxRates(database.GetDB())
+	if err != nil {
+		log.Printf("Tax rates retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"rates": rates, "pricesIncludeTax": PricesIncludeTax})
+}
+
+// Function to create tax rate (POST /api/admin/tax-rates)
+func AdminCreateTaxRateHandler(c *gin.Context) {
+	var req TaxRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Tax rate creation request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	id, msg, err := saveTaxRate(database.GetDB(), 0, req)
+	if err != nil {
+		log.Printf("Tax rate registration error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful registration response
+	c.JSON(http.StatusCreated, gin.H{"message": "Tax rate registered successfully", "id": id})
+}
+
+// Function to edit tax rate (PUT /api/admin/tax-rates/:id)
+func AdminUpdateTaxRateHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate ID"})
+		return
+	}
+
+	var req TaxRateRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		log.Printf("Tax rate update request binding error: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"error": ErrInvalidInput})
+		return
+	}
+
+	// Get database connection
+	db := database.GetDB()
+
+	// Check tax rate exists
+	var exists int
+	if err := db.QueryRow("SELECT COUNT(*) FROM tax_rates WHERE id = ?", id).Scan(&exists); err != nil {
+		log.Printf("Tax rate check error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if exists == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+		return
+	}
+
+	_, msg, err := saveTaxRate(db, id, req)
+	if err != nil {
+		log.Printf("Tax rate update error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	// Return successful update response
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rate updated successfully"})
+}
+
+// Function to delete tax rate (DELETE /api/admin/tax-rates/:id)
+// (Orders keep the tax they were charged)
+func AdminDeleteTaxRateHandler(c *gin.Context) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid tax rate ID"})
+		return
+	}
+
+	result, err := database.GetDB().Exec("DELETE FROM tax_rates WHERE id = ?", id)
+	if err != nil {
+		log.Printf("Tax rate deletion error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Tax rate not found"})
+		return
+	}
+
+	// Return successful deletion response
+	c.JSON(http.StatusOK, gin.H{"message": "Tax rate deleted successfully"})
+}
@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Product variant struct (one SKU of a product, e.g. "M / Navy")
+type ProductVariant struct {
+	ID        int     `json:"id"`
+	ProductID int     `json:"product_id"`
+	SKU       string  `json:"sku"`
+	Size      *string `json:"size"`      // Nullable
+	Color     *string `json:"color"`     // Nullable
+	Price     int     `json:"price"`     // Effective price (variant override or product price)
+	Stock     int     `json:"stock"`     // Stock of this variant
+	ImageURL  *string `json:"image_url"` // Nullable (falls back to product image on frontend)
+}
+
+// Option axes struct (distinct values offered for each option of a product)
+type ProductOptions struct {
+	Size  []string `json:"size"`
+	Color []string `json:"color"`
+}
+
+// Function to build display label for variant options (e.g. "M / Navy")
+func variantLabel(size, color sql.NullString) string {
+	parts := []string{}
+	if size.Valid && size.String != "" {
+		parts = append(parts, size.String)
+	}
+	if color.Valid && color.String != "" {
+		parts = append(parts, color.String)
+	}
+	return strings.Join(parts, " / ")
+}
+
+// Function to get variants of product
+// productPrice is used as effective price of variants without price override
+func getProductVariants(db *sql.DB, productID int, productPrice int) ([]ProductVariant, error) {
+	query := `
+		SELECT id, product_id, sku, size, color, price, stock, image_url
+		FROM product_variants
+		WHERE product_id = ?
+		ORDER BY id ASC
+	`
+	rows, err := db.Query(query, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	variants := []ProductVariant{}
+	for rows.Next() {
+		var v ProductVariant
+		var size, color, imageUrl sql.NullString
+		var price sql.NullInt64
+		if err := rows.Scan(&v.ID, &v.ProductID, &v.SKU, &size, &color, &price, &v.Stock, &imageUrl); err != nil {
+			return nil, err
+		}
+		if size.Valid {
+			v.Size = &size.String
+		}
+		if color.Valid {
+			v.Color = &color.String
+		}
+		if imageUrl.Valid {
+			v.ImageURL = &imageUrl.String
+		}
+		v.Price = productPrice
+		if price.Valid {
+			v.Price = int(price.Int64)
+		}
+		variants = append(variants, v)
+	}
+	return variants, rows.Err()
+}
+
+// Function to collect option axes offered by variants (in order of first appearance)
+func collectProductOptions(variants []ProductVariant) ProductOptions {
+	options := ProductOptions{Size: []string{}, Color: []string{}}
+	seenSize, seenColor := map[string]bool{}, map[string]bool{}
+	for _, v := range variants {
+		if v.Size != nil && !seenSize[*v.Size] {
+			seenSize[*v.Size] = true
+			options.Size = append(options.Size, *v.Size)
+		}
+		if v.Color != nil && !seenColor[*v.Color] {
+			seenColor[*v.Color] = true
+			options.Color = append(options.Color, *v.Color)
+		}
+	}
+	return options
+}
+
+// Interface satisfied by both *sql.DB and *sql.Tx
+type sqlExecutor interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Function to recalculate product stock as total of its variant stocks
+// Does nothing for products without variants
+func syncProductStockFromVariants(exec sqlExecutor, productID int) error {
+	query := `
+		UPDATE products
+		SET stock = (SELECT COALESCE(SUM(stock), 0) FROM product_variants WHERE product_id = ?)
+		WHERE id = ? AND EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)
+	`
+	_, err := exec.Exec(query, productID, productID, productID)
+	return err
+}
+
+// Function to reset stock of product whose last variant was deleted
+// Stock total of removed variants must not remain as stock of plain product (admin sets new stock when editing product)
+func resetStockOfProductWithoutVariants(exec sqlExecutor, productID int) error {
+	query := `
+		UPDATE products
+		SET stock = 0
+		WHERE id = ? AND NOT EXISTS (SELECT 1 FROM product_variants WHERE product_id = ?)
+	`
+	_, err := exec.Exec(query, productID, productID)
+	return err
+}
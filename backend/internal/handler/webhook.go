@@ -0,0 +1,369 @@
+package handler
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stripe/stripe-go/v83"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/payment"
+)
+
+// --- 1. Type Definitions (structs) ---
+
+// Webhook event processing status (corresponding to webhook_events table ENUM)
+const (
+	WebhookEventStatusReceived   = "received"   // Stored, not processed yet
+	WebhookEventStatusProcessing = "processing" // Being processed by a delivery or replay
+	WebhookEventStatusProcessed  = "processed"  // Processed successfully
+	WebhookEventStatusIgnored    = "ignored"    // Event type isn't handled
+	WebhookEventStatusFailed     = "failed"     // Processing failed (Stripe retries delivery, admins can replay)
+)
+
+// Valid webhook event statuses for filtering
+var webhookEventStatusValues = []string{
+	WebhookEventStatusReceived, WebhookEventStatusProcessing, WebhookEventStatusProcessed,
+	WebhookEventStatusIgnored, WebhookEventStatusFailed,
+}
+
+// Events left in processing status longer than this are treated as interrupted (e.g. server restarted)
+const webhookEventProcessingTimeout = 5 * time.Minute
+
+// Default number of events per page of admin event list
+const defaultWebhookEventsLimit = 50
+
+// Webhook event log response struct
+type WebhookEvent struct {
+	ID          int64           `json:"id"`
+	EventID     string          `json:"eventId"` // Stripe event ID
+	Type        string          `json:"type"`
+	Status      string          `json:"status"`
+	Attempts    int             `json:"attempts"`
+	LastError   *string         `json:"lastError"`   // Error of last failed attempt
+	ProcessedAt *time.Time      `json:"processedAt"` // Null until processed
+	CreatedAt   time.Time       `json:"createdAt"`   // Time first delivery was received
+	UpdatedAt   time.Time       `json:"updatedAt"`
+	Payload     json.RawMessage `json:"payload,omitempty"` // Event detail only
+}
+
+// Keyset sort order of webhook event list (newest first)
+var webhookEventsOrder = keysetOrder{
+	Name: "new",
+	Keys: []keysetKey{{Expr: "e.id", Kind: keyKindInt}},
+	Desc: true,
+}
+
+// Columns of webhook event log (without payload)
+const webhookEventColumns = "e.id, e.event_id, e.event_type, e.status, e.attempts, e.last_error, e.processed_at, e.created_at, e.updated_at"
+
+// Function to scan webhook event log row (selected with webhookEventColumns)
+func scanWebhookEvent(row interface{ Scan(...interface{}) error }, extra ...interface{}) (WebhookEvent, error) {
+	var e WebhookEvent
+	var lastError sql.NullString
+	var processedAt sql.NullTime
+	dest := []interface{}{&e.ID, &e.EventID, &e.Type, &e.Status, &e.Attempts, &lastError, &processedAt, &e.CreatedAt, &e.UpdatedAt}
+	if err := row.Scan(append(dest, extra...)...); err != nil {
+		return WebhookEvent{}, err
+	}
+	if lastError.Valid {
+		e.LastError = &lastError.String
+	}
+	if processedAt.Valid {
+		e.ProcessedAt = &processedAt.Time
+	}
+	return e, nil
+}
+
+// Function to get webhook event log entry with payload
+// Returns sql.ErrNoRows if entry doesn't exist
+func getWebhookEvent(db *sql.DB, id int64) (WebhookEvent, error) {
+	var payload []byte
+	row := db.QueryRow("SELECT "+webhookEventColumns+", e.payload FROM webhook_events AS e WHERE e.id = ?", id)
+	e, err := scanWebhookEvent(row, &payload)
+	if err != nil {
+		return WebhookEvent{}, err
+	}
+	e.Payload = payload
+	return e, nil
+}
+
+// Function to store received webhook event and return its log ID
+// Redelivered events keep their existing entry
+func recordWebhookEvent(db *sql.DB, event stripe.Event, payload []byte) (int64, error) {
+	// LAST_INSERT_ID(id) returns existing entry ID when event was already received
+	result, err := db.Exec(`
+		INSERT INTO webhook_events (event_id, event_type, payload) VALUES (?, ?, ?)
+		ON DUPLICATE KEY UPDATE id = LAST_INSERT_ID(id)
+	`, event.ID, string(event.Type), payload)
+	if err != nil {
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// Function to process webhook event according to its type
+// Returns false if event type isn't handled
+func processWebhookEvent(event stripe.Event) (bool, error) {
+	switch event.Type {
+	case "checkout.session.completed", // Customer finished checkout (payment may still be pending for delayed methods)
+		"checkout.session.async_payment_succeeded", // Delayed payment succeeded
+		"checkout.session.async_payment_failed",    // Delayed payment failed
+		"checkout.session.expired":                 // Customer abandoned checkout
+		return true, handleCheckoutSessionEvent(event) // Function defined in order.go file
+	case "refund.updated", // Refund status changed (e.g. pending → succeeded or failed)
+		"charge.refunded": // Charge was refunded (including refunds made in Stripe Dashboard)
+		log.Printf("Webhook received (%s)", event.Type)
+		return true, handleRefundEvent(event) // Function defined in refund.go file
+	default:
+		// Ignore other events (but log them)
+		log.Printf("Webhook received (ignoring event): %s", event.Type)
+		return false, nil
+	}
+}
+
+// Function to process logged webhook event once
+// Event is claimed first, so duplicate deliveries and replays running at the same time don't process it twice
+// Returns false (without error) if event was already processed or is being processed
+func runWebhookEvent(db *sql.DB, id int64, event stripe.Event) (bool, error) {
+	result, err := db.Exec(`
+		UPDATE webhook_events
+		SET status = ?, attempts = attempts + 1
+		WHERE id = ? AND (status IN (?, ?) OR (status = ? AND updated_at < NOW() - INTERVAL ? SECOND))
+	`, WebhookEventStatusProcessing, id, WebhookEventStatusReceived, WebhookEventStatusFailed,
+		WebhookEventStatusProcessing, int(webhookEventProcessingTimeout.Seconds()))
+	if err != nil {
+		return false, fmt.Errorf("webhook event claim: %w", err)
+	}
+	if claimed, _ := result.RowsAffected(); claimed == 0 {
+		return false, nil
+	}
+
+	handled, processErr := processWebhookEvent(event)
+
+	// Record result (error is kept for admins)
+	switch {
+	case processErr != nil:
+		_, err = db.Exec("UPDATE webhook_events SET status = ?, last_error = ? WHERE id = ?", WebhookEventStatusFailed, processErr.Error(), id)
+	case !handled:
+		_, err = db.Exec("UPDATE webhook_events SET status = ?, last_error = NULL, processed_at = NOW() WHERE id = ?", WebhookEventStatusIgnored, id)
+	default:
+		_, err = db.Exec("UPDATE webhook_events SET status = ?, last_error = NULL, processed_at = NOW() WHERE id = ?", WebhookEventStatusProcessed, id)
+	}
+	if err != nil {
+		log.Printf("Webhook: Event status update error (ID=%d): %v", id, err)
+	}
+	return true, processErr
+}
+
+// --- 2. Handler Definitions ---
+
+// Function to handle Stripe Webhook events (POST /api/orders/webhook)
+// Every event is logged in webhook_events table, and duplicate deliveries of processed events are skipped
+func StripeWebhookHandler(c *gin.Context) {
+	// Read HTTP request body
+	payload, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		log.Printf("Webhook request body read error: %v", err)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+
+	// Verify signature and construct event
+	event, err := Payments.VerifyWebhook(payload, c.GetHeader(payment.SignatureHeader))
+	if errors.Is(err, payment.ErrWebhookSecretNotSet) {
+		log.Println("Warning: STRIPE_WEBHOOK_SECRET environment variable is not set")
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook signature verification error: %v", err)
+		c.Status(http.StatusBadRequest) // Invalid signature
+		return
+	}
+
+	// Log event (redelivered events keep their first entry)
+	db := database.GetDB()
+	id, err := recordWebhookEvent(db, event, payload)
+	if err != nil {
+		log.Printf("Webhook: Event log registration error (%s): %v", event.ID, err)
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	ran, err := runWebhookEvent(db, id, event)
+	if errors.Is(err, errInvalidWebhookPayload) {
+		log.Printf("Webhook: Invalid event payload (%s, %s)", event.Type, event.ID)
+		c.Status(http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook: Event processing error (%s, %s): %v", event.Type, event.ID, err)
+		c.Status(http.StatusInternalServerError) // Stripe retries delivery later
+		return
+	}
+	if !ran {
+		var status string
+		if err := db.QueryRow("SELECT status FROM webhook_events WHERE id = ?", id).Scan(&status); err != nil {
+			log.Printf("Webhook: Event status retrieval error (ID=%d): %v", id, err)
+			c.Status(http.StatusInternalServerError)
+			return
+		}
+		if status == WebhookEventStatusProcessing {
+			// Another delivery is processing event right now, so ask Stripe to retry in case it fails
+			log.Printf("Webhook: Event is being processed (%s, %s)", event.Type, event.ID)
+			c.Status(http.StatusConflict)
+			return
+		}
+		log.Printf("Webhook: Duplicate delivery skipped (%s, %s, status: %s)", event.Type, event.ID, status)
+	}
+
+	// Notify Stripe that webhook event was successfully received
+	c.Status(http.StatusOK)
+}
+
+// Function to list webhook events (GET /api/admin/webhook-events?status=failed&cursor=X&limit=Y)
+// Lists failed events unless other status is given, newest first
+func AdminListWebhookEventsHandler(c *gin.Context) {
+	params := newQueryParser(c)
+	status := params.enumParam("status", WebhookEventStatusFailed, webhookEventStatusValues)
+	limit := params.intParam("limit", defaultWebhookEventsLimit, 1, MaxPerPage)
+
+	conditions := []sqlCondition{{Clause: "e.status = ?", Params: []interface{}{status}}}
+	if cursor := c.Query("cursor"); cursor != "" {
+		cursorCond, err := webhookEventsOrder.after(cursor)
+		if err != nil {
+			params.invalidCursor()
+		}
+		conditions = append(conditions, cursorCond)
+	}
+	if params.failed() {
+		return
+	}
+	whereClause, whereParams := buildWhereClause(conditions, "") // Function defined in product_filter.go file
+	orderByClause, _ := webhookEventsOrder.orderBy()
+
+	query := fmt.Sprintf("SELECT %s FROM webhook_events AS e %s %s LIMIT ?", webhookEventColumns, whereClause, orderByClause)
+	rows, err := database.GetDB().Query(query, append(whereParams, limit+1)...)
+	if err != nil {
+		log.Printf("Webhook event list retrieval error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	defer rows.Close()
+
+	events := []WebhookEvent{}
+	for rows.Next() {
+		e, err := scanWebhookEvent(rows)
+		if err != nil {
+			log.Printf("Webhook event scan error: %v", err)
+			c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+			return
+		}
+		events = append(events, e)
+	}
+	if err := rows.Err(); err != nil {
+		log.Printf("Webhook event row error: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	// Extra event only signals that a next page exists
+	eventCount := len(events)
+	if eventCount > limit {
+		events = events[:limit]
+	}
+	var lastKeys []interface{}
+	if len(events) > 0 {
+		lastKeys = []interface{}{events[len(events)-1].ID}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events":     events,
+		"nextCursor": nextCursor(webhookEventsOrder, eventCount, limit, lastKeys),
+	})
+}
+
+// Function to get webhook event with payload (GET /api/admin/webhook-events/:id)
+func AdminGetWebhookEventHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	e, err := getWebhookEvent(database.GetDB(), id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook event retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	c.JSON(http.StatusOK, e)
+}
+
+// Function to process failed webhook event again from stored payload (POST /api/admin/webhook-events/:id/replay)
+// (Order updates check current state, so replaying an event that was partly applied is safe)
+func AdminReplayWebhookEventHandler(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid event ID"})
+		return
+	}
+
+	db := database.GetDB()
+	e, err := getWebhookEvent(db, id)
+	if errors.Is(err, sql.ErrNoRows) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Event not found"})
+		return
+	}
+	if err != nil {
+		log.Printf("Webhook event retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	if e.Status != WebhookEventStatusFailed {
+		c.JSON(http.StatusConflict, gin.H{"error": fmt.Sprintf("Only failed events can be replayed (status: %s)", e.Status)})
+		return
+	}
+
+	// Payload was verified when it was received, so it isn't verified again
+	var event stripe.Event
+	if err := json.Unmarshal(e.Payload, &event); err != nil {
+		log.Printf("Webhook event payload parsing error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+
+	ran, processErr := runWebhookEvent(db, id, event)
+	if !ran && processErr == nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "Event is already being processed"})
+		return
+	}
+	if processErr != nil {
+		log.Printf("Webhook event replay error (ID=%d, %s): %v", id, event.Type, processErr)
+	} else {
+		log.Printf("Webhook event replayed (ID=%d, %s)", id, event.Type)
+	}
+
+	// Return event with result of replay
+	e, err = getWebhookEvent(db, id)
+	if err != nil {
+		log.Printf("Webhook event retrieval error (ID=%d): %v", id, err)
+		c.JSON(http.StatusInternalServerError, gin.H{"error": ErrServerError})
+		return
+	}
+	e.Payload = nil
+	c.JSON(http.StatusOK, e)
+}
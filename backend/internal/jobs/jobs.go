@@ -0,0 +1,301 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+)
+
+// Job status values (jobs.status column)
+const (
+	StatusPending   = "pending"   // Waiting for run_at
+	StatusRunning   = "running"   // Claimed by worker
+	StatusCompleted = "completed" // Handler succeeded
+	StatusDead      = "dead"      // Gave up after max attempts (kept for inspection and manual retry)
+)
+
+// How often idle workers look for due jobs
+const pollInterval = time.Second
+
+// Running jobs not finished within this time are treated as abandoned (process crashed) and claimed again
+const lockTimeout = 10 * time.Minute
+
+// Maximum time one handler call may take
+const runTimeout = 2 * time.Minute
+
+// Retry delay after first failure, doubled on each following failure up to maxBackoff
+const (
+	baseBackoff = 10 * time.Second
+	maxBackoff  = time.Hour
+)
+
+// How long completed jobs are kept before being deleted
+const completedRetention = 7 * 24 * time.Hour
+
+// Maximum length of error message stored in last_error
+const maxErrorLength = 1000
+
+// Handler runs one job with its payload
+// Returning error schedules retry (or marks job dead after max attempts), so handlers must be safe to run again
+type Handler func(ctx context.Context, payload json.RawMessage) error
+
+// Execer is satisfied by both *sql.DB and *sql.Tx
+type Execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// Enqueue adds job to jobs table
+// Pass transaction of business change, so job is only stored (and run) if the change is committed
+func Enqueue(exec Execer, kind string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("encode %s job payload: %w", kind, err)
+	}
+	_, err = exec.Exec("INSERT INTO jobs (kind, payload) VALUES (?, ?)", kind, data)
+	return err
+}
+
+// Backoff returns delay before next run after job failed for attempt-th time (1-based)
+func Backoff(attempt int) time.Duration {
+	delay := baseBackoff
+	for i := 1; i < attempt && delay < maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > maxBackoff {
+		delay = maxBackoff
+	}
+	return delay
+}
+
+// Job claimed by worker
+type job struct {
+	ID          int64
+	Kind        string
+	Payload     json.RawMessage
+	Attempts    int // Including current run
+	MaxAttempts int
+}
+
+// Runner runs stored jobs with pool of worker goroutines
+type Runner struct {
+	db       *sql.DB
+	workers  int
+	handlers map[string]Handler
+
+	stop   chan struct{}   // Closed to stop claiming new jobs
+	ctx    context.Context // Passed to handlers (canceled when shutdown deadline passes)
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewRunner creates runner with given number of workers
+// Handlers are registered with Register before calling Start
+func NewRunner(db *sql.DB, workers int) *Runner {
+	if workers < 1 {
+		workers = 1
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Runner{
+		db:       db,
+		workers:  workers,
+		handlers: make(map[string]Handler),
+		stop:     make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+	}
+}
+
+// Register sets handler of job kind
+func (r *Runner) Register(kind string, h Handler) {
+	r.handlers[kind] = h
+}
+
+// Start starts worker goroutines and sweeper deleting old completed jobs
+func (r *Runner) Start() {
+	for i := 0; i < r.workers; i++ {
+		r.wg.Add(1)
+		go r.work()
+	}
+	r.wg.Add(1)
+	go r.sweep()
+	log.Printf("Job runner started with %d workers", r.workers)
+}
+
+// Shutdown stops claiming new jobs and waits for running jobs to finish
+// If ctx expires first, running handlers are canceled and ctx error is returned
+// (jobs interrupted before recording their result are claimed again after lock timeout)
+func (r *Runner) Shutdown(ctx context.Context) error {
+	close(r.stop)
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		r.cancel()
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		return ctx.Err()
+	}
+}
+
+// Worker loop: run due jobs one after another, wait for poll interval when there are none
+func (r *Runner) work() {
+	defer r.wg.Done()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		default:
+		}
+
+		j, err := r.claim()
+		if err != nil {
+			log.Printf("Job claim error: %v", err)
+		}
+		if j == nil {
+			select {
+			case <-r.stop:
+				return
+			case <-time.After(pollInterval):
+			}
+			continue
+		}
+		r.run(j)
+	}
+}
+
+// Function to claim oldest due job (nil if none)
+// SKIP LOCKED lets workers (also of other server instances) claim different jobs without waiting for each other
+func (r *Runner) claim() (*job, error) {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var j job
+	err = tx.QueryRow(`
+		SELECT id, kind, payload, attempts, max_attempts
+		FROM jobs
+		WHERE (status = 'pending' AND run_at <= NOW())
+			OR (status = 'running' AND locked_at < NOW() - INTERVAL ? SECOND)
+		ORDER BY run_at, id
+		LIMIT 1
+		FOR UPDATE SKIP LOCKED
+	`, int(lockTimeout.Seconds())).Scan(&j.ID, &j.Kind, &j.Payload, &j.Attempts, &j.MaxAttempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = tx.Exec(
+		"UPDATE jobs SET status = 'running', attempts = attempts + 1, locked_at = NOW() WHERE id = ?", j.ID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	j.Attempts++
+	return &j, nil
+}
+
+// Function to run claimed job and record result
+func (r *Runner) run(j *job) {
+	err := r.call(j)
+	if err == nil {
+		_, err := r.db.Exec(
+			"UPDATE jobs SET status = 'completed', locked_at = NULL, last_error = NULL, completed_at = NOW() WHERE id = ?", j.ID,
+		)
+		if err != nil {
+			log.Printf("Job result update error (ID=%d): %v", j.ID, err)
+		}
+		return
+	}
+
+	message := err.Error()
+	if len(message) > maxErrorLength {
+		message = message[:maxErrorLength]
+	}
+
+	// Give up after max attempts (dead jobs stay in table until retried by admin)
+	if j.Attempts >= j.MaxAttempts {
+		log.Printf("Job failed permanently (ID=%d, Kind=%s, Attempts=%d): %v", j.ID, j.Kind, j.Attempts, err)
+		_, err := r.db.Exec(
+			"UPDATE jobs SET status = 'dead', locked_at = NULL, last_error = ? WHERE id = ?", message, j.ID,
+		)
+		if err != nil {
+			log.Printf("Job result update error (ID=%d): %v", j.ID, err)
+		}
+		return
+	}
+
+	delay := Backoff(j.Attempts)
+	log.Printf("Job failed, retrying in %s (ID=%d, Kind=%s, Attempt=%d): %v", delay, j.ID, j.Kind, j.Attempts, err)
+	_, err = r.db.Exec(`
+		UPDATE jobs SET status = 'pending', locked_at = NULL, last_error = ?, run_at = NOW() + INTERVAL ? SECOND
+		WHERE id = ?
+	`, message, int(delay.Seconds()), j.ID)
+	if err != nil {
+		log.Printf("Job result update error (ID=%d): %v", j.ID, err)
+	}
+}
+
+// Function to call handler of job, turning panic into error
+func (r *Runner) call(j *job) (err error) {
+	h, ok := r.handlers[j.Kind]
+	if !ok {
+		return fmt.Errorf("no handler registered for job kind %q", j.Kind)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("panic: %v", p)
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(r.ctx, runTimeout)
+	defer cancel()
+	return h(ctx, j.Payload)
+}
+
+// Sweeper loop: delete completed jobs older than retention period once an hour
+func (r *Runner) sweep() {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+		}
+		result, err := r.db.Exec(
+			"DELETE FROM jobs WHERE status = 'completed' AND completed_at < NOW() - INTERVAL ? SECOND",
+			int(completedRetention.Seconds()),
+		)
+		if err != nil {
+			log.Printf("Job sweep error: %v", err)
+			continue
+		}
+		if deleted, _ := result.RowsAffected(); deleted > 0 {
+			log.Printf("Job sweep: deleted %d completed jobs", deleted)
+		}
+	}
+}
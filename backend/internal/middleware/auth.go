@@ -39,6 +39,20 @@ func AuthMiddleware() gin.HandlerFunc {
 	}
 }
 
+// Middleware function to identify user from JWT token if present
+// Unlike AuthMiddleware, requests without valid token continue as anonymous visitors
+func OptionalAuthMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tokenString, err := c.Cookie(handler.AuthTokenCookieName)
+		if err == nil {
+			if claims, err := handler.VerifyToken(tokenString); err == nil {
+				c.Set("user", claims)
+			}
+		}
+		c.Next()
+	}
+}
+
 // Middleware function to check admin privileges
 func AdminAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -0,0 +1,252 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/yukaty/go-trailhead/backend/internal/database"
+	"github.com/yukaty/go-trailhead/backend/internal/handler"
+)
+
+// Request header carrying client-generated idempotency key
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// Response header set when stored response is replayed
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// How long responses are kept for replay (keys can be reused after that)
+const idempotencyKeyTTL = 24 * time.Hour
+
+// Keys left in processing status longer than this are treated as abandoned (e.g. server restarted mid-request)
+// and can be reserved again
+const idempotencyKeyProcessingTimeout = 5 * time.Minute
+
+// Interval between sweeps deleting expired keys
+const idempotencyKeySweepInterval = time.Hour
+
+// Maximum length of idempotency key (column size)
+const maxIdempotencyKeyLength = 255
+
+// MySQL error number of duplicate key violation
+const mysqlErrDuplicateEntry = 1062
+
+// Response writer that keeps a copy of response body, so it can be stored for replay
+type recordingWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *recordingWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *recordingWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// Stored idempotency key record
+type idempotencyRecord struct {
+	RequestHash         string
+	Status              string // "processing" or "completed"
+	ResponseStatus      sql.NullInt64
+	ResponseContentType sql.NullString
+	ResponseBody        []byte
+}
+
+// Function to hash request, so retries with a different request can be detected
+// Multipart boundary is random per submission, so it's removed before hashing
+func hashRequest(c *gin.Context, body []byte) string {
+	if _, params, err := mime.ParseMediaType(c.ContentType()); err == nil && params["boundary"] != "" {
+		body = bytes.ReplaceAll(body, []byte(params["boundary"]), nil)
+	}
+	h := sha256.New()
+	io.WriteString(h, c.Request.Method+" "+c.Request.URL.Path+"\n")
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Function to scope key of anonymous visitor to their cart token
+// Hash keeps stored key within column size and doesn't store cart token itself
+func anonymousIdempotencyKey(cartToken string, key string) string {
+	h := sha256.Sum256([]byte(cartToken + "\n" + key))
+	return "cart:" + hex.EncodeToString(h[:])
+}
+
+// Function to get stored record of key
+func getIdempotencyRecord(db *sql.DB, userID int, key string) (idempotencyRecord, error) {
+	var r idempotencyRecord
+	err := db.QueryRow(`
+		SELECT request_hash, status, response_status, response_content_type, response_body
+		FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ?
+	`, userID, key).Scan(&r.RequestHash, &r.Status, &r.ResponseStatus, &r.ResponseContentType, &r.ResponseBody)
+	return r, err
+}
+
+// Function to reserve key for new request
+// Returns false (without error) if key is already stored, not expired and not abandoned
+func reserveIdempotencyKey(db *sql.DB, userID int, key string, requestHash string) (bool, error) {
+	// Expired or abandoned key of same user is deleted first, so it can be used again
+	_, err := db.Exec(`
+		DELETE FROM idempotency_keys
+		WHERE user_id = ? AND idempotency_key = ?
+			AND (created_at < NOW() - INTERVAL ? SECOND OR (status = 'processing' AND updated_at < NOW() - INTERVAL ? SECOND))
+	`, userID, key, int(idempotencyKeyTTL.Seconds()), int(idempotencyKeyProcessingTimeout.Seconds()))
+	if err != nil {
+		return false, err
+	}
+
+	_, err = db.Exec(
+		"INSERT INTO idempotency_keys (user_id, idempotency_key, request_hash) VALUES (?, ?, ?)",
+		userID, key, requestHash,
+	)
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlErrDuplicateEntry {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// Middleware function to make requests with Idempotency-Key header safe to retry
+// First request with a key is processed and its response is stored; retries with the same key and request
+// get the stored response instead of being processed again (e.g. double-clicked checkout creates one order)
+// Must run after AuthMiddleware or OptionalAuthMiddleware, since keys are scoped per user
+// Requests without header, and anonymous requests without cart token, are processed as usual
+func IdempotencyMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be 255 characters or less"})
+			return
+		}
+
+		// Anonymous visitors are stored under user ID 0 with key scoped to their cart token cookie
+		// (random and HttpOnly, so other visitors can't replay their responses); without one, request is processed as usual
+		userID := 0
+		if claims, ok := handler.GetUserFromContext(c); ok {
+			userID = claims.UserID
+		} else {
+			cartToken, err := c.Cookie(handler.CartTokenCookieName)
+			if err != nil || cartToken == "" {
+				c.Next()
+				return
+			}
+			key = anonymousIdempotencyKey(cartToken, key)
+		}
+
+		// Read request body (and put it back for handler)
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			log.Printf("Idempotency middleware: Request body read error: %v", err)
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": handler.ErrInvalidInput})
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		requestHash := hashRequest(c, body)
+
+		db := database.GetDB()
+		reserved, err := reserveIdempotencyKey(db, userID, key, requestHash)
+		if err != nil {
+			log.Printf("Idempotency middleware: Key registration error (UserID=%d): %v", userID, err)
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": handler.ErrServerError})
+			return
+		}
+
+		// Key was used before: replay stored response, or report conflict
+		if !reserved {
+			record, err := getIdempotencyRecord(db, userID, key)
+			if errors.Is(err, sql.ErrNoRows) {
+				// First request failed and released key just now
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is being processed. Please retry"})
+				return
+			}
+			if err != nil {
+				log.Printf("Idempotency middleware: Key retrieval error (UserID=%d): %v", userID, err)
+				c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": handler.ErrServerError})
+				return
+			}
+			switch {
+			case record.RequestHash != requestHash:
+				c.AbortWithStatusJSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			case record.Status != "completed":
+				c.AbortWithStatusJSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is being processed. Please retry"})
+			default:
+				c.Header(IdempotentReplayedHeader, "true")
+				c.Data(int(record.ResponseStatus.Int64), record.ResponseContentType.String, record.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		// Process request, recording response
+		writer := &recordingWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+		stored := false
+		defer func() {
+			// Release key if response wasn't stored (server error or panic), so request can be retried
+			if stored {
+				return
+			}
+			if _, err := db.Exec("DELETE FROM idempotency_keys WHERE user_id = ? AND idempotency_key = ?", userID, key); err != nil {
+				log.Printf("Idempotency middleware: Key release error (UserID=%d): %v", userID, err)
+			}
+		}()
+
+		c.Next()
+
+		// Server errors aren't stored (retry may succeed)
+		status := writer.Status()
+		if status >= http.StatusInternalServerError {
+			return
+		}
+		_, err = db.Exec(`
+			UPDATE idempotency_keys
+			SET status = 'completed', response_status = ?, response_content_type = ?, response_body = ?
+			WHERE user_id = ? AND idempotency_key = ?
+		`, status, writer.Header().Get("Content-Type"), writer.body.Bytes(), userID, key)
+		if err != nil {
+			log.Printf("Idempotency middleware: Response registration error (UserID=%d): %v", userID, err)
+			return
+		}
+		stored = true
+	}
+}
+
+// Function to start background sweeper deleting expired idempotency keys
+// Runs until process exits
+func StartIdempotencyKeySweeper() {
+	go func() {
+		ticker := time.NewTicker(idempotencyKeySweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := database.GetDB().Exec(
+				"DELETE FROM idempotency_keys WHERE created_at < NOW() - INTERVAL ? SECOND", int(idempotencyKeyTTL.Seconds()),
+			)
+			if err != nil {
+				log.Printf("Idempotency key sweep error: %v", err)
+				continue
+			}
+			if deleted, _ := result.RowsAffected(); deleted > 0 {
+				log.Printf("Idempotency key sweep: deleted %d expired keys", deleted)
+			}
+		}
+	}()
+}
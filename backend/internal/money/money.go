@@ -0,0 +1,94 @@
+package money
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Currency is ISO 4217 currency code in upper case (e.g. "USD").
+// Amounts are always integers in the currency's minor unit (cents for USD, yen for JPY).
+type Currency string
+
+// Currencies without minor unit (amounts are whole units)
+// Same list Stripe uses for zero-decimal currencies
+var zeroDecimal = map[Currency]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// Currencies with three decimal places
+var threeDecimal = map[Currency]bool{
+	"BHD": true, "JOD": true, "KWD": true, "OMR": true, "TND": true,
+}
+
+// Pattern of currency codes (after upper-casing)
+var codePattern = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// ErrInvalidAmount is returned when amount text can't be converted to minor units
+var ErrInvalidAmount = errors.New("invalid amount")
+
+// Parse normalizes currency code (case-insensitive)
+func Parse(code string) (Currency, error) {
+	c := Currency(strings.ToUpper(strings.TrimSpace(code)))
+	if !codePattern.MatchString(string(c)) {
+		return "", fmt.Errorf("invalid currency code %q", code)
+	}
+	return c, nil
+}
+
+// Exponent returns number of decimal places of currency's minor unit
+func (c Currency) Exponent() int {
+	switch {
+	case zeroDecimal[c]:
+		return 0
+	case threeDecimal[c]:
+		return 3
+	}
+	return 2
+}
+
+// StripeCode returns code in the lower case form Stripe expects
+func (c Currency) StripeCode() string {
+	return strings.ToLower(string(c))
+}
+
+// ParseAmount converts amount in major units (e.g. "12.50") to minor units (1250 for USD).
+// Amounts with more decimal places than the currency has are rejected, not rounded.
+func (c Currency) ParseAmount(text string) (int, error) {
+	text = strings.TrimSpace(text)
+	whole, fraction, hasFraction := strings.Cut(text, ".")
+	if whole == "" || strings.HasPrefix(whole, "+") || strings.HasPrefix(whole, "-") {
+		return 0, ErrInvalidAmount
+	}
+	exp := c.Exponent()
+	if hasFraction && (fraction == "" || len(fraction) > exp) {
+		return 0, ErrInvalidAmount
+	}
+	fraction += strings.Repeat("0", exp-len(fraction))
+
+	amount, err := strconv.Atoi(whole + fraction)
+	if err != nil {
+		return 0, ErrInvalidAmount
+	}
+	return amount, nil
+}
+
+// Format returns amount in minor units as text in major units with currency code (e.g. "12.50 USD")
+func (c Currency) Format(amount int) string {
+	exp := c.Exponent()
+	if exp == 0 {
+		return fmt.Sprintf("%d %s", amount, c)
+	}
+	sign := ""
+	if amount < 0 {
+		sign, amount = "-", -amount
+	}
+	unit := 1
+	for i := 0; i < exp; i++ {
+		unit *= 10
+	}
+	return fmt.Sprintf("%s%d.%0*d %s", sign, amount/unit, exp, amount%unit, c)
+}
@@ -0,0 +1,347 @@
+package payment
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/webhook"
+)
+
+// Fake is in-memory Provider for tests and offline development.
+// It keeps sessions, discounts and refunds in memory and emits webhook events signed with its own secret,
+// so checkout can be run through the webhook handler end to end without network:
+//
+//	fake := payment.NewFake("whsec_test")
+//	handler.Payments = fake
+//	// ... POST /api/orders/checkout, then take session ID from fake.Sessions()
+//	event, _ := fake.CompleteSession(sessionID)
+//	router.ServeHTTP(recorder, event.Request("/api/orders/webhook"))
+type Fake struct {
+	mu            sync.Mutex
+	webhookSecret string
+	instance      string // Part of object IDs, so IDs stay unique across Fake instances sharing a database
+	seq           int
+	discounts     map[string]DiscountParams
+	sessions      map[string]*FakeSession
+	order         []string // Session IDs in creation order
+	refunds       []FakeRefund
+	events        []SignedEvent // Emitted events not taken yet
+}
+
+// FakeSession is Checkout session stored by Fake
+type FakeSession struct {
+	ID              string
+	Params          SessionParams
+	Status          stripe.CheckoutSessionStatus
+	PaymentStatus   stripe.CheckoutSessionPaymentStatus
+	PaymentIntentID string // Set when session is completed
+	DiscountAmount  int64  // Amount of discount at creation (discount may be deleted afterwards)
+}
+
+// FakeRefund is refund stored by Fake
+type FakeRefund struct {
+	stripe.Refund
+	Params RefundParams
+}
+
+// SignedEvent is webhook event emitted by Fake, with signature header value
+type SignedEvent struct {
+	ID        string
+	Type      string
+	Payload   []byte
+	Signature string
+}
+
+// Request builds webhook request delivering event to target URL (or path, for use with httptest)
+func (e SignedEvent) Request(target string) *http.Request {
+	req, err := http.NewRequest(http.MethodPost, target, bytes.NewReader(e.Payload))
+	if err != nil {
+		panic(fmt.Sprintf("payment: invalid webhook target %q: %v", target, err))
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, e.Signature)
+	return req
+}
+
+// NewFake creates Fake provider signing events with webhook secret
+func NewFake(webhookSecret string) *Fake {
+	return &Fake{
+		webhookSecret: webhookSecret,
+		instance:      strconv.FormatInt(time.Now().UnixNano(), 36),
+		discounts:     make(map[string]DiscountParams),
+		sessions:      make(map[string]*FakeSession),
+	}
+}
+
+// Function to generate next object ID with prefix (caller holds lock)
+func (f *Fake) nextID(prefix string) string {
+	f.seq++
+	return fmt.Sprintf("%s_fake%s_%d", prefix, f.instance, f.seq)
+}
+
+// CreateDiscount stores discount
+func (f *Fake) CreateDiscount(ctx context.Context, params DiscountParams) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if params.Amount <= 0 {
+		return "", fmt.Errorf("discount amount must be positive")
+	}
+	id := f.nextID("coupon")
+	f.discounts[id] = params
+	return id, nil
+}
+
+// DeleteDiscount removes discount
+func (f *Fake) DeleteDiscount(ctx context.Context, id string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.discounts, id)
+	return nil
+}
+
+// CreateCheckoutSession stores open session
+func (f *Fake) CreateCheckoutSession(ctx context.Context, params SessionParams) (*Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if len(params.LineItems) == 0 {
+		return nil, fmt.Errorf("session needs at least one line item")
+	}
+	discountAmount := int64(0)
+	if params.DiscountID != "" {
+		d, ok := f.discounts[params.DiscountID]
+		if !ok {
+			return nil, fmt.Errorf("no such discount: %s", params.DiscountID)
+		}
+		discountAmount = d.Amount
+	}
+
+	id := f.nextID("cs")
+	f.sessions[id] = &FakeSession{
+		ID:             id,
+		Params:         params,
+		Status:         stripe.CheckoutSessionStatusOpen,
+		PaymentStatus:  stripe.CheckoutSessionPaymentStatusUnpaid,
+		DiscountAmount: discountAmount,
+	}
+	f.order = append(f.order, id)
+	return &Session{ID: id, URL: "https://checkout.fake.local/pay/" + id}, nil
+}
+
+// ExpireCheckoutSession expires open session and emits checkout.session.expired event (like Stripe does)
+func (f *Fake) ExpireCheckoutSession(ctx context.Context, id string) error {
+	_, err := f.ExpireSession(id)
+	return err
+}
+
+// CreateRefund stores succeeded refund of completed session's payment
+func (f *Fake) CreateRefund(ctx context.Context, params RefundParams) (*stripe.Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	// Retried request returns first refund
+	if params.IdempotencyKey != "" {
+		for _, r := range f.refunds {
+			if r.Params.IdempotencyKey == params.IdempotencyKey {
+				refund := r.Refund
+				return &refund, nil
+			}
+		}
+	}
+
+	var paid *FakeSession
+	for _, s := range f.sessions {
+		if s.PaymentIntentID != "" && s.PaymentIntentID == params.PaymentIntentID {
+			paid = s
+		}
+	}
+	if paid == nil {
+		return nil, fmt.Errorf("no such payment intent: %s", params.PaymentIntentID)
+	}
+	refunded := int64(0)
+	for _, r := range f.refunds {
+		if r.Params.PaymentIntentID == params.PaymentIntentID {
+			refunded += r.Amount
+		}
+	}
+	if params.Amount <= 0 || refunded+params.Amount > f.sessionTotal(paid) {
+		return nil, fmt.Errorf("refund amount exceeds remaining payment")
+	}
+
+	refund := stripe.Refund{
+		ID:            f.nextID("re"),
+		Object:        "refund",
+		Amount:        params.Amount,
+		Currency:      stripe.Currency(paid.Params.Currency),
+		Status:        stripe.RefundStatusSucceeded,
+		Reason:        stripe.RefundReason(params.Reason),
+		Metadata:      params.Metadata,
+		PaymentIntent: &stripe.PaymentIntent{ID: params.PaymentIntentID},
+	}
+	f.refunds = append(f.refunds, FakeRefund{Refund: refund, Params: params})
+	return &refund, nil
+}
+
+// ListRefunds returns refunds of payment
+func (f *Fake) ListRefunds(ctx context.Context, paymentIntentID string) ([]*stripe.Refund, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	refunds := []*stripe.Refund{}
+	for _, r := range f.refunds {
+		if r.Params.PaymentIntentID == paymentIntentID {
+			refund := r.Refund
+			refunds = append(refunds, &refund)
+		}
+	}
+	return refunds, nil
+}
+
+// VerifyWebhook checks signature of event emitted by Fake
+func (f *Fake) VerifyWebhook(payload []byte, signature string) (stripe.Event, error) {
+	if f.webhookSecret == "" {
+		return stripe.Event{}, ErrWebhookSecretNotSet
+	}
+	return webhook.ConstructEventWithOptions(payload, signature, f.webhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true,
+	})
+}
+
+// CompleteSession marks open session as paid and emits checkout.session.completed event
+func (f *Fake) CompleteSession(id string) (SignedEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.sessions[id]
+	if !ok {
+		return SignedEvent{}, fmt.Errorf("no such checkout session: %s", id)
+	}
+	if s.Status != stripe.CheckoutSessionStatusOpen {
+		return SignedEvent{}, fmt.Errorf("checkout session %s is %s", id, s.Status)
+	}
+	s.Status = stripe.CheckoutSessionStatusComplete
+	s.PaymentStatus = stripe.CheckoutSessionPaymentStatusPaid
+	s.PaymentIntentID = f.nextID("pi")
+	return f.emit("checkout.session.completed", f.sessionObject(s))
+}
+
+// ExpireSession expires open session (as if customer abandoned payment page) and emits checkout.session.expired event
+// Already expired session emits nothing; paid session returns ErrSessionCompleted
+func (f *Fake) ExpireSession(id string) (SignedEvent, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s, ok := f.sessions[id]
+	if !ok {
+		return SignedEvent{}, fmt.Errorf("no such checkout session: %s", id)
+	}
+	switch s.Status {
+	case stripe.CheckoutSessionStatusExpired:
+		return SignedEvent{}, nil
+	case stripe.CheckoutSessionStatusComplete:
+		return SignedEvent{}, ErrSessionCompleted
+	}
+	s.Status = stripe.CheckoutSessionStatusExpired
+	return f.emit("checkout.session.expired", f.sessionObject(s))
+}
+
+// Sessions returns copies of all sessions in creation order
+func (f *Fake) Sessions() []FakeSession {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	sessions := make([]FakeSession, 0, len(f.order))
+	for _, id := range f.order {
+		sessions = append(sessions, *f.sessions[id])
+	}
+	return sessions
+}
+
+// Discounts returns IDs of discounts not deleted yet
+func (f *Fake) Discounts() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ids := make([]string, 0, len(f.discounts))
+	for id := range f.discounts {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+// Refunds returns copies of all refunds in creation order
+func (f *Fake) Refunds() []FakeRefund {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return append([]FakeRefund(nil), f.refunds...)
+}
+
+// TakeEvents returns events emitted since last call (including events of ExpireCheckoutSession calls made by handlers)
+func (f *Fake) TakeEvents() []SignedEvent {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	events := f.events
+	f.events = nil
+	return events
+}
+
+// Function to calculate amount paid for session
+func (f *Fake) sessionTotal(s *FakeSession) int64 {
+	total := int64(0)
+	for _, item := range s.Params.LineItems {
+		total += item.UnitAmount * item.Quantity
+	}
+	return total - s.DiscountAmount
+}
+
+// Function to build session object of webhook event, in Stripe's JSON format (caller holds lock)
+func (f *Fake) sessionObject(s *FakeSession) map[string]interface{} {
+	object := map[string]interface{}{
+		"id":             s.ID,
+		"object":         "checkout.session",
+		"status":         s.Status,
+		"payment_status": s.PaymentStatus,
+		"currency":       s.Params.Currency,
+		"amount_total":   f.sessionTotal(s),
+		"customer_email": s.Params.CustomerEmail,
+		"metadata":       s.Params.Metadata,
+		"success_url":    strings.ReplaceAll(s.Params.SuccessURL, "{CHECKOUT_SESSION_ID}", s.ID),
+	}
+	if s.PaymentIntentID != "" {
+		object["payment_intent"] = s.PaymentIntentID
+	}
+	return object
+}
+
+// Function to sign event and add it to emitted events (caller holds lock)
+func (f *Fake) emit(eventType string, object map[string]interface{}) (SignedEvent, error) {
+	id := f.nextID("evt")
+	payload, err := json.Marshal(map[string]interface{}{
+		"id":          id,
+		"object":      "event",
+		"type":        eventType,
+		"api_version": stripe.APIVersion,
+		"created":     time.Now().Unix(),
+		"data":        map[string]interface{}{"object": object},
+	})
+	if err != nil {
+		return SignedEvent{}, err
+	}
+
+	signed := webhook.GenerateTestSignedPayload(&webhook.UnsignedPayload{Payload: payload, Secret: f.webhookSecret})
+	event := SignedEvent{ID: id, Type: eventType, Payload: payload, Signature: signed.Header}
+	f.events = append(f.events, event)
+	return event, nil
+}
@@ -0,0 +1,190 @@
+package payment
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+const testWebhookSecret = "whsec_test"
+
+// Function to create open session of 2 x 1000 with discount of 300 (total 1700)
+func newDiscountedSession(t *testing.T, f *Fake) string {
+	t.Helper()
+	ctx := context.Background()
+	discountID, err := f.CreateDiscount(ctx, DiscountParams{Name: "SAVE", Amount: 300, Currency: "jpy"})
+	if err != nil {
+		t.Fatalf("CreateDiscount: %v", err)
+	}
+	s, err := f.CreateCheckoutSession(ctx, SessionParams{
+		Currency:   "jpy",
+		LineItems:  []LineItem{{Name: "Tent", UnitAmount: 1000, Quantity: 2}},
+		DiscountID: discountID,
+		Metadata:   map[string]string{"orderId": "1", "userId": "0"},
+	})
+	if err != nil {
+		t.Fatalf("CreateCheckoutSession: %v", err)
+	}
+	return s.ID
+}
+
+// Function to complete session and return its payment intent ID
+func completeSession(t *testing.T, f *Fake, id string) string {
+	t.Helper()
+	if _, err := f.CompleteSession(id); err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+	for _, s := range f.Sessions() {
+		if s.ID == id {
+			return s.PaymentIntentID
+		}
+	}
+	t.Fatalf("session %s not found", id)
+	return ""
+}
+
+func TestFakeVerifyWebhook(t *testing.T) {
+	f := NewFake(testWebhookSecret)
+	id := newDiscountedSession(t, f)
+	event, err := f.CompleteSession(id)
+	if err != nil {
+		t.Fatalf("CompleteSession: %v", err)
+	}
+
+	verified, err := f.VerifyWebhook(event.Payload, event.Signature)
+	if err != nil {
+		t.Fatalf("VerifyWebhook: %v", err)
+	}
+	if verified.ID != event.ID || verified.Type != "checkout.session.completed" {
+		t.Errorf("verified event = %s %s, want %s checkout.session.completed", verified.ID, verified.Type, event.ID)
+	}
+	var session stripe.CheckoutSession
+	if err := json.Unmarshal(verified.Data.Raw, &session); err != nil {
+		t.Fatalf("session unmarshal: %v", err)
+	}
+	if session.ID != id || session.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid || session.Metadata["orderId"] != "1" {
+		t.Errorf("session = %s %s %v, want %s paid with orderId 1", session.ID, session.PaymentStatus, session.Metadata, id)
+	}
+
+	// Tampered payload and signature of other secret are rejected
+	if _, err := f.VerifyWebhook(append([]byte(" "), event.Payload...), event.Signature); err == nil {
+		t.Error("VerifyWebhook accepted tampered payload")
+	}
+	if _, err := NewFake("whsec_other").VerifyWebhook(event.Payload, event.Signature); err == nil {
+		t.Error("VerifyWebhook accepted signature of other secret")
+	}
+	if _, err := NewFake("").VerifyWebhook(event.Payload, event.Signature); !errors.Is(err, ErrWebhookSecretNotSet) {
+		t.Errorf("VerifyWebhook without secret = %v, want ErrWebhookSecretNotSet", err)
+	}
+}
+
+func TestFakeCompleteSession(t *testing.T) {
+	f := NewFake(testWebhookSecret)
+	id := newDiscountedSession(t, f)
+	completeSession(t, f, id)
+
+	s := f.Sessions()[0]
+	if s.Status != stripe.CheckoutSessionStatusComplete || s.PaymentStatus != stripe.CheckoutSessionPaymentStatusPaid || s.PaymentIntentID == "" {
+		t.Errorf("session = %s/%s (payment intent %q), want complete/paid with payment intent", s.Status, s.PaymentStatus, s.PaymentIntentID)
+	}
+	if events := f.TakeEvents(); len(events) != 1 || events[0].Type != "checkout.session.completed" {
+		t.Errorf("events = %v, want one checkout.session.completed", events)
+	}
+	if _, err := f.CompleteSession(id); err == nil {
+		t.Error("completed session was completed again")
+	}
+	if err := f.ExpireCheckoutSession(context.Background(), id); !errors.Is(err, ErrSessionCompleted) {
+		t.Errorf("expiring paid session = %v, want ErrSessionCompleted", err)
+	}
+}
+
+func TestFakeExpireSession(t *testing.T) {
+	f := NewFake(testWebhookSecret)
+	id := newDiscountedSession(t, f)
+
+	if err := f.ExpireCheckoutSession(context.Background(), id); err != nil {
+		t.Fatalf("ExpireCheckoutSession: %v", err)
+	}
+	if s := f.Sessions()[0]; s.Status != stripe.CheckoutSessionStatusExpired {
+		t.Errorf("session status = %s, want expired", s.Status)
+	}
+
+	// Expiring again is not an error and emits no second event
+	if err := f.ExpireCheckoutSession(context.Background(), id); err != nil {
+		t.Errorf("expiring expired session = %v, want nil", err)
+	}
+	if events := f.TakeEvents(); len(events) != 1 || events[0].Type != "checkout.session.expired" {
+		t.Errorf("events = %v, want one checkout.session.expired", events)
+	}
+	if _, err := f.CompleteSession(id); err == nil {
+		t.Error("expired session was completed")
+	}
+}
+
+func TestFakeRefundLimit(t *testing.T) {
+	f := NewFake(testWebhookSecret)
+	ctx := context.Background()
+	id := newDiscountedSession(t, f)
+	paymentIntentID := completeSession(t, f, id)
+
+	// Deleting used discount doesn't change amount paid
+	for _, discountID := range f.Discounts() {
+		if err := f.DeleteDiscount(ctx, discountID); err != nil {
+			t.Fatalf("DeleteDiscount: %v", err)
+		}
+	}
+
+	if _, err := f.CreateRefund(ctx, RefundParams{PaymentIntentID: paymentIntentID, Amount: 1000}); err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	if _, err := f.CreateRefund(ctx, RefundParams{PaymentIntentID: paymentIntentID, Amount: 701}); err == nil {
+		t.Error("refund above remaining 700 was accepted")
+	}
+	r, err := f.CreateRefund(ctx, RefundParams{PaymentIntentID: paymentIntentID, Amount: 700})
+	if err != nil {
+		t.Fatalf("refund of remaining amount: %v", err)
+	}
+	if r.Status != stripe.RefundStatusSucceeded || r.PaymentIntent.ID != paymentIntentID {
+		t.Errorf("refund = %s for %s, want succeeded for %s", r.Status, r.PaymentIntent.ID, paymentIntentID)
+	}
+	if _, err := f.CreateRefund(ctx, RefundParams{PaymentIntentID: "pi_unknown", Amount: 100}); err == nil {
+		t.Error("refund of unknown payment was accepted")
+	}
+	if _, err := f.CreateRefund(ctx, RefundParams{PaymentIntentID: paymentIntentID, Amount: 0}); err == nil {
+		t.Error("refund of 0 was accepted")
+	}
+
+	refunds, err := f.ListRefunds(ctx, paymentIntentID)
+	if err != nil {
+		t.Fatalf("ListRefunds: %v", err)
+	}
+	if len(refunds) != 2 {
+		t.Errorf("ListRefunds returned %d refunds, want 2", len(refunds))
+	}
+}
+
+func TestFakeRefundIdempotencyKey(t *testing.T) {
+	f := NewFake(testWebhookSecret)
+	ctx := context.Background()
+	paymentIntentID := completeSession(t, f, newDiscountedSession(t, f))
+
+	params := RefundParams{PaymentIntentID: paymentIntentID, Amount: 1700, IdempotencyKey: "order-1-refund-1"}
+	first, err := f.CreateRefund(ctx, params)
+	if err != nil {
+		t.Fatalf("CreateRefund: %v", err)
+	}
+	// Retried request returns first refund instead of failing the amount check
+	retried, err := f.CreateRefund(ctx, params)
+	if err != nil {
+		t.Fatalf("retried CreateRefund: %v", err)
+	}
+	if retried.ID != first.ID {
+		t.Errorf("retried refund ID = %s, want %s", retried.ID, first.ID)
+	}
+	if n := len(f.Refunds()); n != 1 {
+		t.Errorf("Fake stored %d refunds, want 1", n)
+	}
+}
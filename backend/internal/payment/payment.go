@@ -0,0 +1,81 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/stripe/stripe-go/v83"
+)
+
+// ErrSessionCompleted is returned when expiring Checkout session that was already paid
+var ErrSessionCompleted = errors.New("checkout session is already completed")
+
+// ErrWebhookSecretNotSet is returned by VerifyWebhook when provider has no signing secret
+var ErrWebhookSecretNotSet = errors.New("webhook signing secret is not set")
+
+// Provider is payment service used for checkout and refunds.
+// Webhook events and refunds use Stripe's format (Fake emits events in the same format),
+// so webhook processing is shared by all providers.
+type Provider interface {
+	// CreateDiscount creates one-off discount of fixed amount, to be applied to one Checkout session
+	CreateDiscount(ctx context.Context, params DiscountParams) (string, error)
+	// DeleteDiscount deletes discount (already deleted discount is not an error)
+	DeleteDiscount(ctx context.Context, id string) error
+	// CreateCheckoutSession creates hosted payment page
+	CreateCheckoutSession(ctx context.Context, params SessionParams) (*Session, error)
+	// ExpireCheckoutSession closes session so it can't be paid anymore
+	// Already expired session is not an error; paid session returns ErrSessionCompleted
+	ExpireCheckoutSession(ctx context.Context, id string) error
+	// CreateRefund refunds (part of) payment
+	CreateRefund(ctx context.Context, params RefundParams) (*stripe.Refund, error)
+	// ListRefunds returns all refunds of payment
+	ListRefunds(ctx context.Context, paymentIntentID string) ([]*stripe.Refund, error)
+	// VerifyWebhook checks signature of webhook request and parses event
+	VerifyWebhook(payload []byte, signature string) (stripe.Event, error)
+}
+
+// Request header carrying webhook signature
+const SignatureHeader = "Stripe-Signature"
+
+// LineItem is one line of Checkout session
+type LineItem struct {
+	Name       string
+	UnitAmount int64 // In minor units of session currency
+	Quantity   int64
+}
+
+// DiscountParams describes one-off discount
+type DiscountParams struct {
+	Name     string
+	Amount   int64  // In minor units of currency
+	Currency string // Lower-case ISO 4217 code
+}
+
+// SessionParams describes Checkout session to create
+type SessionParams struct {
+	Currency      string // Lower-case ISO 4217 code
+	LineItems     []LineItem
+	DiscountID    string // Discount created with CreateDiscount (empty for none)
+	CustomerEmail string
+	SuccessURL    string // May contain {CHECKOUT_SESSION_ID} placeholder
+	CancelURL     string
+	ExpiresAt     time.Time
+	Metadata      map[string]string // Returned with webhook events of session
+	SubmitMessage string            // Shown next to pay button (empty for none)
+}
+
+// Session is created Checkout session
+type Session struct {
+	ID  string
+	URL string // Payment page customer is redirected to
+}
+
+// RefundParams describes refund to create
+type RefundParams struct {
+	PaymentIntentID string
+	Amount          int64  // In minor units of payment currency
+	Reason          string // duplicate, fraudulent or requested_by_customer (empty for none)
+	Metadata        map[string]string
+	IdempotencyKey  string // Retried requests with same key create refund only once
+}
@@ -0,0 +1,158 @@
+package payment
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/stripe/stripe-go/v83"
+	"github.com/stripe/stripe-go/v83/webhook"
+)
+
+// Stripe is Provider backed by Stripe API
+type Stripe struct {
+	client        *stripe.Client
+	webhookSecret string
+}
+
+// NewStripe creates Stripe provider with secret API key and webhook signing secret
+// Missing values are only warned about, so the server can start without payment configuration
+func NewStripe(secretKey string, webhookSecret string) *Stripe {
+	if secretKey == "" {
+		log.Println("Warning: STRIPE_SECRET_KEY environment variable is not set")
+	}
+	if webhookSecret == "" {
+		log.Println("Warning: STRIPE_WEBHOOK_SECRET environment variable is not set")
+	}
+	return &Stripe{client: stripe.NewClient(secretKey), webhookSecret: webhookSecret}
+}
+
+// CreateDiscount creates Stripe coupon that can be redeemed once
+func (s *Stripe) CreateDiscount(ctx context.Context, params DiscountParams) (string, error) {
+	c, err := s.client.V1Coupons.Create(ctx, &stripe.CouponCreateParams{
+		AmountOff:      stripe.Int64(params.Amount),
+		Currency:       stripe.String(params.Currency),
+		Duration:       stripe.String(string(stripe.CouponDurationOnce)),
+		MaxRedemptions: stripe.Int64(1),
+		Name:           stripe.String(params.Name),
+	})
+	if err != nil {
+		return "", err
+	}
+	return c.ID, nil
+}
+
+// DeleteDiscount deletes Stripe coupon
+func (s *Stripe) DeleteDiscount(ctx context.Context, id string) error {
+	_, err := s.client.V1Coupons.Delete(ctx, id, nil)
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusNotFound {
+		return nil
+	}
+	return err
+}
+
+// CreateCheckoutSession creates Stripe Checkout session in payment mode
+func (s *Stripe) CreateCheckoutSession(ctx context.Context, params SessionParams) (*Session, error) {
+	lineItems := make([]*stripe.CheckoutSessionCreateLineItemParams, 0, len(params.LineItems))
+	for _, item := range params.LineItems {
+		lineItems = append(lineItems, &stripe.CheckoutSessionCreateLineItemParams{
+			PriceData: &stripe.CheckoutSessionCreateLineItemPriceDataParams{
+				Currency: stripe.String(params.Currency),
+				ProductData: &stripe.CheckoutSessionCreateLineItemPriceDataProductDataParams{
+					Name: stripe.String(item.Name),
+				},
+				UnitAmount: stripe.Int64(item.UnitAmount),
+			},
+			Quantity: stripe.Int64(item.Quantity),
+		})
+	}
+
+	createParams := &stripe.CheckoutSessionCreateParams{
+		LineItems:     lineItems,
+		Mode:          stripe.String(string(stripe.CheckoutSessionModePayment)),
+		SuccessURL:    stripe.String(params.SuccessURL),
+		CancelURL:     stripe.String(params.CancelURL),
+		CustomerEmail: stripe.String(params.CustomerEmail),
+		ExpiresAt:     stripe.Int64(params.ExpiresAt.Unix()),
+		Metadata:      params.Metadata,
+	}
+	if params.DiscountID != "" {
+		createParams.Discounts = []*stripe.CheckoutSessionCreateDiscountParams{{Coupon: stripe.String(params.DiscountID)}}
+	}
+	if params.SubmitMessage != "" {
+		createParams.CustomText = &stripe.CheckoutSessionCreateCustomTextParams{
+			Submit: &stripe.CheckoutSessionCreateCustomTextSubmitParams{
+				Message: stripe.String(params.SubmitMessage),
+			},
+		}
+	}
+
+	cs, err := s.client.V1CheckoutSessions.Create(ctx, createParams)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{ID: cs.ID, URL: cs.URL}, nil
+}
+
+// ExpireCheckoutSession expires open Stripe Checkout session
+func (s *Stripe) ExpireCheckoutSession(ctx context.Context, id string) error {
+	_, expireErr := s.client.V1CheckoutSessions.Expire(ctx, id, nil)
+	if expireErr == nil {
+		return nil
+	}
+
+	// Expire fails unless session is open, so check why
+	cs, err := s.client.V1CheckoutSessions.Retrieve(ctx, id, nil)
+	if err != nil {
+		return err
+	}
+	switch cs.Status {
+	case stripe.CheckoutSessionStatusExpired:
+		return nil
+	case stripe.CheckoutSessionStatusComplete:
+		return ErrSessionCompleted
+	default:
+		return expireErr
+	}
+}
+
+// CreateRefund creates Stripe refund of payment intent
+func (s *Stripe) CreateRefund(ctx context.Context, params RefundParams) (*stripe.Refund, error) {
+	createParams := &stripe.RefundCreateParams{
+		PaymentIntent: stripe.String(params.PaymentIntentID),
+		Amount:        stripe.Int64(params.Amount),
+		Metadata:      params.Metadata,
+	}
+	if params.Reason != "" {
+		createParams.Reason = stripe.String(params.Reason)
+	}
+	if params.IdempotencyKey != "" {
+		createParams.SetIdempotencyKey(params.IdempotencyKey)
+	}
+
+	return s.client.V1Refunds.Create(ctx, createParams)
+}
+
+// ListRefunds lists Stripe refunds of payment intent (all pages)
+func (s *Stripe) ListRefunds(ctx context.Context, paymentIntentID string) ([]*stripe.Refund, error) {
+	refunds := []*stripe.Refund{}
+	for r, err := range s.client.V1Refunds.List(ctx, &stripe.RefundListParams{PaymentIntent: stripe.String(paymentIntentID)}) {
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, r)
+	}
+	return refunds, nil
+}
+
+// VerifyWebhook checks Stripe-Signature header with webhook signing secret
+func (s *Stripe) VerifyWebhook(payload []byte, signature string) (stripe.Event, error) {
+	if s.webhookSecret == "" {
+		return stripe.Event{}, ErrWebhookSecretNotSet
+	}
+	return webhook.ConstructEventWithOptions(payload, signature, s.webhookSecret, webhook.ConstructEventOptions{
+		IgnoreAPIVersionMismatch: true, // Ignore errors from API version differences
+	})
+}
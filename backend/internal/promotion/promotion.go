@@ -0,0 +1,196 @@
+package promotion
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Type is how discount of a coupon is calculated
+type Type string
+
+const (
+	TypePercentage Type = "percentage" // Value is percent off eligible items (1-100)
+	TypeFixed      Type = "fixed"      // Value is amount off eligible items
+)
+
+// IneligibleError is returned when a coupon cannot be applied to an order.
+// Reason is meant to be shown to customers.
+type IneligibleError struct {
+	Reason string
+}
+
+func (e *IneligibleError) Error() string {
+	return "coupon not applicable: " + e.Reason
+}
+
+func ineligible(reason string) error {
+	return &IneligibleError{Reason: reason}
+}
+
+// Coupon is discount code and the conditions under which it applies
+type Coupon struct {
+	ID             int
+	Code           string
+	Type           Type
+	Value          int
+	MinSubtotal    int        // Subtotal of whole order required to use coupon (0 for no minimum)
+	StartsAt       *time.Time // Valid from (nil for no start)
+	EndsAt         *time.Time // Valid until, exclusive (nil for no end)
+	MaxUses        *int       // Total number of uses (nil for unlimited)
+	MaxUsesPerUser *int       // Number of uses per customer (nil for unlimited)
+	ProductIDs     []int      // Products discounted by coupon
+	CategoryIDs    []int      // Categories discounted by coupon (including subcategories)
+	Enabled        bool
+}
+
+// Line is one item of an order
+type Line struct {
+	ProductID   int
+	CategoryIDs []int // Categories the product is assigned to
+	Amount      int   // Unit price × quantity
+}
+
+// Usage is number of orders that have already used a coupon
+type Usage struct {
+	Total  int
+	ByUser int // Orders of the customer checking out
+}
+
+// Pattern of coupon codes (after NormalizeCode)
+var codePattern = regexp.MustCompile(`^[A-Z0-9_-]{3,40}$`)
+
+// NormalizeCode trims and upper-cases code, so codes are matched case-insensitively
+func NormalizeCode(code string) string {
+	return strings.ToUpper(strings.TrimSpace(code))
+}
+
+// Validate checks coupon settings.
+// Returned error message is meant to be shown to admin users.
+func (c Coupon) Validate() error {
+	if !codePattern.MatchString(c.Code) {
+		return errors.New("code must be 3-40 letters, digits, - or _")
+	}
+	switch c.Type {
+	case TypePercentage:
+		if c.Value < 1 || c.Value > 100 {
+			return errors.New("percentage must be between 1 and 100")
+		}
+	case TypeFixed:
+		if c.Value < 1 {
+			return errors.New("discount amount must be greater than 0")
+		}
+	default:
+		return errors.New("type must be percentage or fixed")
+	}
+	if c.MinSubtotal < 0 {
+		return errors.New("minimum subtotal must be 0 or greater")
+	}
+	if c.StartsAt != nil && c.EndsAt != nil && !c.EndsAt.After(*c.StartsAt) {
+		return errors.New("end date must be after start date")
+	}
+	if c.MaxUses != nil && *c.MaxUses < 1 {
+		return errors.New("usage limit must be 1 or greater")
+	}
+	if c.MaxUsesPerUser != nil && *c.MaxUsesPerUser < 1 {
+		return errors.New("per customer usage limit must be 1 or greater")
+	}
+	return nil
+}
+
+// Scoped reports whether coupon is limited to some products or categories
+func (c Coupon) Scoped() bool {
+	return len(c.ProductIDs) > 0 || len(c.CategoryIDs) > 0
+}
+
+// Covers reports whether coupon discounts line
+func (c Coupon) Covers(line Line) bool {
+	if !c.Scoped() {
+		return true
+	}
+	for _, id := range c.ProductIDs {
+		if id == line.ProductID {
+			return true
+		}
+	}
+	for _, id := range c.CategoryIDs {
+		for _, lineCategoryID := range line.CategoryIDs {
+			if id == lineCategoryID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Discount checks coupon can be used at now and calculates discount of lines.
+// Discount never exceeds total of lines the coupon covers, and doesn't apply to shipping.
+// Returns *IneligibleError if coupon cannot be used.
+func (c Coupon) Discount(lines []Line, usage Usage, now time.Time) (int, error) {
+	if !c.Enabled {
+		return 0, ineligible("This coupon is not valid")
+	}
+	if c.StartsAt != nil && now.Before(*c.StartsAt) {
+		return 0, ineligible("This coupon is not valid yet")
+	}
+	if c.EndsAt != nil && !now.Before(*c.EndsAt) {
+		return 0, ineligible("This coupon has expired")
+	}
+	if c.MaxUses != nil && usage.Total >= *c.MaxUses {
+		return 0, ineligible("This coupon has reached its usage limit")
+	}
+	if c.MaxUsesPerUser != nil && usage.ByUser >= *c.MaxUsesPerUser {
+		return 0, ineligible("You have already used this coupon")
+	}
+
+	subtotal, eligible := 0, 0
+	for _, line := range lines {
+		subtotal += line.Amount
+		if c.Covers(line) {
+			eligible += line.Amount
+		}
+	}
+	if subtotal < c.MinSubtotal {
+		return 0, ineligible("Order subtotal is below the minimum for this coupon")
+	}
+	if eligible == 0 {
+		return 0, ineligible("This coupon doesn't apply to items in your cart")
+	}
+
+	discount := c.Value
+	if c.Type == TypePercentage {
+		discount = eligible * c.Value / 100 // Round down
+	}
+	if discount > eligible {
+		discount = eligible
+	}
+	return discount, nil
+}
+
+// Allocate spreads discount over lines the coupon covers, in proportion to their amounts
+// (used to calculate tax on discounted prices). Rounding remainder goes to the last covered line.
+func (c Coupon) Allocate(lines []Line, discount int) []int {
+	shares := make([]int, len(lines))
+	eligible, last := 0, -1
+	for i, line := range lines {
+		if c.Covers(line) {
+			eligible += line.Amount
+			last = i
+		}
+	}
+	if eligible == 0 {
+		return shares
+	}
+
+	allocated := 0
+	for i, line := range lines {
+		if !c.Covers(line) || i == last {
+			continue
+		}
+		shares[i] = discount * line.Amount / eligible
+		allocated += shares[i]
+	}
+	shares[last] = discount - allocated
+	return shares
+}
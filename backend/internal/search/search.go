@@ -0,0 +1,109 @@
+package search
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// MinTokenLength is the shortest word indexed by InnoDB FULLTEXT indexes
+// (innodb_ft_min_token_size, 3 by default). Shorter words never match MATCH ... AGAINST.
+const MinTokenLength = 3
+
+// Default InnoDB FULLTEXT stopwords (INFORMATION_SCHEMA.INNODB_FT_DEFAULT_STOPWORD)
+// Stopwords are not indexed, so requiring them with "+" would match nothing
+var stopwords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true,
+	"be": true, "by": true, "com": true, "de": true, "en": true, "for": true,
+	"from": true, "how": true, "i": true, "in": true, "is": true, "it": true,
+	"la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true,
+	"who": true, "will": true, "with": true, "und": true, "www": true,
+}
+
+// Pattern matching quoted phrases ("...")
+var phrasePattern = regexp.MustCompile(`"([^"]*)"`)
+
+// Query is a parsed search keyword
+type Query struct {
+	Terms      []string // Words that must all appear (prefix match)
+	Phrases    []string // Exact phrases that must appear
+	ShortTerms []string // Words and phrases too short for FULLTEXT index (matched with LIKE instead)
+}
+
+// Parse splits user input into phrases ("quoted text") and individual words.
+// Characters with special meaning in boolean mode are removed, and stopwords are dropped.
+func Parse(input string) Query {
+	var q Query
+
+	// Extract quoted phrases first
+	// Phrases without any indexed word (e.g. "xl 5l") can never match the index, so they are matched with LIKE
+	for _, m := range phrasePattern.FindAllStringSubmatch(input, -1) {
+		words := tokenize(m[1])
+		if len(words) == 0 {
+			continue
+		}
+		if hasIndexedWord(words) {
+			q.Phrases = append(q.Phrases, strings.Join(words, " "))
+		} else {
+			q.ShortTerms = append(q.ShortTerms, strings.Join(words, " "))
+		}
+	}
+	rest := phrasePattern.ReplaceAllString(input, " ")
+
+	// Remaining text is split into individual words
+	seen := map[string]bool{}
+	for _, word := range tokenize(rest) {
+		if seen[word] || stopwords[word] {
+			continue
+		}
+		seen[word] = true
+		if !isIndexed(word) {
+			q.ShortTerms = append(q.ShortTerms, word)
+		} else {
+			q.Terms = append(q.Terms, word)
+		}
+	}
+	return q
+}
+
+// IsEmpty reports whether query has nothing to search for
+func (q Query) IsEmpty() bool {
+	return len(q.Terms) == 0 && len(q.Phrases) == 0 && len(q.ShortTerms) == 0
+}
+
+// BooleanMode returns search string for MATCH ... AGAINST (? IN BOOLEAN MODE)
+// Every word and phrase is required (AND semantics), words also match as prefixes
+// (e.g. "tent" matches "tents"). Returns empty string if there is nothing to match with the index.
+func (q Query) BooleanMode() string {
+	parts := make([]string, 0, len(q.Terms)+len(q.Phrases))
+	for _, phrase := range q.Phrases {
+		parts = append(parts, `+"`+phrase+`"`)
+	}
+	for _, term := range q.Terms {
+		parts = append(parts, "+"+term+"*")
+	}
+	return strings.Join(parts, " ")
+}
+
+// Function to check whether word is stored in FULLTEXT index (long enough and not a stopword)
+func isIndexed(word string) bool {
+	return len([]rune(word)) >= MinTokenLength && !stopwords[word]
+}
+
+// Function to check whether any of words is stored in FULLTEXT index
+func hasIndexedWord(words []string) bool {
+	for _, word := range words {
+		if isIndexed(word) {
+			return true
+		}
+	}
+	return false
+}
+
+// Function to lowercase text and split it into words made of letters and digits
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
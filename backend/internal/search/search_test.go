@@ -0,0 +1,36 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		input       string
+		wantBoolean string
+		wantShort   []string
+	}{
+		{input: "Tent", wantBoolean: "+tent*"},
+		{input: "the camping tent", wantBoolean: "+camping* +tent*"},
+		{input: `"rain jacket" blue`, wantBoolean: `+"rain jacket" +blue*`},
+		{input: "tent xl", wantBoolean: "+tent*", wantShort: []string{"xl"}},
+		// Words and phrases made only of short tokens fall back to LIKE
+		{input: "xl 5l", wantShort: []string{"xl", "5l"}},
+		{input: `"xl 5l"`, wantShort: []string{"xl 5l"}},
+		{input: `"5l tent"`, wantBoolean: `+"5l tent"`},
+		{input: `"" !!`},
+	}
+	for _, tt := range tests {
+		q := Parse(tt.input)
+		if got := q.BooleanMode(); got != tt.wantBoolean {
+			t.Errorf("Parse(%q).BooleanMode() = %q, want %q", tt.input, got, tt.wantBoolean)
+		}
+		if !reflect.DeepEqual(q.ShortTerms, tt.wantShort) {
+			t.Errorf("Parse(%q).ShortTerms = %q, want %q", tt.input, q.ShortTerms, tt.wantShort)
+		}
+		if wantEmpty := tt.wantBoolean == "" && len(tt.wantShort) == 0; q.IsEmpty() != wantEmpty {
+			t.Errorf("Parse(%q).IsEmpty() = %v, want %v", tt.input, q.IsEmpty(), wantEmpty)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package shipping
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Destination is where a parcel is shipped to
+type Destination struct {
+	Country string // ISO 3166-1 alpha-2 code (upper case)
+	Region  string // State, province or prefecture (empty if unknown)
+}
+
+// String returns destination as "COUNTRY/Region" (for logs)
+func (d Destination) String() string {
+	if d.Region == "" {
+		return d.Country
+	}
+	return d.Country + "/" + d.Region
+}
+
+// Pattern of country codes stored in rates and addresses
+var countryCodePattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// ValidCountry reports whether value is a 2-letter upper case country code
+func ValidCountry(country string) bool {
+	return countryCodePattern.MatchString(country)
+}
+
+// NewDestination normalizes country and region of structured address
+func NewDestination(country, region string) Destination {
+	return Destination{
+		Country: strings.ToUpper(strings.TrimSpace(country)),
+		Region:  strings.TrimSpace(region),
+	}
+}
@@ -0,0 +1,163 @@
+package shipping
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Method is how fee of a rate is calculated
+type Method string
+
+const (
+	MethodFlat     Method = "flat"     // Same fee for every parcel
+	MethodWeight   Method = "weight"   // Fee of first bracket covering total weight (grams)
+	MethodQuantity Method = "quantity" // Fee of first bracket covering number of items
+)
+
+// AnyCountry matches every destination country (used for fallback rates)
+const AnyCountry = "*"
+
+// ErrNoRate is returned when no rate ships to destination, or parcel exceeds every bracket of the rate
+var ErrNoRate = errors.New("no shipping rate available")
+
+// Bracket is one step of a weight- or quantity-based rate.
+// It applies to values up to and including UpTo (0 means no upper limit).
+type Bracket struct {
+	UpTo int `json:"upTo"`
+	Fee  int `json:"fee"`
+}
+
+// Rate is shipping rate of one destination zone
+type Rate struct {
+	ID            int
+	Name          string
+	Country       string // ISO 3166-1 alpha-2 code, or AnyCountry
+	Region        string // State, province or prefecture (empty for whole country)
+	Method        Method
+	FlatFee       int       // Used by MethodFlat
+	Brackets      []Bracket // Used by MethodWeight and MethodQuantity
+	FreeThreshold *int      // Subtotal at or above which shipping is free (nil if never free)
+}
+
+// Table is set of rates, from which the most specific match for a destination is used
+type Table []Rate
+
+// Parcel is what is being shipped
+type Parcel struct {
+	Subtotal    int // Total price of items
+	Quantity    int // Number of items
+	WeightGrams int // Total weight of items
+}
+
+// Quote is calculated shipping fee
+type Quote struct {
+	RateID   int    `json:"rateId"`
+	RateName string `json:"rateName"`
+	Fee      int    `json:"fee"`
+	Free     bool   `json:"free"` // Fee waived by free shipping threshold
+}
+
+// Validate checks rate settings are consistent with its method.
+// Returned error message is meant to be shown to admin users.
+func (r Rate) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("rate name is required")
+	}
+	if r.Country != AnyCountry && !ValidCountry(r.Country) {
+		return errors.New("country must be a 2-letter country code or *")
+	}
+	if r.Country == AnyCountry && r.Region != "" {
+		return errors.New("region requires a country")
+	}
+	if r.FreeThreshold != nil && *r.FreeThreshold < 0 {
+		return errors.New("free shipping threshold must be 0 or greater")
+	}
+	switch r.Method {
+	case MethodFlat:
+		if r.FlatFee < 0 {
+			return errors.New("flat fee must be 0 or greater")
+		}
+	case MethodWeight, MethodQuantity:
+		if len(r.Brackets) == 0 {
+			return fmt.Errorf("%s rate needs at least one bracket", r.Method)
+		}
+		for i, b := range r.Brackets {
+			if b.Fee < 0 || b.UpTo < 0 {
+				return errors.New("bracket values must be 0 or greater")
+			}
+			if b.UpTo == 0 && i != len(r.Brackets)-1 {
+				return errors.New("only the last bracket may have no upper limit")
+			}
+			if i > 0 && b.UpTo != 0 && b.UpTo <= r.Brackets[i-1].UpTo {
+				return errors.New("bracket limits must be in ascending order")
+			}
+		}
+	default:
+		return errors.New("method must be flat, weight or quantity")
+	}
+	return nil
+}
+
+// Fee calculates fee of parcel with this rate
+func (r Rate) Fee(parcel Parcel) (Quote, error) {
+	quote := Quote{RateID: r.ID, RateName: r.Name}
+	if r.FreeThreshold != nil && parcel.Subtotal >= *r.FreeThreshold {
+		quote.Free = true
+		return quote, nil
+	}
+
+	switch r.Method {
+	case MethodFlat:
+		quote.Fee = r.FlatFee
+		return quote, nil
+	case MethodWeight, MethodQuantity:
+		value := parcel.WeightGrams
+		if r.Method == MethodQuantity {
+			value = parcel.Quantity
+		}
+		for _, b := range r.Brackets {
+			if b.UpTo == 0 || value <= b.UpTo {
+				quote.Fee = b.Fee
+				return quote, nil
+			}
+		}
+		return quote, fmt.Errorf("%w: %s rate %q has no bracket for %d", ErrNoRate, r.Method, r.Name, value)
+	}
+	return quote, fmt.Errorf("unknown shipping method %q", r.Method)
+}
+
+// Match returns the most specific rate for destination:
+// country and region, then whole country, then AnyCountry
+func (t Table) Match(dest Destination) (Rate, bool) {
+	best := -1
+	bestScore := 0
+	for i, r := range t {
+		score := 0
+		switch {
+		case r.Country == AnyCountry:
+			score = 1
+		case r.Country == dest.Country && r.Region == "":
+			score = 2
+		case r.Country == dest.Country && strings.EqualFold(r.Region, dest.Region):
+			score = 3
+		}
+		// Lower ID wins ties, so result doesn't depend on row order
+		if score > bestScore || (score == bestScore && score > 0 && r.ID < t[best].ID) {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return Rate{}, false
+	}
+	return t[best], true
+}
+
+// Quote calculates shipping fee of parcel to destination
+func (t Table) Quote(dest Destination, parcel Parcel) (Quote, error) {
+	rate, ok := t.Match(dest)
+	if !ok {
+		return Quote{}, fmt.Errorf("%w: destination %s", ErrNoRate, dest)
+	}
+	return rate.Fee(parcel)
+}
@@ -0,0 +1,148 @@
+package tax
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+)
+
+// DefaultClass is tax class of products that don't specify one
+const DefaultClass = "standard"
+
+// AnyCountry matches every destination country (used for fallback rates)
+const AnyCountry = shipping.AnyCountry
+
+// Rate is tax rate of one product class in one region.
+// BasisPoints is the percentage in hundredths (1000 = 10%), so rates like 8.875% are exact.
+type Rate struct {
+	ID          int
+	Name        string
+	Country     string // ISO 3166-1 alpha-2 code, or AnyCountry
+	Region      string // State, province or prefecture (empty for whole country)
+	Class       string
+	BasisPoints int
+}
+
+// Table is set of rates, from which the most specific match for a destination and class is used
+type Table []Rate
+
+// Line is amount of one order line to be taxed
+type Line struct {
+	Class  string
+	Amount int // Price × quantity after discounts
+}
+
+// Pattern of tax class names
+var classPattern = regexp.MustCompile(`^[a-z0-9_-]{1,50}$`)
+
+// NormalizeClass lower-cases class name, falling back to DefaultClass if empty
+func NormalizeClass(class string) string {
+	class = strings.ToLower(strings.TrimSpace(class))
+	if class == "" {
+		return DefaultClass
+	}
+	return class
+}
+
+// ValidClass reports whether class name can be stored
+func ValidClass(class string) bool {
+	return classPattern.MatchString(class)
+}
+
+// Validate checks rate settings.
+// Returned error message is meant to be shown to admin users.
+func (r Rate) Validate() error {
+	if strings.TrimSpace(r.Name) == "" {
+		return errors.New("rate name is required")
+	}
+	if r.Country != AnyCountry && !shipping.ValidCountry(r.Country) {
+		return errors.New("country must be a 2-letter country code or *")
+	}
+	if r.Country == AnyCountry && r.Region != "" {
+		return errors.New("region requires a country")
+	}
+	if !ValidClass(r.Class) {
+		return errors.New("tax class may only contain lowercase letters, digits, - and _")
+	}
+	if r.BasisPoints < 0 || r.BasisPoints > 10000 {
+		return errors.New("rate must be between 0 and 10000 basis points")
+	}
+	return nil
+}
+
+// Match returns the most specific rate of class for destination:
+// country and region, then whole country, then AnyCountry.
+// Classes without a matching rate are not taxed.
+func (t Table) Match(dest shipping.Destination, class string) (Rate, bool) {
+	best := -1
+	bestScore := 0
+	for i, r := range t {
+		if r.Class != class {
+			continue
+		}
+		score := 0
+		switch {
+		case r.Country == AnyCountry:
+			score = 1
+		case r.Country == dest.Country && r.Region == "":
+			score = 2
+		case r.Country == dest.Country && strings.EqualFold(r.Region, dest.Region):
+			score = 3
+		}
+		// Lower ID wins ties, so result doesn't depend on row order
+		if score > bestScore || (score == bestScore && score > 0 && r.ID < t[best].ID) {
+			best, bestScore = i, score
+		}
+	}
+	if best < 0 {
+		return Rate{}, false
+	}
+	return t[best], true
+}
+
+// Calculate returns tax of lines shipped to destination.
+// If inclusive is true, amounts already include tax and the included tax is returned.
+// Lines are totalled per rate and each total is rounded down once, so tax doesn't drift with the number of lines.
+func (t Table) Calculate(dest shipping.Destination, lines []Line, inclusive bool) int {
+	tax := 0
+	for _, share := range t.Allocate(dest, lines, inclusive) {
+		tax += share
+	}
+	return tax
+}
+
+// Allocate returns tax of each line, adding up to Calculate.
+// Tax of each rate total is spread over its lines in proportion to their amounts,
+// and rounding remainder goes to the last line of the rate.
+func (t Table) Allocate(dest shipping.Destination, lines []Line, inclusive bool) []int {
+	shares := make([]int, len(lines))
+	totals := map[int]int{}    // Basis points to total amount
+	indexes := map[int][]int{} // Basis points to indexes of lines taxed at the rate
+	for i, line := range lines {
+		rate, ok := t.Match(dest, NormalizeClass(line.Class))
+		if !ok || rate.BasisPoints == 0 || line.Amount <= 0 {
+			continue
+		}
+		totals[rate.BasisPoints] += line.Amount
+		indexes[rate.BasisPoints] = append(indexes[rate.BasisPoints], i)
+	}
+
+	for bp, total := range totals {
+		tax := total * bp / 10000
+		if inclusive {
+			tax = total * bp / (10000 + bp)
+		}
+		allocated := 0
+		for n, i := range indexes[bp] {
+			if n == len(indexes[bp])-1 {
+				shares[i] = tax - allocated
+				break
+			}
+			shares[i] = tax * lines[i].Amount / total
+			allocated += shares[i]
+		}
+	}
+	return shares
+}
@@ -0,0 +1,46 @@
+package tax
+
+import (
+	"testing"
+
+	"github.com/yukaty/go-trailhead/backend/internal/shipping"
+)
+
+func TestAllocate(t *testing.T) {
+	table := Table{
+		{Country: "JP", Class: DefaultClass, BasisPoints: 1000}, // 10%
+		{Country: "JP", Class: "food", BasisPoints: 800},        // 8%
+	}
+	dest := shipping.Destination{Country: "JP", Region: "Tokyo"}
+	lines := []Line{
+		{Class: DefaultClass, Amount: 3333},
+		{Class: "food", Amount: 1999},
+		{Class: DefaultClass, Amount: 3333},
+		{Class: "exempt", Amount: 5000}, // No rate, not taxed
+	}
+
+	tests := []struct {
+		inclusive bool
+		want      []int
+		wantTotal int
+	}{
+		// 6666 × 10% = 666 split 333/333, 1999 × 8% = 159
+		{inclusive: false, want: []int{333, 159, 333, 0}, wantTotal: 825},
+		// 6666 × 10/110 = 606 split 303/303, 1999 × 8/108 = 148
+		{inclusive: true, want: []int{303, 148, 303, 0}, wantTotal: 754},
+	}
+	for _, tt := range tests {
+		shares := table.Allocate(dest, lines, tt.inclusive)
+		sum := 0
+		for i, share := range shares {
+			if share != tt.want[i] {
+				t.Errorf("inclusive=%v: tax of line %d = %d, want %d", tt.inclusive, i, share, tt.want[i])
+			}
+			sum += share
+		}
+		// Line taxes add up to tax of rate totals (rounded once per rate)
+		if total := table.Calculate(dest, lines, tt.inclusive); sum != total || total != tt.wantTotal {
+			t.Errorf("inclusive=%v: line taxes add up to %d, Calculate = %d, want %d", tt.inclusive, sum, total, tt.wantTotal)
+		}
+	}
+}
@@ -7,6 +7,7 @@ import { useCart, CartItem } from '@/hooks/useCart';
 import { Button } from '@/components/ui/button';
 import { CONNECTION_ERROR_MESSAGE } from '@/lib/constants';
 import { handleApiResponse } from '@/lib/api';
+import { formatPrice } from '@/lib/utils';
 
 type FavoriteProduct = {
   id: number;
@@ -97,7 +98,7 @@ export default function FavoritesPage() {
               <div className="flex-1 flex flex-col justify-between gap-2 sm:gap-4 text-center sm:text-left">
                 <h2 className="text-lg sm:text-xl font-semibold">{item.name}</h2>
                 <p className="text-forest-600 font-bold text-base sm:text-lg">
-                  ${item.price.toLocaleString()}
+                  {formatPrice(item.price)}
                   <span className="text-sm sm:text-base font-normal text-stone-500"> (incl. tax)</span>
                 </p>
               </div>
@@ -2,30 +2,56 @@
 
 import Link from 'next/link';
 import { useEffect, useState } from 'react';
+import { formatPrice } from '@/lib/utils';
 
 // Order item data type definition
 interface OrderItem {
+  productId: number;
   productName: string;
   quantity: number;
   unitPrice: number;
 }
 
 // Final response type definition (order data with item details array)
-// NOTE: Status values must match backend API responses - requires backend translation
+// NOTE: Status values match orders table ENUMs returned by backend API
 interface OrderData {
   id: number;
   totalPrice: number;
-  status: 'Pending' | 'Processing' | 'Shipped' | 'Completed' | 'Canceled' | 'Refunded';
-  paymentStatus: 'Unpaid' | 'Payment Processing' | 'Payment Successful' | 'Payment Failed' | 'Refund Processing' | 'Refunded';
+  currency: string; // Amounts are in minor units of this currency
+  tax: number; // Included in totalPrice
+  status: 'pending' | 'processing' | 'shipped' | 'delivered' | 'cancelled' | 'refunded';
+  paymentStatus: 'unpaid' | 'processing' | 'paid' | 'failed' | 'refunding' | 'refunded';
   createdAt: string;
   items: OrderItem[]; // Array of item details
 }
 
+// Display labels for order statuses
+const orderStatusLabels: Record<OrderData['status'], string> = {
+  pending: 'Pending',
+  processing: 'Processing',
+  shipped: 'Shipped',
+  delivered: 'Delivered',
+  cancelled: 'Cancelled',
+  refunded: 'Refunded',
+};
+
+// Display labels for payment statuses
+const paymentStatusLabels: Record<OrderData['paymentStatus'], string> = {
+  unpaid: 'Unpaid',
+  processing: 'Payment Processing',
+  paid: 'Payment Successful',
+  failed: 'Payment Failed',
+  refunding: 'Refund Processing',
+  refunded: 'Refunded',
+};
+
 // Order history page
 export default function OrdersPage() {
   const [orders, setOrders] = useState<OrderData[]>([]);
+  const [nextCursor, setNextCursor] = useState<string | null>(null);
   const [errorMessage, setErrorMessage] = useState('');
   const [loading, setLoading] = useState(true);
+  const [loadingMore, setLoadingMore] = useState(false);
 
   // Fetch order data on initial load
   useEffect(() => {
@@ -39,6 +65,7 @@ export default function OrdersPage() {
           return;
         }
         setOrders(data.orders); // Update order history data
+        setNextCursor(data.nextCursor ?? null);
       } catch (err) {
         console.error(err);
         setErrorMessage('A connection error occurred.');
@@ -51,6 +78,48 @@ export default function OrdersPage() {
     getOrders();
   }, []);
 
+  // Fetch next page of order history
+  const loadMore = async () => {
+    if (!nextCursor) return;
+    setLoadingMore(true);
+    try {
+      const res = await fetch(`/api/orders?cursor=${encodeURIComponent(nextCursor)}`);
+      const data = await res.json();
+      if (!res.ok) {
+        setErrorMessage(data.error || 'Failed to load order history.');
+        return;
+      }
+      setOrders((prev) => [...prev, ...data.orders]);
+      setNextCursor(data.nextCursor ?? null);
+    } catch (err) {
+      console.error(err);
+      setErrorMessage('A connection error occurred.');
+    } finally {
+      setLoadingMore(false);
+    }
+  };
+
+  // Cancel order (unpaid orders are cancelled, paid orders not yet shipped are refunded)
+  const cancelOrder = async (orderId: number) => {
+    if (!confirm('Cancel this order?')) return;
+    try {
+      const res = await fetch(`/api/orders/${orderId}/cancel`, { method: 'POST' });
+      const data = await res.json();
+      if (!res.ok) {
+        alert(data.error || 'Failed to cancel order.');
+        return;
+      }
+      setOrders((prev) =>
+        prev.map((order) =>
+          order.id === orderId ? { ...order, status: data.status, paymentStatus: data.paymentStatus } : order
+        )
+      );
+    } catch (err) {
+      console.error(err);
+      alert('A connection error occurred.');
+    }
+  };
+
   if (loading) return <div className="text-center py-12 text-stone-600 text-lg">Loading order history...</div>;
   if (errorMessage) return <p className="text-center py-12 text-red-600">{errorMessage}</p>;
   if (orders.length === 0) return <p className="text-center py-12 text-stone-500">No order history found.</p>;
@@ -58,19 +127,18 @@ export default function OrdersPage() {
   // Determine display style based on status
   const getStatusStyle = (status: OrderData['status'] | OrderData['paymentStatus']) => {
     switch (status) {
-      case 'Pending':
-      case 'Processing':
-      case 'Unpaid':
-      case 'Payment Processing':
-      case 'Refund Processing': // In progress or requires attention
+      case 'pending':
+      case 'processing':
+      case 'unpaid':
+      case 'refunding': // In progress or requires attention
         return 'text-yellow-500';
-      case 'Shipped':
-      case 'Completed':
-      case 'Payment Successful': // Positive completion status
+      case 'shipped':
+      case 'delivered':
+      case 'paid': // Positive completion status
         return 'text-green-500';
-      case 'Canceled':
-      case 'Payment Failed':
-      case 'Refunded': // Negative final status
+      case 'cancelled':
+      case 'failed':
+      case 'refunded': // Negative final status
         return 'text-red-500';
       default:
         return 'text-stone-500'; // Default color
@@ -97,9 +165,21 @@ export default function OrdersPage() {
                 <p>Order Date: {order.createdAt ? new Date(order.createdAt).toLocaleDateString() : '-'}</p>
               </div>
               <div className="text-right font-semibold">
-                <p className="text-blue-600 text-xl">Total: ${order.totalPrice.toLocaleString()} (incl. shipping)</p>
-                <p className={getStatusStyle(order.status)}>Order Status: {order.status}</p>
-                <p className={getStatusStyle(order.paymentStatus)}>Payment Status: {order.paymentStatus}</p>
+                <p className="text-blue-600 text-xl">Total: {formatPrice(order.totalPrice, order.currency)} (incl. shipping)</p>
+                {order.tax > 0 && (
+                  <p className="text-stone-600 text-sm font-normal">Tax: {formatPrice(order.tax, order.currency)}</p>
+                )}
+                <p className={getStatusStyle(order.status)}>Order Status: {orderStatusLabels[order.status] ?? order.status}</p>
+                <p className={getStatusStyle(order.paymentStatus)}>Payment Status: {paymentStatusLabels[order.paymentStatus] ?? order.paymentStatus}</p>
+                {((order.status === 'pending' && order.paymentStatus === 'unpaid') ||
+                  (order.status === 'processing' && order.paymentStatus === 'paid')) && (
+                  <button
+                    onClick={() => cancelOrder(order.id)}
+                    className="mt-2 px-4 py-1 text-sm border border-red-300 text-red-600 rounded-md hover:bg-red-50"
+                  >
+                    Cancel Order
+                  </button>
+                )}
               </div>
             </div>
 
@@ -114,9 +194,13 @@ export default function OrdersPage() {
               <tbody>
                 {order.items.map((item, index) => (
                   <tr key={index} className="hover:bg-stone-50">
-                    <td className={tableStyle}>{item.productName}</td>
+                    <td className={tableStyle}>
+                      <Link href={`/products/${item.productId}`} className="text-forest-600 hover:underline">
+                        {item.productName}
+                      </Link>
+                    </td>
                     <td className={tableStyle}>{item.quantity}</td>
-                    <td className={tableStyle}>${item.unitPrice.toLocaleString()}</td>
+                    <td className={tableStyle}>{formatPrice(item.unitPrice, order.currency)}</td>
                   </tr>
                 ))}
               </tbody>
@@ -124,6 +208,17 @@ export default function OrdersPage() {
           </div>
         ))}
       </div>
+      {nextCursor && (
+        <div className="text-center mt-8">
+          <button
+            onClick={loadMore}
+            disabled={loadingMore}
+            className="px-6 py-2 border border-stone-300 rounded-md hover:bg-stone-50 disabled:opacity-50"
+          >
+            {loadingMore ? 'Loading...' : 'Load more'}
+          </button>
+        </div>
+      )}
     </div>
   );
 }
\ No newline at end of file
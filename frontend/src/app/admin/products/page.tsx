@@ -1,5 +1,5 @@
 import Link from 'next/link';
-import { cn } from '@/lib/utils';
+import { cn, formatPrice } from '@/lib/utils';
 import { ProductAdminItem } from '@/lib/types';
 import { TABLE_CELL_STYLE, SUCCESS_MESSAGE_STYLE } from '@/lib/constants';
 import Pagination from '@/components/Pagination';
@@ -82,7 +82,7 @@ export default async function AdminProductsPage({
                   <tr key={product.id} className="hover:bg-stone-100">
                     <td className={TABLE_CELL_STYLE}>{product.id}</td>
                     <td className={TABLE_CELL_STYLE}>{product.name}</td>
-                    <td className={TABLE_CELL_STYLE}>${product.price.toLocaleString()}</td>
+                    <td className={TABLE_CELL_STYLE}>{formatPrice(product.price, product.currency)}</td>
                     <td className={TABLE_CELL_STYLE}>{product.stock}</td>
                     <td className={TABLE_CELL_STYLE}>
                       {product.updated_at ? new Date(product.updated_at).toLocaleDateString() : '-'}
@@ -4,6 +4,7 @@ import Link from 'next/link';
 import { useCart, CartItem } from '@/hooks/useCart';
 import { Button } from '@/components/ui/button';
 import CartItemCard from '@/components/CartItemCard';
+import { formatPrice } from '@/lib/utils';
 
 export default function CartPage() {
   const { cartItems, removeItem, updateQuantity, totalPrice } = useCart();
@@ -33,7 +34,7 @@ export default function CartPage() {
 
           <div className="mt-8 flex flex-col sm:flex-row sm:justify-between sm:items-center gap-4 border-t border-stone-300 pt-6">
             <div className="flex flex-col text-center sm:text-left">
-              <p className="text-xl sm:text-2xl font-bold">Total: ${totalPrice.toLocaleString()}</p>
+              <p className="text-xl sm:text-2xl font-bold">Total: {formatPrice(totalPrice)}</p>
               <p className="text-sm sm:text-base text-stone-500">All prices include tax.</p>
             </div>
             <Button asChild className="w-full sm:w-auto">
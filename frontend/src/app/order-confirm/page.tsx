@@ -1,43 +1,120 @@
 'use client';
 
-import { useState } from 'react';
+import { useEffect, useRef, useState } from 'react';
 import Link from 'next/link';
 import { useRouter } from 'next/navigation';
 import { useCart, CartItem } from '@/hooks/useCart';
 import { Button } from '@/components/ui/button';
 import { Label } from '@/components/ui/label';
 import { Badge } from '@/components/ui/badge';
-import { cn } from '@/lib/utils';
+import { Input } from '@/components/ui/input';
 import { ERROR_MESSAGE_STYLE } from '@/lib/constants';
 import CartItemCard from '@/components/CartItemCard';
+import { formatPrice } from '@/lib/utils';
 
-const SHIPPING_COST = 500;
+interface ShippingAddress {
+  recipient: string;
+  postalCode: string;
+  country: string;
+  region: string;
+  city: string;
+  line1: string;
+  line2: string | null;
+  phone: string;
+}
+
+interface SavedAddress extends ShippingAddress {
+  id: number;
+  isDefault: boolean;
+}
+
+const EMPTY_ADDRESS: ShippingAddress = {
+  recipient: '', postalCode: '', country: '', region: '', city: '', line1: '', line2: null, phone: '',
+};
+
+// Address form fields (line2 is optional)
+const ADDRESS_FIELDS: { key: keyof ShippingAddress; label: string; placeholder: string; required: boolean }[] = [
+  { key: 'recipient', label: 'Recipient', placeholder: 'Full name', required: true },
+  { key: 'line1', label: 'Address Line 1', placeholder: 'Street address', required: true },
+  { key: 'line2', label: 'Address Line 2', placeholder: 'Apartment, suite, etc.', required: false },
+  { key: 'city', label: 'City', placeholder: 'City', required: true },
+  { key: 'region', label: 'State / Province / Prefecture', placeholder: 'e.g. CA', required: true },
+  { key: 'postalCode', label: 'Postal Code', placeholder: 'e.g. 94103', required: true },
+  { key: 'country', label: 'Country', placeholder: '2-letter code (e.g. US)', required: false },
+  { key: 'phone', label: 'Phone', placeholder: 'e.g. +1 415 555 0100', required: true },
+];
+
+// Format saved address in one line for selection list
+const formatAddress = (a: ShippingAddress) =>
+  [a.recipient, a.line1, a.line2, a.city, `${a.region} ${a.postalCode}`, a.country].filter(Boolean).join(', ');
 
 export default function OrderConfirmPage() {
   const router = useRouter();
   const { cartItems, totalPrice } = useCart();
-  const finalPrice = totalPrice + SHIPPING_COST;
-  const [address, setAddress] = useState('');
+  const [savedAddresses, setSavedAddresses] = useState<SavedAddress[]>([]);
+  const [selectedAddressId, setSelectedAddressId] = useState<number | null>(null); // null = new address
+  const [newAddress, setNewAddress] = useState<ShippingAddress>(EMPTY_ADDRESS);
+  const [saveAddress, setSaveAddress] = useState(true);
+  const [couponCode, setCouponCode] = useState('');
+  const [isGuest, setIsGuest] = useState(false); // Not logged in (checkout as guest)
+  const [guestEmail, setGuestEmail] = useState('');
   const [isAgreed, setIsAgreed] = useState(false);
   const [errorMessage, setErrorMessage] = useState('');
+  const [submitting, setSubmitting] = useState(false);
+  // Same key is sent until checkout fails, so repeated clicks create only one order
+  const idempotencyKey = useRef(crypto.randomUUID());
+
+  // Load address book and preselect default address (guests have no address book)
+  useEffect(() => {
+    const fetchAddresses = async () => {
+      const res = await fetch('/api/addresses');
+      if (res.status === 401) {
+        setIsGuest(true);
+        return;
+      }
+      if (!res.ok) return;
+      const addresses: SavedAddress[] = await res.json();
+      setSavedAddresses(addresses);
+      const defaultAddress = addresses.find((a) => a.isDefault);
+      if (defaultAddress) setSelectedAddressId(defaultAddress.id);
+    };
+    fetchAddresses();
+  }, []);
 
   const handleConfirmPayment = async () => {
-    if (!address.trim()) {
-      setErrorMessage('Please enter your shipping address.');
+    if (isGuest && !guestEmail.trim()) {
+      setErrorMessage('Please enter your email address.');
       return;
     }
+    if (selectedAddressId === null) {
+      const missing = ADDRESS_FIELDS.find((f) => f.required && !String(newAddress[f.key] ?? '').trim());
+      if (missing) {
+        setErrorMessage(`Please enter ${missing.label.toLowerCase()} of your shipping address.`);
+        return;
+      }
+    }
     if (!isAgreed) {
       setErrorMessage('Please agree to the Terms of Service and Privacy Policy.');
       return;
     }
 
+    setSubmitting(true);
     const checkoutRes = await fetch('/api/orders/checkout', {
       method: 'POST',
-      headers: { 'Content-Type': 'application/json' },
-      body: JSON.stringify({ items: cartItems, address }),
+      headers: { 'Content-Type': 'application/json', 'Idempotency-Key': idempotencyKey.current },
+      body: JSON.stringify(
+        selectedAddressId !== null
+          ? { items: cartItems, addressId: selectedAddressId, couponCode }
+          : isGuest
+            ? { items: cartItems, email: guestEmail, shippingAddress: newAddress, couponCode }
+            : { items: cartItems, shippingAddress: newAddress, saveAddress, couponCode }
+      ),
     });
     if (!checkoutRes.ok) {
-      setErrorMessage('[frontend] Failed to generate payment page.');
+      idempotencyKey.current = crypto.randomUUID(); // Corrected order is a new request
+      setSubmitting(false);
+      const errorData = await checkoutRes.json().catch(() => null);
+      setErrorMessage(errorData?.error || '[frontend] Failed to generate payment page.');
       return;
     }
     const checkoutData = await checkoutRes.json();
@@ -72,32 +149,102 @@ export default function OrderConfirmPage() {
             ))}
           </div>
 
+          {isGuest && (
+            <div className="mt-8 border-t border-stone-300 pt-6">
+              <Label htmlFor="guestEmail" className="font-bold mb-1">
+                Email Address <Badge variant="destructive" className="ml-2">Required</Badge>
+              </Label>
+              <Input
+                id="guestEmail"
+                type="email"
+                value={guestEmail}
+                placeholder="you@example.com"
+                className="max-w-md"
+                onChange={(e) => setGuestEmail(e.target.value)}
+              />
+              <p className="text-stone-500 text-sm mt-1">
+                You are checking out as a guest. <Link href="/login?redirect=/order-confirm" className="text-forest-600 hover:underline">Log in</Link>
+                {' '}to use your address book. You can add this order to an account later from its tracking link.
+              </p>
+            </div>
+          )}
+
           <div className="mt-8 border-t border-stone-300 pt-6">
-            <Label htmlFor="address" className="font-bold mb-1">
+            <p className="font-bold mb-2">
               Shipping Address <Badge variant="destructive" className="ml-2">Required</Badge>
-            </Label>
-            <textarea
-              id="address"
-              value={address}
-              placeholder="Enter your shipping address"
-              required
-              className={cn(
-                "w-full rounded-md border border-input bg-background px-3 py-2 text-sm",
-                "focus-visible:outline-none focus-visible:ring-2 focus-visible:ring-ring focus-visible:ring-offset-2"
-              )}
-              onChange={(e) => setAddress(e.target.value)}
+            </p>
+            {savedAddresses.map((a) => (
+              <label key={a.id} className="flex items-start gap-2 mb-2 text-sm">
+                <input
+                  type="radio"
+                  name="shippingAddress"
+                  checked={selectedAddressId === a.id}
+                  onChange={() => setSelectedAddressId(a.id)}
+                />
+                <span>{formatAddress(a)}{a.isDefault && <Badge className="ml-2">Default</Badge>}</span>
+              </label>
+            ))}
+            {savedAddresses.length > 0 && (
+              <label className="flex items-center gap-2 mb-2 text-sm">
+                <input
+                  type="radio"
+                  name="shippingAddress"
+                  checked={selectedAddressId === null}
+                  onChange={() => setSelectedAddressId(null)}
+                />
+                <span>Use a new address</span>
+              </label>
+            )}
+
+            {selectedAddressId === null && (
+              <div className="grid grid-cols-1 md:grid-cols-2 gap-4 mt-2">
+                {ADDRESS_FIELDS.map((f) => (
+                  <div key={f.key}>
+                    <Label htmlFor={f.key} className="mb-1">{f.label}</Label>
+                    <Input
+                      id={f.key}
+                      value={newAddress[f.key] ?? ''}
+                      placeholder={f.placeholder}
+                      required={f.required}
+                      onChange={(e) => setNewAddress({ ...newAddress, [f.key]: e.target.value || (f.key === 'line2' ? null : '') })}
+                    />
+                  </div>
+                ))}
+                {!isGuest && (
+                  <label className="flex items-center gap-2 text-sm md:col-span-2">
+                    <input type="checkbox" checked={saveAddress} onChange={(e) => setSaveAddress(e.target.checked)} />
+                    Save this address to my address book
+                  </label>
+                )}
+              </div>
+            )}
+          </div>
+
+          <div className="mt-6">
+            <Label htmlFor="couponCode" className="mb-1">Coupon Code</Label>
+            <Input
+              id="couponCode"
+              value={couponCode}
+              placeholder="Optional"
+              className="max-w-xs"
+              onChange={(e) => setCouponCode(e.target.value)}
             />
           </div>
 
           <div className="mt-6">
             <div className="flex justify-between items-center pb-2 font-semibold">
-              <span>Subtotal:</span><span>${totalPrice.toLocaleString()}</span>
+              <span>Subtotal:</span><span>{formatPrice(totalPrice)}</span>
             </div>
             <div className="flex justify-between items-center py-4 border-b border-stone-300 font-semibold">
-              <span>Shipping:</span><span>${SHIPPING_COST.toLocaleString()}</span>
+              <span>Shipping:</span><span className="text-stone-600 font-normal">Calculated from your address at payment</span>
             </div>
+            {couponCode.trim() && (
+              <div className="flex justify-between items-center py-4 border-b border-stone-300 font-semibold">
+                <span>Discount:</span><span className="text-stone-600 font-normal">Coupon is applied at payment</span>
+              </div>
+            )}
             <div className="flex justify-between items-center pt-4 text-green-600 text-2xl font-bold">
-              <span>Total:</span><span>${finalPrice.toLocaleString()}</span>
+              <span>Total (before shipping):</span><span>{formatPrice(totalPrice)}</span>
             </div>
 
             <p className="text-stone-500 text-sm mt-2 text-right">
@@ -134,8 +281,8 @@ export default function OrderConfirmPage() {
           <div className="mt-8 flex flex-col sm:flex-row sm:justify-between sm:items-center gap-3 sm:gap-4">
             <Button
               onClick={handleConfirmPayment}
-              disabled={!isAgreed || !address.trim()}
-              variant={isAgreed && address.trim() ? 'default' : 'secondary'}
+              disabled={!isAgreed || submitting}
+              variant={isAgreed ? 'default' : 'secondary'}
               className="w-full sm:w-auto order-2 sm:order-1"
             >
               Proceed to Payment
@@ -0,0 +1,162 @@
+'use client';
+
+import Link from 'next/link';
+import { useEffect, useState } from 'react';
+import { useParams, useSearchParams } from 'next/navigation';
+import { useCart } from '@/hooks/useCart';
+import { formatPrice } from '@/lib/utils';
+
+// Order line item data type definition
+interface OrderDetailItem {
+  id: number;
+  productId: number;
+  productName: string;
+  quantity: number;
+  unitPrice: number;
+  subtotal: number;
+}
+
+// Guest order detail type definition (same as order detail of logged-in users)
+interface OrderDetail {
+  id: number;
+  status: string;
+  paymentStatus: string;
+  subtotal: number;
+  shippingCost: number;
+  discount: number;
+  couponCode: string | null;
+  tax: number;
+  taxInclusive: boolean;
+  totalPrice: number;
+  currency: string; // Amounts are in minor units of this currency
+  shippingAddress: string;
+  createdAt: string;
+  items: OrderDetailItem[];
+}
+
+// Guest order tracking page (opened from signed link returned at checkout)
+export default function GuestOrderPage() {
+  const { id } = useParams<{ id: string }>();
+  const searchParams = useSearchParams();
+  const token = searchParams.get('token') ?? '';
+  const sessionId = searchParams.get('session_id');
+  const { clearCart } = useCart();
+  const [order, setOrder] = useState<OrderDetail | null>(null);
+  const [errorMessage, setErrorMessage] = useState('');
+  const [claimMessage, setClaimMessage] = useState('');
+
+  // Clear cart after returning from payment page
+  useEffect(() => {
+    if (sessionId) {
+      clearCart();
+    }
+  }, [sessionId, clearCart]);
+
+  useEffect(() => {
+    const getOrder = async () => {
+      try {
+        const res = await fetch(`/api/orders/guest/${id}?token=${encodeURIComponent(token)}`);
+        const data = await res.json();
+        if (!res.ok) {
+          setErrorMessage(data.error || 'Failed to load order.');
+          return;
+        }
+        setOrder(data);
+      } catch (err) {
+        console.error(err);
+        setErrorMessage('A connection error occurred.');
+      }
+    };
+    getOrder();
+  }, [id, token]);
+
+  // Add order to account of logged-in user (signed link proves the order is theirs)
+  const claimOrder = async () => {
+    try {
+      const res = await fetch(`/api/orders/guest/${id}/claim?token=${encodeURIComponent(token)}`, { method: 'POST' });
+      if (res.status === 401) {
+        const redirect = `/orders/${id}?token=${encodeURIComponent(token)}`;
+        window.location.href = `/login?redirect=${encodeURIComponent(redirect)}`;
+        return;
+      }
+      const data = await res.json();
+      setClaimMessage(res.ok ? 'This order is now in your order history.' : data.error || 'Failed to add order to your account.');
+    } catch (err) {
+      console.error(err);
+      setClaimMessage('A connection error occurred.');
+    }
+  };
+
+  if (errorMessage) return <p className="text-center py-12 text-red-600">{errorMessage}</p>;
+  if (!order) return <div className="text-center py-12 text-stone-600 text-lg">Loading order...</div>;
+
+  const tableStyle = 'px-3 py-2 border-b';
+
+  return (
+    <>
+      {sessionId && (
+        <div className="w-full bg-green-100 text-green-800 p-3 text-center shadow-md flex flex-col items-center justify-center mb-6 rounded-md">
+          <p className="text-xl font-bold mt-4">Thank you for your order!</p>
+          <p>Bookmark this page to track your order.</p>
+        </div>
+      )}
+      <main className="container mx-auto px-4 py-8">
+        <h1 className="text-center mb-8">Order {order.id}</h1>
+        <div className="border rounded-lg shadow-sm p-4 space-y-1">
+          <p>Order Date: {new Date(order.createdAt).toLocaleDateString()}</p>
+          <p>Order Status: {order.status}</p>
+          <p>Payment Status: {order.paymentStatus}</p>
+          <p>Ship To: {order.shippingAddress}</p>
+        </div>
+
+        <table className="w-full text-left mt-6 border-t border-stone-200 shadow-lg rounded-lg overflow-hidden">
+          <thead>
+            <tr className="bg-stone-100 text-stone-700">
+              <th className={tableStyle}>Product Name</th>
+              <th className={tableStyle}>Quantity</th>
+              <th className={tableStyle}>Subtotal</th>
+            </tr>
+          </thead>
+          <tbody>
+            {order.items.map((item) => (
+              <tr key={item.id} className="hover:bg-stone-50">
+                <td className={tableStyle}>
+                  <Link href={`/products/${item.productId}`} className="text-forest-600 hover:underline">
+                    {item.productName}
+                  </Link>
+                </td>
+                <td className={tableStyle}>{item.quantity}</td>
+                <td className={tableStyle}>{formatPrice(item.subtotal, order.currency)}</td>
+              </tr>
+            ))}
+          </tbody>
+        </table>
+
+        <div className="mt-6 text-right space-y-1">
+          <p>Shipping: {formatPrice(order.shippingCost, order.currency)}</p>
+          {order.discount > 0 && (
+            <p>Discount ({order.couponCode}): -{formatPrice(order.discount, order.currency)}</p>
+          )}
+          {order.tax > 0 && (
+            <p className="text-stone-600 text-sm">
+              {order.taxInclusive ? 'Includes tax' : 'Tax'}: {formatPrice(order.tax, order.currency)}
+            </p>
+          )}
+          <p className="text-blue-600 text-xl font-semibold">Total: {formatPrice(order.totalPrice, order.currency)}</p>
+        </div>
+
+        <div className="text-stone-500 text-sm mt-8 text-center space-y-2">
+          {claimMessage ? (
+            <p>{claimMessage}</p>
+          ) : (
+            <p>
+              <button type="button" onClick={claimOrder} className="text-forest-600 hover:underline">Add this order to your account</button>
+              {' '}to see it in your order history (log in with the email address used for this order).
+              {' '}No account yet? <Link href="/register" className="text-forest-600 hover:underline">Create one</Link> with that address first.
+            </p>
+          )}
+        </div>
+      </main>
+    </>
+  );
+}
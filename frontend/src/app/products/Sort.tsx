@@ -19,8 +19,13 @@ export default function Sort({ sort, perPage, keyword }: Props) {
         className="w-full sm:w-48 border border-stone-300 rounded-md px-4 py-2 text-sm sm:text-base focus:outline-none focus:ring-2 focus:ring-forest-500 focus:ring-offset-2"
         onChange={(e) => e.currentTarget.form?.submit()}
       >
+        {keyword && <option value="relevance">Best Match</option>}
         <option value="new">Newest First</option>
         <option value="priceAsc">Price: Low to High</option>
+        <option value="priceDesc">Price: High to Low</option>
+        <option value="popular">Best Selling</option>
+        <option value="rating">Top Rated</option>
+        <option value="name">Name: A to Z</option>
       </select>
     </form>
   );
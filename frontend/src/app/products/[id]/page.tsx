@@ -9,6 +9,7 @@ import { isLoggedIn, AUTH_TOKEN } from '@/lib/auth';
 import CartControls from '@/app/products/[id]/CartControls';
 import ReviewControls from '@/app/products/[id]/ReviewControls';
 import FavoriteControls from '@/app/products/[id]/FavoriteControls';
+import { formatPrice } from '@/lib/utils';
 
 // Product data type definition
 type Product = ProductData; // No changes from base type
@@ -140,7 +141,7 @@ export default async function ProductDetailPage(props: ProductDetailPageProps) {
         <div className="w-full md:w-1/2 space-y-6 pt-4">
           <h1>{product.name}</h1>
           <p className="text-stone-700 whitespace-pre-line">{product.description}</p>
-          <p className="text-3xl font-bold text-forest-600">${product.price.toLocaleString()}<span className="text-base font-normal text-stone-500"> (incl. tax)</span></p>
+          <p className="text-3xl font-bold text-forest-600">{formatPrice(product.price, product.currency)}<span className="text-base font-normal text-stone-500"> (incl. tax)</span></p>
           {reviewCount > 0 ? (
             <div className="flex items-center mb-4">
               <span className="text-yellow-500 text-xl mr-2">{displayStars(rating)}</span>
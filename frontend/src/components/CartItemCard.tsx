@@ -5,7 +5,7 @@ import { CartItem } from '@/hooks/useCart';
 import { Card, CardContent } from '@/components/ui/card';
 import { Button } from '@/components/ui/button';
 import { Label } from '@/components/ui/label';
-import { cn } from '@/lib/utils';
+import { cn, formatPrice } from '@/lib/utils';
 
 const MAX_QUANTITY = 10;
 
@@ -37,7 +37,7 @@ export default function CartItemCard({
         <div className="grow flex flex-col gap-2 sm:gap-3">
           <h2 className="text-lg sm:text-xl font-semibold text-center sm:text-left">{item.title}</h2>
           <p className="text-forest-600 font-bold text-lg sm:text-xl text-center sm:text-left">
-            ${item.price.toLocaleString()}
+            {formatPrice(item.price)}
             <span className="text-sm sm:text-base font-normal text-stone-500"> (incl. tax)</span>
           </p>
           {isEditable ? (
@@ -77,8 +77,8 @@ export default function CartItemCard({
         <div className="flex justify-between sm:block sm:text-right border-t sm:border-t-0 pt-4 sm:pt-0 mt-2 sm:mt-0">
           <span className="sm:hidden font-semibold">Subtotal:</span>
           <p className="font-semibold text-base sm:text-lg sm:w-32">
-            <span className="sm:hidden">${(item.price * item.quantity).toLocaleString()}</span>
-            <span className="hidden sm:inline">Subtotal: ${(item.price * item.quantity).toLocaleString()}</span>
+            <span className="sm:hidden">{formatPrice(item.price * item.quantity)}</span>
+            <span className="hidden sm:inline">Subtotal: {formatPrice(item.price * item.quantity)}</span>
           </p>
         </div>
       </CardContent>
@@ -7,7 +7,7 @@ import { useCart } from '@/hooks/useCart';
 import { Card, CardContent } from '@/components/ui/card';
 import { Button } from '@/components/ui/button';
 import { Heart } from 'lucide-react';
-import { cn } from '@/lib/utils';
+import { cn, formatPrice } from '@/lib/utils';
 import { handleApiResponse } from '@/lib/api';
 
 export interface ProductCardProps {
@@ -155,7 +155,7 @@ export default function ProductCard({
             )
           )}
           <div className="flex justify-between items-center gap-2 pt-1 sm:pt-2 mt-auto">
-            <p className="text-base sm:text-xl font-bold text-forest-700">${price.toLocaleString()}</p>
+            <p className="text-base sm:text-xl font-bold text-forest-700">{formatPrice(price)}</p>
             {showCartButton && (
               <Button
                 onClick={!inCart ? handleCart : undefined}
@@ -6,8 +6,8 @@ import { Input } from '@/components/ui/input';
 import { Label } from '@/components/ui/label';
 import { Button } from '@/components/ui/button';
 import { Badge } from '@/components/ui/badge';
-import { cn } from '@/lib/utils';
-import { FORM_CONTAINER_STYLE } from '@/lib/constants';
+import { cn, currencyDigits } from '@/lib/utils';
+import { FORM_CONTAINER_STYLE, STORE_CURRENCY } from '@/lib/constants';
 
 interface ProductFormProps {
   onSubmit: (e: React.FormEvent<HTMLFormElement>) => void;
@@ -15,7 +15,8 @@ interface ProductFormProps {
     name: string;
     image_url?: string | null | undefined;
     description?: string | null | undefined;
-    price: number;
+    price: number; // In minor units of currency
+    currency?: string;
     stock?: number;
     is_featured?: boolean;
   };
@@ -129,7 +130,7 @@ export default function ProductForm({
 
       <div className="space-y-2">
         <Label htmlFor="price" className="font-bold">
-          Price (incl. tax) <Badge variant="destructive" className="ml-2">Required</Badge>
+          Price ({initialValues.currency ?? STORE_CURRENCY}, incl. tax) <Badge variant="destructive" className="ml-2">Required</Badge>
         </Label>
         <Input
           type="number"
@@ -137,8 +138,8 @@ export default function ProductForm({
           name="price"
           required
           min="0"
-          step="1"
-          defaultValue={initialValues.price}
+          step={10 ** -currencyDigits(initialValues.currency)}
+          defaultValue={initialValues.price / 10 ** currencyDigits(initialValues.currency)}
         />
       </div>
 
@@ -13,3 +13,5 @@ export const SUCCESS_MESSAGE_STYLE = 'w-full bg-green-100 text-green-800 p-3 tex
 
 export const CONNECTION_ERROR_MESSAGE = 'A connection error occurred.';
 
+// Currency of prices when API response doesn't include one (same as backend STORE_CURRENCY)
+export const STORE_CURRENCY = process.env.NEXT_PUBLIC_STORE_CURRENCY || 'JPY';
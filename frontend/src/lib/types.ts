@@ -11,6 +11,6 @@ export type ProductListItem = Pick<
 
 export type ProductAdminItem = Pick<
   ProductData,
-  'id' | 'name' | 'price' | 'stock' | 'updated_at'
+  'id' | 'name' | 'price' | 'currency' | 'stock' | 'updated_at'
 >;
 
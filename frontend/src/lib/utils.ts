@@ -1,6 +1,18 @@
 import { clsx, type ClassValue } from "clsx"
 import { twMerge } from "tailwind-merge"
+import { STORE_CURRENCY } from "@/lib/constants"
 
 export function cn(...inputs: ClassValue[]) {
   return twMerge(clsx(inputs))
 }
+
+// Number of decimal places of currency's minor unit (0 for JPY, 2 for USD)
+export function currencyDigits(currency: string = STORE_CURRENCY) {
+  return new Intl.NumberFormat("en-US", { style: "currency", currency }).resolvedOptions().maximumFractionDigits ?? 0
+}
+
+// Format amount in minor units of currency (e.g. 1250 USD -> "$12.50", 450 JPY -> "¥450")
+export function formatPrice(amount: number, currency: string = STORE_CURRENCY) {
+  const formatter = new Intl.NumberFormat("en-US", { style: "currency", currency })
+  return formatter.format(amount / 10 ** currencyDigits(currency))
+}
@@ -8,7 +8,6 @@ const authPages = [
   '/account/orders',
   '/account/password',
   '/account/favorites',
-  '/order-confirm',
 ];
 
 // Administrative pages
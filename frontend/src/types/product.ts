@@ -2,7 +2,8 @@ export type ProductData = {
   id: number;
   name: string;
   description?: string | null;
-  price: number;
+  price: number; // In minor units of currency
+  currency?: string;
   stock?: number;
   image_url?: string | null;
   review_avg?: number;